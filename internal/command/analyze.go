@@ -0,0 +1,275 @@
+package command
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/config"
+	"github.com/gotracker/gotracker/internal/output"
+	"github.com/gotracker/gotracker/internal/oversample"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/playback/player/feature"
+)
+
+// flags
+type analyzeFlagCfg struct {
+	Format           string `flag:"format" env:"analyze_format" usage:"format of output {human, csv, json}"`
+	AddHeader        bool   `flag:"add-header" env:"-" f:"H" usage:"add header row(s) for formats that support it"`
+	SampleRate       int    `flag:"sample-rate" env:"sample_rate" f:"s" usage:"sample rate"`
+	Channels         int    `flag:"channels" env:"channels" f:"c" usage:"channels"`
+	StereoSeparation int    `flag:"stereo-separation" env:"stereo_separation" f:"S" usage:"stereo separation (0-100)"`
+	ITEnableNNA      bool   `flag:"it-enable-nna" env:"it_enable_nna" usage:"enable Impulse Tracker New Note Actions"`
+	Profile          string `flag:"mix-profile" env:"mix_profile" usage:"how songs are mixed, unless the playlist says otherwise {auto, custom, song, amiga, a500, a500-led, a1200, a1200-led}"`
+	Oversample       int    `flag:"oversample" env:"oversample" usage:"render at this many times the sample rate (1-8), then filter it back down to it, for less aliasing of instruments played high above their pitch"`
+	Normalize        string `flag:"normalize" env:"normalize" usage:"loudness normalization {off, track, album} - track brings each song to the same loudness, album brings the playlist as a whole to it, keeping the songs' levels relative to each other"`
+}
+
+var analyzeFlags = config.NewConfig(analyzeFlagCfg{
+	Format:           "human",
+	AddHeader:        true,
+	SampleRate:       44100,
+	Channels:         2,
+	StereoSeparation: 50, // 50%
+	ITEnableNNA:      true,
+	Profile:          play.ProfileAuto,
+	Oversample:       1,
+	Normalize:        play.NormalizeOff,
+})
+
+func init() {
+	if err := analyzeFlags.Overlay(config.StandardOverlays...).Update(analyzeCmd); err != nil {
+		panic(err)
+	}
+
+	if err := logger.Overlay(config.StandardOverlays...).Update(analyzeCmd); err != nil {
+		panic(err)
+	}
+
+	registerPlayFlags(analyzeCmd)
+
+	rootCmd.AddCommand(analyzeCmd)
+}
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze [flags] <file(s)>",
+	Short: "Report the levels of tracked music files, and where they clip",
+	Long: `Render one or more tracked music file(s) offline, as they would be played - with the channel mix,
+effects and loudness normalization given - and report their peak and RMS levels, integrated loudness,
+loudness range, DC offset, leading and trailing silence, true duration and the clipped samples, along
+with the order and row each of them is in. Loop settings are ignored, so each song is played through once.
+
+Levels are relative to full scale. Silence is audio that holds still to within -60dB, even if it's
+held away from zero. Songs are rendered at the sample rate and stereo separation given, and in stereo
+when more than 4 channels are asked for, as they are before they're upmixed for playback.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := analyzeFlags.Get().Format
+		switch format {
+		case "human", "csv", "json":
+		default:
+			return fmt.Errorf("unknown format %q - must be one of {human, csv, json}", format)
+		}
+		if err := oversample.Validate(analyzeFlags.Get().Oversample); err != nil {
+			return err
+		}
+		if err := play.ValidateProfile(analyzeFlags.Get().Profile); err != nil {
+			return err
+		}
+
+		log := logger.Get()
+		if format != "human" {
+			// keep the report on stdout readable by whatever it's piped to
+			log.Writer = os.Stderr
+		}
+
+		pl, err := getPlaylist(args)
+		if err != nil {
+			return err
+		}
+
+		flags := analyzeFlags.Get()
+		settings := play.Settings{
+			ITEnableNNA: flags.ITEnableNNA,
+			Profile:     flags.Profile,
+			Oversample:  flags.Oversample,
+			Normalize:   flags.Normalize,
+		}
+		cfg := play.AnalyzeSettings{
+			SampleRate:       flags.SampleRate,
+			Channels:         output.GetRenderChannels(flags.Channels),
+			StereoSeparation: flags.StereoSeparation,
+		}
+		features := []feature.Feature{
+			feature.UseNativeSampleFormat(!playFlags.Get().DisableNativeSamples),
+		}
+
+		results, err := play.Analyze(pl, features, &settings, cfg, log)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case "json":
+			list := []map[string]any{}
+			for _, r := range results {
+				list = append(list, analysisSerialized(r))
+			}
+			return json.NewEncoder(os.Stdout).Encode(list)
+		case "csv":
+			return analyzeCSV(results)
+		default:
+			return analyzeHuman(results)
+		}
+	},
+}
+
+func analysisSerialized(r play.Analysis) map[string]any {
+	offsets := []float64{}
+	for _, o := range r.DCOffset {
+		offsets = append(offsets, roundTo(o, 6))
+	}
+
+	clips := []map[string]any{}
+	for _, c := range r.Clips {
+		clips = append(clips, map[string]any{
+			"order":   c.Order,
+			"row":     c.Row,
+			"samples": c.Samples,
+		})
+	}
+
+	return map[string]any{
+		"file":              r.Entry.Filepath,
+		"title":             r.Title,
+		"gain_db":           roundTo(r.Gain, 2),
+		"duration":          roundTo(r.Duration.Seconds(), 3),
+		"peak_dbfs":         levelDB(r.Peak),
+		"true_peak_dbfs":    levelDB(r.TruePeak),
+		"rms_dbfs":          levelDB(r.RMS),
+		"loudness_lufs":     finiteOrNil(r.Loudness),
+		"loudness_range_lu": roundTo(r.LoudnessRange, 2),
+		"dc_offset":         offsets,
+		"clipped_samples":   r.Clipped,
+		"clips":             clips,
+		"leading_silence":   roundTo(r.LeadingSilence.Seconds(), 3),
+		"trailing_silence":  roundTo(r.TrailingSilence.Seconds(), 3),
+	}
+}
+
+func analyzeCSV(results []play.Analysis) error {
+	fieldOrder := []string{"file", "title", "gain_db", "duration", "peak_dbfs", "true_peak_dbfs", "rms_dbfs", "loudness_lufs", "loudness_range_lu", "dc_offset", "clipped_samples", "clips", "leading_silence", "trailing_silence"}
+	cw := csv.NewWriter(os.Stdout)
+	if analyzeFlags.Get().AddHeader {
+		if err := cw.Write(fieldOrder); err != nil {
+			return err
+		}
+	}
+	for _, r := range results {
+		vals := analysisSerialized(r)
+		var fields []string
+		for _, f := range fieldOrder {
+			switch v := vals[f].(type) {
+			case nil:
+				fields = append(fields, "")
+			case []float64:
+				var offsets []string
+				for _, o := range v {
+					offsets = append(offsets, fmt.Sprint(o))
+				}
+				fields = append(fields, strings.Join(offsets, ";"))
+			case []map[string]any:
+				var clips []string
+				for _, c := range v {
+					clips = append(clips, fmt.Sprintf("%d:%d=%d", c["order"], c["row"], c["samples"]))
+				}
+				fields = append(fields, strings.Join(clips, ";"))
+			default:
+				fields = append(fields, fmt.Sprint(v))
+			}
+		}
+		if err := cw.Write(fields); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func analyzeHuman(results []play.Analysis) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	for i, r := range results {
+		if i != 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%s)\n", r.Title, r.Entry.Filepath)
+		fmt.Fprintf(tw, "  Duration:\t%s\n", r.Duration.Round(time.Millisecond))
+		if r.Gain != 0 {
+			fmt.Fprintf(tw, "  Gain:\t%+.1f dB\n", r.Gain)
+		}
+		fmt.Fprintf(tw, "  Peak:\t%s\n", humanDB(r.Peak, "dBFS"))
+		fmt.Fprintf(tw, "  True peak:\t%s\n", humanDB(r.TruePeak, "dBFS"))
+		fmt.Fprintf(tw, "  RMS:\t%s\n", humanDB(r.RMS, "dBFS"))
+		if math.IsInf(r.Loudness, -1) {
+			fmt.Fprintf(tw, "  Loudness:\tsilent\n")
+		} else {
+			fmt.Fprintf(tw, "  Loudness:\t%.1f LUFS\n", r.Loudness)
+		}
+		fmt.Fprintf(tw, "  Loudness range:\t%.1f LU\n", r.LoudnessRange)
+		var offsets []string
+		for _, o := range r.DCOffset {
+			offsets = append(offsets, fmt.Sprintf("%+.4f", o))
+		}
+		fmt.Fprintf(tw, "  DC offset:\t%s\n", strings.Join(offsets, ", "))
+		fmt.Fprintf(tw, "  Leading silence:\t%s\n", r.LeadingSilence.Round(time.Millisecond))
+		fmt.Fprintf(tw, "  Trailing silence:\t%s\n", r.TrailingSilence.Round(time.Millisecond))
+		fmt.Fprintf(tw, "  Clipped samples:\t%d\n", r.Clipped)
+		if len(r.Clips) > 0 {
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			fmt.Fprintln(tw, "    Order\tRow\tSamples")
+			for _, c := range r.Clips {
+				fmt.Fprintf(tw, "    %d\t%d\t%d\n", c.Order, c.Row, c.Samples)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// levelDB returns the level relative to full scale in decibels, or nil if it's silent
+func levelDB(v float64) any {
+	if v <= 0 {
+		return nil
+	}
+	return roundTo(20*math.Log10(v), 2)
+}
+
+func finiteOrNil(v float64) any {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil
+	}
+	return roundTo(v, 2)
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+func humanDB(v float64, unit string) string {
+	if v <= 0 {
+		return "silent"
+	}
+	return fmt.Sprintf("%.1f %s", 20*math.Log10(v), unit)
+}
@@ -0,0 +1,309 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/config"
+	"github.com/gotracker/gotracker/internal/daemon"
+	"github.com/gotracker/gotracker/internal/play"
+)
+
+// persistent flags
+type ctlFlagCfg struct {
+	JSON bool `pflag:"json" usage:"print the daemon's response as JSON"`
+}
+
+var ctlFlags = config.NewConfig(ctlFlagCfg{})
+
+// ctlTimeout is how long to wait for the daemon to answer a command
+const ctlTimeout = 10 * time.Second
+
+type ctlCommand struct {
+	use   string
+	short string
+	args  cobra.PositionalArgs
+	build func(args []string) (daemon.Request, error)
+}
+
+var ctlCommands = []ctlCommand{
+	{
+		use:   "enqueue <file(s)>",
+		short: "Add files (or playlists) to the end of the daemon's playlist",
+		args:  cobra.MinimumNArgs(1),
+		build: func(args []string) (daemon.Request, error) {
+			req := daemon.Request{
+				Command: daemon.CommandEnqueue,
+			}
+			// the daemon has its own working directory
+			for _, fn := range args {
+				abs, err := filepath.Abs(fn)
+				if err != nil {
+					return req, err
+				}
+				req.Files = append(req.Files, abs)
+			}
+			return req, nil
+		},
+	},
+	{
+		use:   "play [index]",
+		short: "Start playback, or play the song at an index of the playlist",
+		args:  cobra.MaximumNArgs(1),
+		build: func(args []string) (daemon.Request, error) {
+			req := daemon.Request{
+				Command: daemon.CommandPlay,
+			}
+			if len(args) > 0 {
+				index, err := strconv.Atoi(args[0])
+				if err != nil {
+					return req, fmt.Errorf("invalid index %q: %w", args[0], err)
+				}
+				req.Index = &index
+			}
+			return req, nil
+		},
+	},
+	{use: "pause", short: "Pause playback", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandPause)},
+	{use: "resume", short: "Resume playback", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandResume)},
+	{use: "stop", short: "Stop playback", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandStop)},
+	{use: "next", short: "Play the next song", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandNext)},
+	{use: "previous", short: "Play the previous song", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandPrevious)},
+	{
+		use:   "seek <order> [row]",
+		short: "Move playback of the current song to an order (and row)",
+		args:  cobra.RangeArgs(1, 2),
+		build: func(args []string) (daemon.Request, error) {
+			req := daemon.Request{
+				Command: daemon.CommandSeek,
+			}
+			var err error
+			if req.Order, err = strconv.Atoi(args[0]); err != nil {
+				return req, fmt.Errorf("invalid order %q: %w", args[0], err)
+			}
+			if len(args) > 1 {
+				if req.Row, err = strconv.Atoi(args[1]); err != nil {
+					return req, fmt.Errorf("invalid row %q: %w", args[1], err)
+				}
+			}
+			return req, nil
+		},
+	},
+	{
+		use:   "volume <0-100>",
+		short: "Set the volume",
+		args:  cobra.ExactArgs(1),
+		build: func(args []string) (daemon.Request, error) {
+			req := daemon.Request{
+				Command: daemon.CommandVolume,
+			}
+			var err error
+			if req.Volume, err = strconv.Atoi(args[0]); err != nil {
+				return req, fmt.Errorf("invalid volume %q: %w", args[0], err)
+			}
+			return req, nil
+		},
+	},
+	{use: "mute <channels>", short: "Mute channels (e.g.: 1,4-6) of the current song", args: cobra.ExactArgs(1), build: channelCtlRequest(daemon.CommandMute)},
+	{use: "unmute <channels>", short: "Unmute channels of the current song", args: cobra.ExactArgs(1), build: channelCtlRequest(daemon.CommandUnmute)},
+	{use: "solo <channels>", short: "Solo channels of the current song", args: cobra.ExactArgs(1), build: channelCtlRequest(daemon.CommandSolo)},
+	{use: "unsolo <channels>", short: "Take channels of the current song out of the solo", args: cobra.ExactArgs(1), build: channelCtlRequest(daemon.CommandUnsolo)},
+	{
+		use:   "gain <channels> <gain>",
+		short: "Set the gain of channels of the current song (e.g.: 2 -- -6dB, as a negative gain follows --)",
+		args:  cobra.ExactArgs(2),
+		build: func(args []string) (daemon.Request, error) {
+			req, err := channelCtlRequest(daemon.CommandGain)(args[:1])
+			if err != nil {
+				return req, err
+			}
+			req.Gain, err = play.ParseGain(args[1])
+			return req, err
+		},
+	},
+	{
+		use:   "speed <speed> [mode]",
+		short: "Set the speed of the current song, relative to its own tempo (e.g.: 0.8), and how it changes the song {tempo, resample}",
+		args:  cobra.RangeArgs(1, 2),
+		build: func(args []string) (daemon.Request, error) {
+			req := daemon.Request{
+				Command: daemon.CommandSpeed,
+			}
+			var err error
+			if req.Speed, err = strconv.ParseFloat(args[0], 64); err != nil {
+				return req, fmt.Errorf("invalid speed %q: %w", args[0], err)
+			}
+			if len(args) > 1 {
+				if err := play.ValidateSpeedMode(args[1]); err != nil {
+					return req, err
+				}
+				req.SpeedMode = args[1]
+			}
+			return req, nil
+		},
+	},
+	{
+		use:   "transpose <semitones>",
+		short: "Shift the pitch of the current song (e.g.: 2, or -- -2, as a shift down follows --)",
+		args:  cobra.ExactArgs(1),
+		build: func(args []string) (daemon.Request, error) {
+			req := daemon.Request{
+				Command: daemon.CommandTranspose,
+			}
+			var err error
+			if req.Transpose, err = strconv.ParseFloat(args[0], 64); err != nil {
+				return req, fmt.Errorf("invalid transposition %q: %w", args[0], err)
+			}
+			return req, nil
+		},
+	},
+	{use: "status", short: "Report what the daemon is playing", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandStatus)},
+	{use: "list", short: "List the songs in the daemon's playlist", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandList)},
+	{use: "clear", short: "Stop playback and empty the daemon's playlist", args: cobra.NoArgs, build: simpleCtlRequest(daemon.CommandClear)},
+}
+
+func simpleCtlRequest(command string) func(args []string) (daemon.Request, error) {
+	return func(args []string) (daemon.Request, error) {
+		return daemon.Request{
+			Command: command,
+		}, nil
+	}
+}
+
+func channelCtlRequest(command string) func(args []string) (daemon.Request, error) {
+	return func(args []string) (daemon.Request, error) {
+		channels, err := play.ParseChannelList(args[0])
+		if err != nil {
+			return daemon.Request{}, err
+		}
+		return daemon.Request{
+			Command:  command,
+			Channels: channels,
+		}, nil
+	}
+}
+
+func init() {
+	if err := daemonSocket.Overlay(config.StandardOverlays...).Update(ctlCmd); err != nil {
+		panic(err)
+	}
+
+	if err := ctlFlags.Overlay(config.StandardOverlays...).Update(ctlCmd); err != nil {
+		panic(err)
+	}
+
+	for _, c := range ctlCommands {
+		build := c.build
+		ctlCmd.AddCommand(&cobra.Command{
+			Use:   c.use,
+			Short: c.short,
+			Args:  c.args,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				// failures past this point are the daemon's answer, not a misuse of the command
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+
+				req, err := build(args)
+				if err != nil {
+					return err
+				}
+				return runCtl(req)
+			},
+		})
+	}
+
+	rootCmd.AddCommand(ctlCmd)
+}
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl <command>",
+	Short: "Control a running gotracker daemon",
+	Long:  "Send a command to a player started with `gotracker daemon`.",
+}
+
+func runCtl(req daemon.Request) error {
+	resp, err := daemon.Send(daemonSocket.Get().Socket, req, ctlTimeout)
+	if err != nil {
+		return err
+	}
+
+	if ctlFlags.Get().JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	if req.Command == daemon.CommandList {
+		for i, song := range resp.Songs {
+			fmt.Printf("%3d: %s\n", i, ctlSongName(song.File, song.Title, song.Artist))
+		}
+		return nil
+	}
+
+	if resp.Status != nil {
+		printCtlStatus(resp.Status)
+	}
+	return nil
+}
+
+func printCtlStatus(s *play.Status) {
+	if s.Song == nil {
+		fmt.Printf("%s - %d song(s) in the playlist - volume %d%%\n", s.State, s.Length, s.Volume)
+		return
+	}
+
+	song := s.Song
+	fmt.Printf("%s [%d/%d] %s\n", s.State, s.Index+1, s.Length, ctlSongName(song.Filepath, song.Title, song.Artist))
+	elapsed := time.Duration(song.Elapsed * float64(time.Second))
+	fmt.Printf("order %d/%d row %d - %d:%02d - volume %d%%\n", song.Order, song.Orders, song.Row,
+		int(elapsed.Minutes()), int(elapsed.Seconds())%60, s.Volume)
+	if len(song.Muted) > 0 || len(song.Soloed) > 0 || len(song.Gain) > 0 {
+		fmt.Printf("channels %d - muted %s - soloed %s - gain %s\n", song.Channels,
+			formatCtlChannels(song.Muted), formatCtlChannels(song.Soloed), formatCtlGains(song.Gain))
+	}
+	if song.Speed != 1 || song.Transpose != 0 {
+		fmt.Printf("speed %gx (%s) - transpose %+g semitones\n", song.Speed, song.SpeedMode, song.Transpose)
+	}
+}
+
+func formatCtlChannels(channels []int) string {
+	if len(channels) == 0 {
+		return "none"
+	}
+	s := make([]string, len(channels))
+	for i, ch := range channels {
+		s[i] = strconv.Itoa(ch)
+	}
+	return strings.Join(s, ",")
+}
+
+func formatCtlGains(gains map[int]float64) string {
+	if len(gains) == 0 {
+		return "none"
+	}
+	var s []string
+	for _, ch := range slices.Sorted(maps.Keys(gains)) {
+		s = append(s, fmt.Sprintf("%d=%+gdB", ch, gains[ch]))
+	}
+	return strings.Join(s, ",")
+}
+
+func ctlSongName(file, title, artist string) string {
+	name := title
+	if name == "" {
+		name = filepath.Base(file)
+	}
+	if artist != "" {
+		name += " - " + artist
+	}
+	return name
+}
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/config"
+	"github.com/gotracker/gotracker/internal/daemon"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/playback/player/feature"
+)
+
+// persistent flags
+type daemonSocketCfg struct {
+	Socket string `pflag:"socket" env:"socket" usage:"path of the daemon's control socket"`
+}
+
+var daemonSocket = config.NewConfig(daemonSocketCfg{
+	Socket: daemon.DefaultSocketPath(),
+})
+
+func init() {
+	if err := daemonSocket.Overlay(config.StandardOverlays...).Update(daemonCmd); err != nil {
+		panic(err)
+	}
+
+	if err := playSettings.Overlay(config.StandardOverlays...).Update(daemonCmd); err != nil {
+		panic(err)
+	}
+
+	if err := playOutputSettings.Overlay(config.StandardOverlays...).Update(daemonCmd); err != nil {
+		panic(err)
+	}
+
+	if err := logger.Overlay(config.StandardOverlays...).Update(daemonCmd); err != nil {
+		panic(err)
+	}
+
+	registerPlayFlags(daemonCmd)
+
+	rootCmd.AddCommand(daemonCmd)
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [flags] [file(s)]",
+	Short: "Run a player that is controlled through a socket",
+	Long: `Run a long-lived player that is controlled with ` + "`gotracker ctl`" + ` (or anything that can write
+JSON to a Unix socket). If any files are provided, they are played straight away.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pl := playlist.New()
+		if len(args) > 0 {
+			var err error
+			if pl, err = getPlaylist(args); err != nil {
+				return err
+			}
+		}
+		pl.SetLooping(playFlags.Get().LoopPlaylist)
+
+		features := []feature.Feature{
+			feature.UseNativeSampleFormat(!playFlags.Get().DisableNativeSamples),
+		}
+
+		c := play.NewController(pl, features, playSettings.Get(), *playOutputSettings.Get(), logger.Get())
+
+		srv, err := daemon.Listen(daemonSocket.Get().Socket, c, logger.Get())
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		go func() {
+			if err := srv.Serve(ctx); err != nil {
+				logger.Get().Println(err)
+			}
+		}()
+
+		if pl.Len() > 0 {
+			if err := c.Play(-1); err != nil {
+				return err
+			}
+		}
+
+		logger.Get().Printf("Listening for commands on %s\n", daemonSocket.Get().Socket)
+		if err := c.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	},
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -54,7 +55,7 @@ var (
 				}
 				err = jw.Encode(list)
 			case "csv":
-				fieldOrder := []string{"device", "kind", "priority", "is_default"}
+				fieldOrder := []string{"device", "kind", "priority", "is_default", "options"}
 				cw := csv.NewWriter(os.Stdout)
 				if deviceListAddHeader {
 					if err = cw.Write(fieldOrder); err != nil {
@@ -64,7 +65,20 @@ var (
 				if err = deviceListSerialized(pmap, func(vals map[string]any) error {
 					var fields []string
 					for _, f := range fieldOrder {
-						fields = append(fields, fmt.Sprint(vals[f]))
+						switch v := vals[f].(type) {
+						case []map[string]any:
+							var opts []string
+							for _, o := range v {
+								if def := o["default"].(string); def != "" {
+									opts = append(opts, fmt.Sprintf("%s=%s", o["name"], def))
+								} else {
+									opts = append(opts, o["name"].(string))
+								}
+							}
+							fields = append(fields, strings.Join(opts, ";"))
+						default:
+							fields = append(fields, fmt.Sprint(v))
+						}
 					}
 					return cw.Write(fields)
 				}); err != nil {
@@ -93,6 +107,8 @@ func deviceListSerialized(pmap []map[string]output.DeviceInfo, recordFunc record
 				kind = "sound-card"
 			case deviceCommon.KindFile:
 				kind = "file-writer"
+			case deviceCommon.KindNetwork:
+				kind = "network-stream"
 			default:
 				kind = "unknown"
 			}
@@ -101,6 +117,13 @@ func deviceListSerialized(pmap []map[string]output.DeviceInfo, recordFunc record
 			vals["kind"] = kind
 			vals["priority"] = v.Priority
 			vals["is_default"] = (k == output.DefaultOutputDeviceName)
+			vals["options"] = deviceListOptions(v.Options)
+			vals["capabilities"] = deviceListCapabilities(v.Capabilities)
+			if sinks, err := output.ListDeviceSinks(k); err != nil {
+				vals["sinks_error"] = err.Error()
+			} else if sinks != nil {
+				vals["sinks"] = deviceListSinks(sinks)
+			}
 			if err := recordFunc(vals); err != nil {
 				return err
 			}
@@ -109,6 +132,49 @@ func deviceListSerialized(pmap []map[string]output.DeviceInfo, recordFunc record
 	return nil
 }
 
+func deviceListOptions(specs []deviceCommon.OptionSpec) []map[string]any {
+	opts := []map[string]any{}
+	for _, spec := range specs {
+		opt := make(map[string]any)
+		opt["name"] = spec.Name
+		opt["type"] = spec.Type.String()
+		opt["default"] = spec.Default
+		opt["usage"] = spec.Usage
+		if len(spec.Choices) > 0 {
+			opt["choices"] = spec.Choices
+		}
+		if min, ok := spec.Min.Get(); ok {
+			opt["min"] = min
+		}
+		if max, ok := spec.Max.Get(); ok {
+			opt["max"] = max
+		}
+		opts = append(opts, opt)
+	}
+	return opts
+}
+
+func deviceListCapabilities(caps deviceCommon.Capabilities) map[string]any {
+	return map[string]any{
+		"sample_rate_min": caps.MinSampleRate,
+		"sample_rate_max": caps.MaxSampleRate,
+		"bits_per_sample": caps.BitsPerSample,
+		"channels":        caps.Channels,
+	}
+}
+
+func deviceListSinks(sinks []deviceCommon.Sink) []map[string]any {
+	list := []map[string]any{}
+	for _, sink := range sinks {
+		list = append(list, map[string]any{
+			"id":          sink.ID,
+			"description": sink.Description,
+			"default":     sink.Default,
+		})
+	}
+	return list
+}
+
 func deviceListHuman(pmap []map[string]output.DeviceInfo) error {
 	if len(pmap) == 0 {
 		fmt.Println("no valid devices to list!")
@@ -123,6 +189,7 @@ func deviceListHuman(pmap []map[string]output.DeviceInfo) error {
 		fmt.Fprintln(tw, "DEVICE\tKind\tPriority\tDefault?")
 		fmt.Fprintln(tw, "======\t====\t========\t========")
 	}
+	var optionLists []map[string]any
 	if err := deviceListSerialized(pmap, func(vals map[string]any) error {
 		name := vals["device"].(string)
 		kind := vals["kind"].(string)
@@ -131,6 +198,7 @@ func deviceListHuman(pmap []map[string]output.DeviceInfo) error {
 		if vals["is_default"].(bool) {
 			defaultStr = "*"
 		}
+		optionLists = append(optionLists, vals)
 		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", name, kind, priority, defaultStr)
 		return err
 	}); err != nil {
@@ -138,5 +206,45 @@ func deviceListHuman(pmap []map[string]output.DeviceInfo) error {
 	}
 	fmt.Fprintln(tw)
 
-	return tw.Flush()
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println("Device options (e.g.: -O \"device[:filepath]?option=value&option=value\"):")
+	for _, vals := range optionLists {
+		fmt.Println()
+		fmt.Printf("%s:\n", vals["device"])
+		caps := vals["capabilities"].(map[string]any)
+		fmt.Printf("  formats: %d-%dHz, bits per sample %v, channels %v\n", caps["sample_rate_min"], caps["sample_rate_max"], caps["bits_per_sample"], caps["channels"])
+		if sinksErr, ok := vals["sinks_error"]; ok {
+			fmt.Printf("  sinks: unavailable (%s)\n", sinksErr)
+		} else if sinks, ok := vals["sinks"].([]map[string]any); ok {
+			fmt.Println("  sinks:")
+			for _, sink := range sinks {
+				var defaultStr string
+				if sink["default"].(bool) {
+					defaultStr = " *"
+				}
+				fmt.Fprintf(tw, "    %s%s\t%s\n", sink["id"], defaultStr, sink["description"])
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+		for _, opt := range vals["options"].([]map[string]any) {
+			desc := fmt.Sprintf("%s (%s)", opt["name"], opt["type"])
+			if def := opt["default"].(string); def != "" {
+				desc += fmt.Sprintf(" [default: %s]", def)
+			}
+			if choices, ok := opt["choices"].([]string); ok {
+				desc += fmt.Sprintf(" {%s}", strings.Join(choices, ", "))
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", desc, opt["usage"])
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
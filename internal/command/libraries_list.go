@@ -32,6 +32,12 @@ var librariesList = []libraryInfo{
 		License:  "BSD-3-Clause",
 		Homepage: "",
 	},
+	{
+		Name:     "x/term",
+		Package:  "golang.org/x/term",
+		License:  "BSD-3-Clause",
+		Homepage: "",
+	},
 	{
 		Name:     "yaml",
 		Package:  "gopkg.in/yaml.v2",
@@ -116,6 +122,18 @@ var librariesList = []libraryInfo{
 		License:  "Apache-2.0",
 		Homepage: "https://github.com/spf13/cobra",
 	},
+	{
+		Name:     "Gorilla WebSocket",
+		Package:  "github.com/gorilla/websocket",
+		License:  "BSD-2-Clause",
+		Homepage: "https://github.com/gorilla/websocket",
+	},
+	{
+		Name:     "tcell",
+		Package:  "github.com/gdamore/tcell/v2",
+		License:  "Apache-2.0",
+		Homepage: "https://github.com/gdamore/tcell",
+	},
 }
 
 func init() {
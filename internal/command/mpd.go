@@ -0,0 +1,96 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/config"
+	"github.com/gotracker/gotracker/internal/mpd"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/playback/player/feature"
+)
+
+// flags
+type mpdFlagCfg struct {
+	Listen string `flag:"listen" env:"mpd_listen" usage:"address to listen for MPD clients on"`
+}
+
+var mpdFlags = config.NewConfig(mpdFlagCfg{
+	Listen: "127.0.0.1:6600",
+})
+
+func init() {
+	if err := mpdFlags.Overlay(config.StandardOverlays...).Update(mpdCmd); err != nil {
+		panic(err)
+	}
+
+	if err := playSettings.Overlay(config.StandardOverlays...).Update(mpdCmd); err != nil {
+		panic(err)
+	}
+
+	if err := playOutputSettings.Overlay(config.StandardOverlays...).Update(mpdCmd); err != nil {
+		panic(err)
+	}
+
+	if err := logger.Overlay(config.StandardOverlays...).Update(mpdCmd); err != nil {
+		panic(err)
+	}
+
+	registerPlayFlags(mpdCmd)
+
+	rootCmd.AddCommand(mpdCmd)
+}
+
+var mpdCmd = &cobra.Command{
+	Use:   "mpd [flags] <music directory>",
+	Short: "Run a player that is controlled by MPD clients",
+	Long: `Run a player that speaks (a subset of) the Music Player Daemon protocol, so that MPD clients
+can browse the modules in the music directory and control their playback.
+
+The supported commands are status, currentsong, play, playid, pause, stop, next, previous, seek,
+seekid, seekcur, add, addid, clear, playlistinfo, playlistid, lsinfo, setvol, getvol and idle,
+along with command lists. Song durations are measured in the background the first time a song
+is listed, so they can take a moment to appear.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pl := playlist.New()
+		pl.SetLooping(playFlags.Get().LoopPlaylist)
+
+		features := []feature.Feature{
+			feature.UseNativeSampleFormat(!playFlags.Get().DisableNativeSamples),
+		}
+
+		c := play.NewController(pl, features, playSettings.Get(), *playOutputSettings.Get(), logger.Get())
+
+		srv, err := mpd.Listen(mpd.Config{
+			Listen:   mpdFlags.Get().Listen,
+			MusicDir: args[0],
+			Features: features,
+			Settings: playSettings.Get(),
+		}, c, logger.Get())
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		go func() {
+			if err := srv.Serve(ctx); err != nil {
+				logger.Get().Println(err)
+			}
+		}()
+
+		logger.Get().Printf("Listening for MPD clients on %s\n", srv.Addr())
+		if err := c.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	},
+}
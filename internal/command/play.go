@@ -1,12 +1,14 @@
 package command
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"github.com/gotracker/gotracker/internal/config"
+	"github.com/gotracker/gotracker/internal/dsp"
 	"github.com/gotracker/gotracker/internal/logging"
 	"github.com/gotracker/gotracker/internal/output"
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
@@ -20,6 +22,14 @@ var playSettings = config.NewConfig(play.Settings{
 	NumPremixBuffers:    64,
 	ITLongChannelOutput: false,
 	ITEnableNNA:         true,
+	CueSheet:            false,
+	Progress:            play.ProgressText,
+	ProgressFD:          2,
+	Profile:             play.ProfileAuto,
+	Oversample:          1,
+	Normalize:           play.NormalizeOff,
+	Speed:               1,
+	SpeedMode:           play.SpeedModeTempo,
 })
 
 var playOutputSettings = config.NewConfig(deviceCommon.Settings{
@@ -27,19 +37,26 @@ var playOutputSettings = config.NewConfig(deviceCommon.Settings{
 	SamplesPerSecond: 44100,
 	BitsPerSample:    16,
 	StereoSeparation: 50, // 50%
+	Upmix:            "matrix",
+	Dither:           "none",
 	Filepath:         "output.wav",
+	FileFormat:       "wav",
 })
 
 // flags
 type playFlagCfg struct {
-	LoopSong             bool `flag:"loop-song" env:"loop_song" f:"l" usage:"enable pattern loop (only works in single-song mode)"`
-	StartingOrder        int  `flag:"starting-order" env:"starting_order" f:"o" usage:"starting order (<0 = use song/format default)"`
-	StartingRow          int  `flag:"starting-row" env:"starting_row" f:"r" usage:"starting row (<0 = use song/format default)"`
-	Randomized           bool `flag:"random" env:"random" f:"R" usage:"randomize the playlist"`
-	StartingBPM          int  `flag:"bpm" env:"bpm" usage:"starting BPM (<0 = use song/format default)"`
-	StartingTempo        int  `flag:"tempo" env:"tempo" usage:"starting Tempo (ticks per row) (<0 = use song/format default)"`
-	LoopPlaylist         bool `pflag:"loop-playlist" env:"loop_playlist" pf:"L" usage:"enable playlist loop (only useful in multi-song mode)"`
-	DisableNativeSamples bool `pflag:"disable-native-samples" env:"disable_native_samples" usage:"disable preconversion of samples to native sampling format"`
+	LoopSong             bool     `flag:"loop-song" env:"loop_song" f:"l" usage:"enable pattern loop (only works in single-song mode)"`
+	StartingOrder        int      `flag:"starting-order" env:"starting_order" f:"o" usage:"starting order (<0 = use song/format default)"`
+	StartingRow          int      `flag:"starting-row" env:"starting_row" f:"r" usage:"starting row (<0 = use song/format default)"`
+	Randomized           bool     `flag:"random" env:"random" f:"R" usage:"randomize the playlist"`
+	StartingBPM          int      `flag:"bpm" env:"bpm" usage:"starting BPM (<0 = use song/format default)"`
+	StartingTempo        int      `flag:"tempo" env:"tempo" usage:"starting Tempo (ticks per row) (<0 = use song/format default)"`
+	LoopPlaylist         bool     `pflag:"loop-playlist" env:"loop_playlist" pf:"L" usage:"enable playlist loop (only useful in multi-song mode)"`
+	DisableNativeSamples bool     `pflag:"disable-native-samples" env:"disable_native_samples" usage:"disable preconversion of samples to native sampling format"`
+	Mute                 string   `flag:"mute" env:"mute" usage:"channels to silence, numbered from 1 (e.g.: 1,4-6) - entries of a playlist file may set their own"`
+	Solo                 string   `flag:"solo" env:"solo" usage:"channels to hear, silencing the rest (e.g.: 3) - entries of a playlist file may set their own"`
+	ChannelGain          []string `flag:"channel-gain" env:"channel_gain" usage:"gain of a channel, as channel=gain (e.g.: 2=-6dB) - entries of a playlist file may set their own"`
+	DSP                  string   `flag:"dsp" env:"dsp" usage:"chain of effects to process the audio with, and their options (e.g.: eq:low=+3,reverb:mix=0.2) {a500, a1200, bass, crossfeed, dcblock, eq, limiter, reverb}"`
 	//DisablePreconvertSamples bool `pflag:"disable-preconvert-samples" env:"disable_preconvert_samples" usage:"disable preconversion of samples to 32-bit floats"`
 }
 
@@ -62,8 +79,6 @@ var logger = config.NewConfig(logging.Squelchable{
 func init() {
 	output.Setup()
 
-	playOutputSettings.Get().Name = output.DefaultOutputDeviceName
-
 	if err := playSettings.Overlay(config.StandardOverlays...).Update(playCmd); err != nil {
 		panic(err)
 	}
@@ -122,6 +137,9 @@ func getPlaylist(args []string) (*playlist.Playlist, error) {
 	if len(args) == 1 {
 		pl, err := getPlaylistFromYaml(args[0])
 		if err == nil && pl != nil {
+			if err := applyEntryDefaults(pl); err != nil {
+				return nil, err
+			}
 			return pl, nil
 		}
 	}
@@ -144,8 +162,48 @@ func getPlaylistFromYaml(fn string) (*playlist.Playlist, error) {
 	return pl, nil
 }
 
+// applyEntryDefaults gives the entries of a playlist file the channel mix and effects of the
+// command line, for whichever of the mute, solo, channel gain and dsp they don't set themselves.
+// The effects of each entry are checked here, so a bad chain fails before anything is played.
+func applyEntryDefaults(pl *playlist.Playlist) error {
+	cfg := playFlags.Get()
+	if _, err := play.ParseChannelMix(cfg.Mute, cfg.Solo, cfg.ChannelGain); err != nil {
+		return err
+	}
+	if err := dsp.Validate(cfg.DSP); err != nil {
+		return fmt.Errorf("invalid dsp: %w", err)
+	}
+
+	for i := range pl.Len() {
+		song := pl.GetSong(i)
+		if song.Mute == "" {
+			song.Mute = cfg.Mute
+		}
+		if song.Solo == "" {
+			song.Solo = cfg.Solo
+		}
+		if len(song.ChannelGain) == 0 {
+			song.ChannelGain = cfg.ChannelGain
+		}
+		if song.DSP == "" {
+			song.DSP = cfg.DSP
+		}
+		if err := dsp.Validate(song.DSP); err != nil {
+			return fmt.Errorf("%s: invalid dsp: %w", song.Filepath, err)
+		}
+	}
+	return nil
+}
+
 func getPlaylistFromArgList(args []string) (*playlist.Playlist, error) {
 	cfg := playFlags.Get()
+	if _, err := play.ParseChannelMix(cfg.Mute, cfg.Solo, cfg.ChannelGain); err != nil {
+		return nil, err
+	}
+	if err := dsp.Validate(cfg.DSP); err != nil {
+		return nil, fmt.Errorf("invalid dsp: %w", err)
+	}
+
 	pl := playlist.New()
 	for _, fn := range args {
 		song := playlist.Song{
@@ -163,6 +221,10 @@ func getPlaylistFromArgList(args []string) (*playlist.Playlist, error) {
 		if cfg.StartingTempo >= 0 {
 			song.Tempo.Set(cfg.StartingTempo)
 		}
+		song.Mute = cfg.Mute
+		song.Solo = cfg.Solo
+		song.ChannelGain = cfg.ChannelGain
+		song.DSP = cfg.DSP
 		if len(args) == 1 {
 			if cfg.LoopSong {
 				song.Loop.Count = playlist.NewLoopForever()
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/config"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/renderserver"
+	"github.com/gotracker/playback/player/feature"
+)
+
+// flags
+type renderServerFlagCfg struct {
+	Listen        string `flag:"listen" env:"render_listen" usage:"address to listen for render requests on"`
+	Workers       int    `flag:"workers" env:"render_workers" usage:"maximum number of renders to run at once - further requests wait their turn"`
+	MaxUploadSize int64  `flag:"max-upload-size" env:"render_max_upload_size" usage:"maximum size (in bytes) of a render request"`
+}
+
+var renderServerFlags = config.NewConfig(renderServerFlagCfg{
+	Listen:        "127.0.0.1:8080",
+	Workers:       runtime.NumCPU(),
+	MaxUploadSize: 64 * 1024 * 1024,
+})
+
+func init() {
+	if err := renderServerFlags.Overlay(config.StandardOverlays...).Update(renderServerCmd); err != nil {
+		panic(err)
+	}
+
+	if err := logger.Overlay(config.StandardOverlays...).Update(renderServerCmd); err != nil {
+		panic(err)
+	}
+
+	rootCmd.AddCommand(renderServerCmd)
+}
+
+var renderServerCmd = &cobra.Command{
+	Use:   "render-server [flags]",
+	Short: "Run an HTTP service that renders tracked music on demand",
+	Long: `Run an HTTP service that renders tracked music on demand.
+
+POST a module to /render - either as the request body, or as one or more "module" files in a
+multipart form, optionally with a "playlist" YAML file that refers to them by name. The rendered
+audio is streamed back as it is produced. Render settings are passed as query parameters (or
+form fields): format (wav, flac), sample-rate, channels, bits-per-sample, stereo-separation,
+upmix, dither, oversample, mix-profile, speed, transpose, speed-mode, start-order, start-row,
+end-order and end-row.
+
+Renders that would exceed the worker limit wait their turn, and a render is cancelled as soon as
+its client disconnects. GET /status reports the number of active and queued renders.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := renderServerFlags.Get()
+
+		srv, err := renderserver.New(renderserver.Config{
+			Listen:        cfg.Listen,
+			Workers:       cfg.Workers,
+			MaxUploadSize: cfg.MaxUploadSize,
+			Features: []feature.Feature{
+				feature.UseNativeSampleFormat(true),
+			},
+			Settings: play.Settings{
+				NumPremixBuffers: 64,
+				ITEnableNNA:      true,
+				Profile:          play.ProfileAuto,
+				Oversample:       1,
+				Speed:            1,
+				SpeedMode:        play.SpeedModeTempo,
+			},
+			Output: deviceCommon.Settings{
+				Channels:         2,
+				SamplesPerSecond: 44100,
+				BitsPerSample:    16,
+				StereoSeparation: 50, // 50%
+				Upmix:            "matrix",
+				Dither:           "none",
+			},
+		}, logger.Get())
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdownCtx) // lint
+		}()
+
+		logger.Get().Printf("Listening for render requests on %s\n", srv.Addr())
+		return srv.Serve()
+	},
+}
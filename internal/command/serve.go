@@ -0,0 +1,82 @@
+package command
+
+import (
+	"net/url"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/config"
+)
+
+// flags
+type serveFlagCfg struct {
+	Listen string `flag:"listen" env:"listen" usage:"address to listen for listeners on"`
+	Name   string `flag:"name" env:"stream_name" usage:"name of the stream, reported to listeners"`
+}
+
+var serveFlags = config.NewConfig(serveFlagCfg{
+	Listen: ":8000",
+	Name:   "gotracker",
+})
+
+func init() {
+	if err := serveFlags.Overlay(config.StandardOverlays...).Update(serveCmd); err != nil {
+		panic(err)
+	}
+
+	if err := playSettings.Overlay(config.StandardOverlays...).Update(serveCmd); err != nil {
+		panic(err)
+	}
+
+	if err := playOutputSettings.Overlay(config.StandardOverlays...).Update(serveCmd); err != nil {
+		panic(err)
+	}
+
+	if err := logger.Overlay(config.StandardOverlays...).Update(serveCmd); err != nil {
+		panic(err)
+	}
+
+	registerPlayFlags(serveCmd)
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [flags] <file(s)>",
+	Short: "Stream tracked music files over HTTP",
+	Long: `Continuously play one or more tracked music file(s) as an HTTP audio stream.
+Any number of listeners can tune in at http://<listen>/ - late joiners hear the stream from its live position.
+The stream is available at /stream.wav (and /stream.flac in builds with FLAC support) and the
+current song is reported through ICY metadata and the /status endpoint.
+Any devices specified with --output are played to alongside the stream.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pl, err := getPlaylist(args)
+		if err != nil {
+			return err
+		}
+
+		// it's a radio - it never stops
+		pl.SetLooping(true)
+
+		cfg := serveFlags.Get()
+		opts := url.Values{
+			"listen": {cfg.Listen},
+			"name":   {cfg.Name},
+		}
+
+		outCfg := playOutputSettings.Get()
+		outCfg.Outputs = append([]string{"http?" + opts.Encode()}, outCfg.Outputs...)
+
+		playedAtLeastOne, err := playSongs(pl)
+		if err != nil {
+			return err
+		}
+
+		if !playedAtLeastOne {
+			return cmd.Usage()
+		}
+
+		return nil
+	},
+}
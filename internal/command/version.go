@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+
+	"github.com/gotracker/gotracker/internal/oversample"
 )
 
 func init() {
@@ -22,6 +24,7 @@ var (
 		Long:  `All software has versions. This is Gotracker's`,
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Printf("Gotracker %s -- %s\n", Version, GitHash)
+			fmt.Printf("Resampling: linear interpolation, oversampled 1x to %dx (--oversample)\n", oversample.MaxFactor)
 		},
 	}
 )
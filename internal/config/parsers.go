@@ -51,6 +51,8 @@ func setValueToField(f reflect.Value, val string) error {
 		var iv uint64
 		iv, err = strconv.ParseUint(val, 0, 0)
 		*v = uint(iv)
+	case *float64:
+		*v, err = strconv.ParseFloat(val, 64)
 	case *string:
 		*v = val
 	case *[]bool:
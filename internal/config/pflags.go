@@ -72,6 +72,8 @@ func (pflags) Update(cfg, param any) error {
 			fs.Uint8VarP(v, name, shorthand, *v, usage)
 		case *uint:
 			fs.UintVarP(v, name, shorthand, *v, usage)
+		case *float64:
+			fs.Float64VarP(v, name, shorthand, *v, usage)
 		case *string:
 			fs.StringVarP(v, name, shorthand, *v, usage)
 		case *[]bool:
@@ -83,7 +85,8 @@ func (pflags) Update(cfg, param any) error {
 		case *[]int:
 			fs.IntSliceVarP(v, name, shorthand, *v, usage)
 		case *[]string:
-			fs.StringSliceVarP(v, name, shorthand, *v, usage)
+			// each use of the flag is a value of its own, as values such as output specs may hold commas
+			fs.StringArrayVarP(v, name, shorthand, *v, usage)
 		default:
 			err = fmt.Errorf("unhandled type: %T", f.Interface())
 		}
@@ -0,0 +1,60 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSocketPath returns the path of the daemon's socket: gotracker.sock in the user's
+// runtime directory, or a user-specific name in the temporary directory if there isn't one
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gotracker.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gotracker-%d.sock", os.Getuid()))
+}
+
+// Send sends the request to the daemon listening on the socket at the path, returning its response.
+// A response that reports a failure is returned along with its error.
+func Send(path string, req Request, timeout time.Duration) (Response, error) {
+	var resp Response
+
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return resp, fmt.Errorf("could not connect to the daemon (is `gotracker daemon` running?): %w", err)
+	}
+	defer conn.Close()
+
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return resp, err
+		}
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return resp, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return resp, err
+	}
+
+	if !resp.OK {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+// Package daemon implements the command protocol of a long-running player. Commands are
+// sent to the player over a Unix socket as JSON objects, one per line, and each one is
+// answered with a JSON response on a line of its own.
+package daemon
+
+import (
+	"github.com/gotracker/gotracker/internal/play"
+)
+
+// The commands understood by the daemon
+const (
+	CommandEnqueue   = "enqueue"   // add Files to the end of the playlist
+	CommandPlay      = "play"      // play the song at Index, or resume/start playback if it's not set
+	CommandPause     = "pause"     // pause playback
+	CommandResume    = "resume"    // resume playback
+	CommandStop      = "stop"      // stop playback
+	CommandNext      = "next"      // play the next song
+	CommandPrevious  = "previous"  // play the previous song
+	CommandSeek      = "seek"      // move playback of the current song to Order and Row
+	CommandVolume    = "volume"    // set the volume to Volume (0-100)
+	CommandMute      = "mute"      // mute the Channels of the current song
+	CommandUnmute    = "unmute"    // unmute the Channels of the current song
+	CommandSolo      = "solo"      // solo the Channels of the current song
+	CommandUnsolo    = "unsolo"    // take the Channels of the current song out of the solo
+	CommandGain      = "gain"      // set the gain of the Channels of the current song to Gain
+	CommandSpeed     = "speed"     // set the speed of the current song to Speed, changing it as SpeedMode says (if set)
+	CommandTranspose = "transpose" // shift the pitch of the current song by Transpose semitones
+	CommandStatus    = "status"    // report the status
+	CommandList      = "list"      // report the songs in the playlist
+	CommandClear     = "clear"     // stop playback and empty the playlist
+)
+
+// Commands is the list of commands understood by the daemon
+var Commands = []string{
+	CommandEnqueue,
+	CommandPlay,
+	CommandPause,
+	CommandResume,
+	CommandStop,
+	CommandNext,
+	CommandPrevious,
+	CommandSeek,
+	CommandVolume,
+	CommandMute,
+	CommandUnmute,
+	CommandSolo,
+	CommandUnsolo,
+	CommandGain,
+	CommandSpeed,
+	CommandTranspose,
+	CommandStatus,
+	CommandList,
+	CommandClear,
+}
+
+// Request is a command sent to the daemon
+type Request struct {
+	Command string   `json:"command"`
+	Files   []string `json:"files,omitempty"`
+	Index   *int     `json:"index,omitempty"`
+	Order   int      `json:"order,omitempty"`
+	Row     int      `json:"row,omitempty"`
+	Volume  int      `json:"volume,omitempty"`
+	// Channels are numbered from 1
+	Channels []int   `json:"channels,omitempty"`
+	Gain     float64 `json:"gain,omitempty"` // decibels
+	// Speed is relative to the song's own tempo
+	Speed     float64 `json:"speed,omitempty"`
+	SpeedMode string  `json:"speed_mode,omitempty"`
+	Transpose float64 `json:"transpose,omitempty"` // semitones
+}
+
+// Song is an entry of the playlist, as reported by the list command
+type Song struct {
+	File   string `json:"file"`
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+}
+
+// Response is the daemon's answer to a request. The status is included in every successful response.
+type Response struct {
+	OK     bool         `json:"ok"`
+	Error  string       `json:"error,omitempty"`
+	Status *play.Status `json:"status,omitempty"`
+	Songs  []Song       `json:"songs,omitempty"`
+}
@@ -0,0 +1,256 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+// maxRequestSize is the longest request line that will be accepted
+const maxRequestSize = 1024 * 1024
+
+// Server accepts commands for a controller on a Unix socket
+type Server struct {
+	c      *play.Controller
+	ln     net.Listener
+	path   string
+	logger logging.Log
+
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// Listen creates the socket at the path. If a socket is left over from a daemon that is no
+// longer running, it is replaced.
+func Listen(path string, c *play.Controller, logger logging.Log) (*Server, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// only the user running the daemon may control it
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	s := Server{
+		c:      c,
+		ln:     ln,
+		path:   path,
+		logger: logger,
+		conns:  make(map[net.Conn]struct{}),
+	}
+	return &s, nil
+}
+
+// Serve handles connections until the context is done
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.ln.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	defer s.wg.Wait()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxRequestSize)
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var (
+			req  Request
+			resp Response
+		)
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			resp = s.Execute(req)
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Execute runs the command of the request against the controller
+func (s *Server) Execute(req Request) Response {
+	var (
+		resp Response
+		err  error
+	)
+
+	switch req.Command {
+	case CommandEnqueue:
+		err = s.enqueue(req.Files)
+	case CommandPlay:
+		index := -1
+		if req.Index != nil {
+			index = *req.Index
+		}
+		err = s.c.Play(index)
+	case CommandPause:
+		err = s.c.Pause()
+	case CommandResume:
+		err = s.c.Resume()
+	case CommandStop:
+		err = s.c.Stop()
+	case CommandNext:
+		err = s.c.Next()
+	case CommandPrevious:
+		err = s.c.Previous()
+	case CommandSeek:
+		err = s.c.Seek(req.Order, req.Row)
+	case CommandVolume:
+		err = s.c.SetVolume(req.Volume)
+	case CommandMute, CommandUnmute:
+		err = s.c.SetChannelMute(req.Channels, req.Command == CommandMute)
+	case CommandSolo, CommandUnsolo:
+		err = s.c.SetChannelSolo(req.Channels, req.Command == CommandSolo)
+	case CommandGain:
+		err = s.c.SetChannelGain(req.Channels, req.Gain)
+	case CommandSpeed:
+		err = s.c.SetSpeed(req.Speed, req.SpeedMode)
+	case CommandTranspose:
+		err = s.c.SetTranspose(req.Transpose)
+	case CommandStatus:
+	case CommandList:
+		for _, song := range s.c.Songs() {
+			resp.Songs = append(resp.Songs, Song{
+				File:   song.Filepath,
+				Title:  song.Title,
+				Artist: song.Artist,
+			})
+		}
+	case CommandClear:
+		err = s.c.Clear()
+	default:
+		err = fmt.Errorf("unknown command %q - must be one of {%s}", req.Command, strings.Join(Commands, ", "))
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+
+	status := s.c.Status()
+	resp.OK = true
+	resp.Status = &status
+	return resp
+}
+
+// enqueue adds the files to the controller's playlist. Playlist files (.yaml/.yml) have their songs added.
+func (s *Server) enqueue(files []string) error {
+	if len(files) == 0 {
+		return errors.New("no files to enqueue")
+	}
+
+	var songs []playlist.Song
+	for _, fn := range files {
+		if !filepath.IsAbs(fn) {
+			return fmt.Errorf("%q is not an absolute path", fn)
+		}
+
+		if _, err := os.Stat(fn); err != nil {
+			return err
+		}
+
+		switch strings.ToLower(filepath.Ext(fn)) {
+		case ".yaml", ".yml":
+			pl, err := readPlaylist(fn)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < pl.Len(); i++ {
+				songs = append(songs, *pl.GetSong(i))
+			}
+		default:
+			songs = append(songs, playlist.Song{
+				Filepath: fn,
+			})
+		}
+	}
+
+	s.c.Enqueue(songs...)
+	return nil
+}
+
+func readPlaylist(fn string) (*playlist.Playlist, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pl, err := playlist.ReadYAML(f, filepath.Dir(fn))
+	if err != nil {
+		return nil, fmt.Errorf("could not read playlist %q: %w", fn, err)
+	}
+	return pl, nil
+}
+
+// Close removes the socket
+func (s *Server) Close() error {
+	s.ln.Close()
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
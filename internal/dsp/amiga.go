@@ -0,0 +1,64 @@
+package dsp
+
+import "math"
+
+func init() {
+	effects["a500"] = effectDetails{
+		create:  newA500,
+		options: []string{"led"},
+	}
+	effects["a1200"] = effectDetails{
+		create:  newA1200,
+		options: []string{"led"},
+	}
+}
+
+// The filters of the Amiga's audio output, as worked out from the values of the parts on its
+// board. Every model has a high-pass filter to take out the DC offset and a fixed low-pass filter
+// (the A500's is low enough to take the edge off its sound). The "LED" filter, named for the power
+// light that dims when it's on, is a steeper low-pass filter that songs can turn on and off.
+const (
+	amigaHighPassFreq = 5.2     // 1390 ohm, 22uF
+	a500LowPassFreq   = 4420.97 // 360 ohm, 0.1uF
+	a1200LowPassFreq  = 34419.0 // 680 ohm, 6800pF
+	amigaLEDFreq      = 3090.53 // 10k ohm, 10k ohm, 6800pF, 3900pF
+	amigaLEDQ         = 0.660
+)
+
+// newA500 filters the audio as the Amiga 500's output does. The LED filter is held off, unless
+// led=on is given.
+func newA500(o *options, sampleRate, channels int) Processor {
+	return newAmigaFilter(sampleRate, channels, a500LowPassFreq, o.bool("led", false))
+}
+
+// newA1200 filters the audio as the Amiga 1200's output does, which leaves it much brighter than
+// the A500's. The LED filter is held off, unless led=on is given.
+func newA1200(o *options, sampleRate, channels int) Processor {
+	return newAmigaFilter(sampleRate, channels, a1200LowPassFreq, o.bool("led", false))
+}
+
+func newAmigaFilter(sampleRate, channels int, lowPassFreq float64, led bool) Processor {
+	filters := []biquad{
+		onePoleHighPass(sampleRate, amigaHighPassFreq),
+		onePoleLowPass(sampleRate, lowPassFreq),
+	}
+	if led {
+		filters = append(filters, lowPass(sampleRate, amigaLEDFreq, amigaLEDQ))
+	}
+	return newFilterBank(filters, channels)
+}
+
+// onePoleLowPass is the low-pass filter of a resistor and a capacitor, falling away by 6dB an
+// octave above the frequency. It stays stable above the Nyquist frequency, where it does less and
+// less, as the filter would.
+func onePoleLowPass(sampleRate int, freq float64) biquad {
+	a := 1 - math.Exp(-2*math.Pi*freq/float64(sampleRate))
+	return newBiquad(a, 0, 0, 1, a-1, 0)
+}
+
+// onePoleHighPass is the high-pass filter of a resistor and a capacitor, falling away by 6dB an
+// octave below the frequency
+func onePoleHighPass(sampleRate int, freq float64) biquad {
+	r := math.Exp(-2 * math.Pi * freq / float64(sampleRate))
+	return newBiquad(1, -1, 0, 1, -r, 0)
+}
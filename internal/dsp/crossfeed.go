@@ -0,0 +1,49 @@
+package dsp
+
+import "math"
+
+func init() {
+	effects["crossfeed"] = effectDetails{
+		create:  newCrossfeed,
+		options: []string{"level", "freq"},
+	}
+}
+
+// crossfeed blends a little of each side of stereo audio into the other, as a pair of speakers
+// would, so hard-panned channels (which many tracked songs have) are less tiring on headphones.
+// Only the low frequencies are fed across, as the head shadows the highs. It leaves audio that
+// isn't stereo alone.
+type crossfeed struct {
+	level  float32
+	norm   float32
+	alpha  float32
+	stereo bool
+	lp     [2]float32 // the low-passed left and right channels
+}
+
+// newCrossfeed feeds each side into the other at the level, in decibels, below the frequency
+func newCrossfeed(o *options, sampleRate, channels int) Processor {
+	level := o.gain("level", -6, -24, 0)
+	freq := o.float("freq", 700, 100, 2000)
+
+	g := dbToGain(level)
+	return &crossfeed{
+		level:  float32(g),
+		norm:   float32(1 / (1 + g)),
+		alpha:  float32(1 - math.Exp(-2*math.Pi*clampFrequency(freq, sampleRate)/float64(sampleRate))),
+		stereo: channels == 2,
+	}
+}
+
+func (c *crossfeed) Process(samples []float32) {
+	if !c.stereo {
+		return
+	}
+	for f := 0; f+2 <= len(samples); f += 2 {
+		l, r := samples[f], samples[f+1]
+		c.lp[0] += (l - c.lp[0]) * c.alpha
+		c.lp[1] += (r - c.lp[1]) * c.alpha
+		samples[f] = (l + c.lp[1]*c.level) * c.norm
+		samples[f+1] = (r + c.lp[0]*c.level) * c.norm
+	}
+}
@@ -0,0 +1,39 @@
+package dsp
+
+import "math"
+
+func init() {
+	effects["dcblock"] = effectDetails{
+		create:  newDCBlock,
+		options: []string{"freq"},
+	}
+}
+
+// dcBlock removes any DC offset, with a high-pass filter far below what can be heard
+type dcBlock struct {
+	r        float64
+	channels int
+	x1, y1   []float64 // by channel
+}
+
+// newDCBlock removes the DC offset of the audio. The frequency is the cutoff of the filter that
+// does it, in Hz.
+func newDCBlock(o *options, sampleRate, channels int) Processor {
+	freq := o.float("freq", 10, 1, 100)
+	return &dcBlock{
+		r:        math.Exp(-2 * math.Pi * freq / float64(sampleRate)),
+		channels: channels,
+		x1:       make([]float64, channels),
+		y1:       make([]float64, channels),
+	}
+}
+
+func (d *dcBlock) Process(samples []float32) {
+	for i := range samples {
+		ch := i % d.channels
+		x := float64(samples[i])
+		y := x - d.x1[ch] + d.r*d.y1[ch]
+		d.x1[ch], d.y1[ch] = x, y
+		samples[i] = float32(y)
+	}
+}
@@ -0,0 +1,210 @@
+// Package dsp is a chain of effects that the audio passes through after it's rendered and before
+// it's written to the output devices, so that every device hears the same thing.
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	playbackOutput "github.com/gotracker/playback/output"
+
+	"github.com/gotracker/gotracker/internal/mixdown"
+)
+
+// Processor is an effect. It processes interleaved frames of the channels it was made for, in
+// place, where 1 is full scale.
+type Processor interface {
+	Process(samples []float32)
+}
+
+type createProcessorFunc func(o *options, sampleRate, channels int) Processor
+
+type effectDetails struct {
+	create  createProcessorFunc
+	options []string
+}
+
+// effects are the effects that can be put in a chain, by name
+var effects = make(map[string]effectDetails)
+
+// Names returns the names of the effects that can be put in a chain
+func Names() []string {
+	names := make([]string, 0, len(effects))
+	for name := range effects {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Chain is a series of effects, each fed the output of the one before it. A nil chain leaves the
+// audio alone.
+type Chain struct {
+	channels   int
+	processors []Processor
+	buf        []float32
+}
+
+// Parse makes the chain of effects described by the spec, for audio of the channels at the sample
+// rate. Effects are separated by commas, and their options follow a colon, also separated by
+// commas, such as "eq:low=+3,high=-2,reverb:mix=0.2". An empty spec has no effects.
+func Parse(spec string, sampleRate, channels int) (*Chain, error) {
+	type effectSpec struct {
+		name   string
+		values map[string]string
+	}
+
+	var specs []*effectSpec
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, option, hasOption := strings.Cut(part, ":")
+		if !hasOption && strings.Contains(part, "=") {
+			// another option of the effect before it
+			if len(specs) == 0 {
+				return nil, fmt.Errorf("option %q isn't preceded by an effect", part)
+			}
+			option, name = part, ""
+			hasOption = true
+		} else {
+			specs = append(specs, &effectSpec{
+				name:   strings.ToLower(strings.TrimSpace(name)),
+				values: make(map[string]string),
+			})
+		}
+
+		if hasOption && strings.TrimSpace(option) != "" {
+			key, value, ok := strings.Cut(option, "=")
+			if !ok {
+				return nil, fmt.Errorf("option %q must be of the form name=value", option)
+			}
+			specs[len(specs)-1].values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	c := Chain{
+		channels: channels,
+	}
+	for _, s := range specs {
+		details, ok := effects[s.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown effect %q - must be one of {%s}", s.name, strings.Join(Names(), ", "))
+		}
+
+		o := options{
+			values:  s.values,
+			accepts: details.options,
+		}
+		p := details.create(&o, sampleRate, channels)
+		if err := o.done(); err != nil {
+			return nil, fmt.Errorf("effect %q: %w", s.name, err)
+		}
+		c.processors = append(c.processors, p)
+	}
+	return &c, nil
+}
+
+// Validate returns an error if the spec doesn't describe a chain of effects
+func Validate(spec string) error {
+	_, err := Parse(spec, 44100, 2)
+	return err
+}
+
+// Process mixes the premix down, as the output device would, then passes it through the
+// effects. The premix is left holding the processed mix.
+func (c *Chain) Process(premix *playbackOutput.PremixData) {
+	if c == nil || len(c.processors) == 0 || premix.SamplesLen <= 0 {
+		return
+	}
+
+	c.buf = mixdown.Interleaved(c.buf, premix, c.channels)
+	for _, p := range c.processors {
+		p.Process(c.buf)
+	}
+
+	mixdown.Replace(premix, c.buf, c.channels)
+}
+
+// options are the options given to an effect, which it reads as it's made
+type options struct {
+	values  map[string]string
+	accepts []string
+	err     error
+}
+
+// float returns the value of the option, which must be between lo and hi
+func (o *options) float(name string, def, lo, hi float64) float64 {
+	text, ok := o.values[name]
+	if !ok || o.err != nil {
+		return def
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(v) {
+		o.err = fmt.Errorf("invalid %s %q", name, text)
+		return def
+	}
+	if v < lo || v > hi {
+		o.err = fmt.Errorf("%s %v out of range (%v to %v)", name, v, lo, hi)
+		return def
+	}
+	return v
+}
+
+// gain returns the value of the option in decibels (e.g.: -6dB or +3), which must be between lo
+// and hi
+func (o *options) gain(name string, def, lo, hi float64) float64 {
+	if text, ok := o.values[name]; ok && strings.HasSuffix(strings.ToLower(text), "db") {
+		o.values[name] = strings.TrimSpace(text[:len(text)-2])
+	}
+	return o.float(name, def, lo, hi)
+}
+
+// bool returns the value of the option, which must be on or off (or true or false)
+func (o *options) bool(name string, def bool) bool {
+	text, ok := o.values[name]
+	if !ok || o.err != nil {
+		return def
+	}
+	switch strings.ToLower(text) {
+	case "on", "true", "1":
+		return true
+	case "off", "false", "0":
+		return false
+	}
+	o.err = fmt.Errorf("invalid %s %q - must be on or off", name, text)
+	return def
+}
+
+// done returns the first problem with the options, including any that weren't accepted
+func (o *options) done() error {
+	if o.err != nil {
+		return o.err
+	}
+	for name := range o.values {
+		if !slices.Contains(o.accepts, name) {
+			return fmt.Errorf("unknown option %q - effect accepts {%s}", name, strings.Join(o.accepts, ", "))
+		}
+	}
+	return nil
+}
+
+// dbToGain converts decibels to a multiplier of the level
+func dbToGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// clampFrequency keeps the frequency below the Nyquist frequency of the sample rate, so filters
+// stay stable at low sample rates
+func clampFrequency(freq float64, sampleRate int) float64 {
+	return min(freq, float64(sampleRate)*0.45)
+}
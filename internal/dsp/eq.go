@@ -0,0 +1,165 @@
+package dsp
+
+import "math"
+
+func init() {
+	effects["eq"] = effectDetails{
+		create:  newEQ,
+		options: []string{"low", "low_freq", "mid", "mid_freq", "mid_q", "high", "high_freq"},
+	}
+	effects["bass"] = effectDetails{
+		create:  newBassBoost,
+		options: []string{"gain", "freq"},
+	}
+}
+
+// newEQ is a 3-band parametric equalizer: a low shelf, a peak in the middle and a high shelf.
+// Each band's gain is in decibels.
+func newEQ(o *options, sampleRate, channels int) Processor {
+	low := o.gain("low", 0, -24, 24)
+	lowFreq := o.float("low_freq", 100, 20, 20000)
+	mid := o.gain("mid", 0, -24, 24)
+	midFreq := o.float("mid_freq", 1000, 20, 20000)
+	midQ := o.float("mid_q", 0.7, 0.1, 10)
+	high := o.gain("high", 0, -24, 24)
+	highFreq := o.float("high_freq", 8000, 20, 20000)
+
+	var filters []biquad
+	if low != 0 {
+		filters = append(filters, lowShelf(sampleRate, lowFreq, low))
+	}
+	if mid != 0 {
+		filters = append(filters, peaking(sampleRate, midFreq, mid, midQ))
+	}
+	if high != 0 {
+		filters = append(filters, highShelf(sampleRate, highFreq, high))
+	}
+	return newFilterBank(filters, channels)
+}
+
+// newBassBoost raises (or lowers) everything below the frequency by the gain, in decibels
+func newBassBoost(o *options, sampleRate, channels int) Processor {
+	gain := o.gain("gain", 6, -24, 24)
+	freq := o.float("freq", 100, 20, 1000)
+	return newFilterBank([]biquad{lowShelf(sampleRate, freq, gain)}, channels)
+}
+
+// filterBank passes each channel through the filters in turn
+type filterBank struct {
+	filters  []biquad
+	channels int
+	state    []biquadState // by channel, then filter
+}
+
+func newFilterBank(filters []biquad, channels int) *filterBank {
+	return &filterBank{
+		filters:  filters,
+		channels: channels,
+		state:    make([]biquadState, len(filters)*channels),
+	}
+}
+
+func (b *filterBank) Process(samples []float32) {
+	if len(b.filters) == 0 {
+		return
+	}
+	for i := range samples {
+		ch := i % b.channels
+		x := float64(samples[i])
+		for f := range b.filters {
+			x = b.filters[f].process(&b.state[ch*len(b.filters)+f], x)
+		}
+		samples[i] = float32(x)
+	}
+}
+
+// biquad is a second-order filter, with its coefficients normalized so a0 is 1. The designs are
+// from Robert Bristow-Johnson's Audio EQ Cookbook.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// biquadState is what a biquad remembers of the signal passed through it
+type biquadState struct {
+	x1, x2, y1, y2 float64
+}
+
+func (f *biquad) process(s *biquadState, x float64) float64 {
+	y := f.b0*x + f.b1*s.x1 + f.b2*s.x2 - f.a1*s.y1 - f.a2*s.y2
+	s.x2, s.x1 = s.x1, x
+	s.y2, s.y1 = s.y1, y
+	return y
+}
+
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) biquad {
+	return biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b2 / a0,
+		a1: a1 / a0,
+		a2: a2 / a0,
+	}
+}
+
+// lowShelf raises or lowers everything below the frequency by the gain, in decibels
+func lowShelf(sampleRate int, freq, gain float64) biquad {
+	a := math.Pow(10, gain/40)
+	sin, cos := math.Sincos(2 * math.Pi * clampFrequency(freq, sampleRate) / float64(sampleRate))
+	alpha := sin / 2 * math.Sqrt2
+	sqrtA2 := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)-(a-1)*cos+sqrtA2),
+		2*a*((a-1)-(a+1)*cos),
+		a*((a+1)-(a-1)*cos-sqrtA2),
+		(a+1)+(a-1)*cos+sqrtA2,
+		-2*((a-1)+(a+1)*cos),
+		(a+1)+(a-1)*cos-sqrtA2,
+	)
+}
+
+// highShelf raises or lowers everything above the frequency by the gain, in decibels
+func highShelf(sampleRate int, freq, gain float64) biquad {
+	a := math.Pow(10, gain/40)
+	sin, cos := math.Sincos(2 * math.Pi * clampFrequency(freq, sampleRate) / float64(sampleRate))
+	alpha := sin / 2 * math.Sqrt2
+	sqrtA2 := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)+(a-1)*cos+sqrtA2),
+		-2*a*((a-1)+(a+1)*cos),
+		a*((a+1)+(a-1)*cos-sqrtA2),
+		(a+1)-(a-1)*cos+sqrtA2,
+		2*((a-1)-(a+1)*cos),
+		(a+1)-(a-1)*cos-sqrtA2,
+	)
+}
+
+// peaking raises or lowers the frequencies around the center by the gain, in decibels, over a
+// width set by q
+func peaking(sampleRate int, freq, gain, q float64) biquad {
+	a := math.Pow(10, gain/40)
+	sin, cos := math.Sincos(2 * math.Pi * clampFrequency(freq, sampleRate) / float64(sampleRate))
+	alpha := sin / (2 * q)
+	return newBiquad(
+		1+alpha*a,
+		-2*cos,
+		1-alpha*a,
+		1+alpha/a,
+		-2*cos,
+		1-alpha/a,
+	)
+}
+
+// lowPass passes the frequencies below the cutoff, falling away by 12dB an octave above it, with
+// a peak at the cutoff set by q
+func lowPass(sampleRate int, freq, q float64) biquad {
+	sin, cos := math.Sincos(2 * math.Pi * clampFrequency(freq, sampleRate) / float64(sampleRate))
+	alpha := sin / (2 * q)
+	return newBiquad(
+		(1-cos)/2,
+		1-cos,
+		(1-cos)/2,
+		1+alpha,
+		-2*cos,
+		1-alpha,
+	)
+}
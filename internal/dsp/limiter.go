@@ -0,0 +1,58 @@
+package dsp
+
+import "math"
+
+func init() {
+	effects["limiter"] = effectDetails{
+		create:  newLimiter,
+		options: []string{"threshold", "release"},
+	}
+}
+
+// limiter keeps the peaks of the audio under a threshold. It turns the level down as soon as a
+// peak would go over, then back up gradually, so the audio is never clipped and the gain doesn't
+// pump with each sample. The channels are turned down together, so the stereo image holds still.
+type limiter struct {
+	threshold float32
+	release   float32 // how much of the way back to unity gain is left after each frame
+	channels  int
+	gain      float32
+}
+
+// newLimiter limits the audio to the threshold, in decibels below full scale. The release is how
+// long it takes the level to recover, in milliseconds.
+func newLimiter(o *options, sampleRate, channels int) Processor {
+	threshold := o.gain("threshold", -1, -24, 0)
+	release := o.float("release", 100, 1, 5000)
+	return &limiter{
+		threshold: float32(dbToGain(threshold)),
+		release:   float32(math.Exp(-1 / (release / 1000 * float64(sampleRate)))),
+		channels:  channels,
+		gain:      1,
+	}
+}
+
+func (l *limiter) Process(samples []float32) {
+	for f := 0; f+l.channels <= len(samples); f += l.channels {
+		frame := samples[f : f+l.channels]
+
+		var peak float32
+		for _, x := range frame {
+			peak = max(peak, float32(math.Abs(float64(x))))
+		}
+
+		target := float32(1)
+		if peak > l.threshold {
+			target = l.threshold / peak
+		}
+		if target < l.gain {
+			l.gain = target
+		} else {
+			l.gain = target + (l.gain-target)*l.release
+		}
+
+		for ch := range frame {
+			frame[ch] *= l.gain
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package dsp
+
+func init() {
+	effects["reverb"] = effectDetails{
+		create:  newReverb,
+		options: []string{"mix", "room", "damp"},
+	}
+}
+
+// the delays of the reverb's filters, in samples at 44.1kHz, as tuned for Jezar's Freeverb
+var (
+	reverbCombTuning    = []int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllpassTuning = []int{556, 441, 341, 225}
+)
+
+const (
+	// reverbStereoSpread is how many samples longer each channel's delays are than the one before
+	// it, so the channels' reflections differ
+	reverbStereoSpread = 23
+	// reverbInputGain keeps the sum of the comb filters from overloading
+	reverbInputGain = 0.015
+	// reverbWetGain brings the reverberation back up to about the level of the dry signal
+	reverbWetGain = 3
+)
+
+// reverb is a simple algorithmic reverb, after Freeverb: each channel has parallel comb filters
+// fed the mix of all the channels, followed by allpass filters that diffuse the reflections
+type reverb struct {
+	mix      float32
+	channels int
+	combs    [][]comb    // by channel
+	allpass  [][]allpass // by channel
+}
+
+// newReverb blends the reverberation of a room into the audio. The mix is how much of the output
+// is reverberation (0-1), the room is its size (0-1), and damp is how quickly the high
+// frequencies die away (0-1).
+func newReverb(o *options, sampleRate, channels int) Processor {
+	mix := o.float("mix", 0.25, 0, 1)
+	room := o.float("room", 0.5, 0, 1)
+	damp := o.float("damp", 0.5, 0, 1)
+
+	scale := float64(sampleRate) / 44100
+	r := reverb{
+		mix:      float32(mix),
+		channels: channels,
+		combs:    make([][]comb, channels),
+		allpass:  make([][]allpass, channels),
+	}
+	for ch := 0; ch < channels; ch++ {
+		spread := ch * reverbStereoSpread
+		for _, n := range reverbCombTuning {
+			r.combs[ch] = append(r.combs[ch], comb{
+				buf:      make([]float32, max(int(float64(n+spread)*scale), 1)),
+				feedback: float32(room*0.28 + 0.7),
+				damp:     float32(damp * 0.4),
+			})
+		}
+		for _, n := range reverbAllpassTuning {
+			r.allpass[ch] = append(r.allpass[ch], allpass{
+				buf: make([]float32, max(int(float64(n+spread)*scale), 1)),
+			})
+		}
+	}
+	return &r
+}
+
+func (r *reverb) Process(samples []float32) {
+	for f := 0; f+r.channels <= len(samples); f += r.channels {
+		frame := samples[f : f+r.channels]
+
+		var in float32
+		for _, x := range frame {
+			in += x
+		}
+		in *= reverbInputGain
+
+		for ch := range frame {
+			var wet float32
+			for i := range r.combs[ch] {
+				wet += r.combs[ch][i].process(in)
+			}
+			for i := range r.allpass[ch] {
+				wet = r.allpass[ch][i].process(wet)
+			}
+			frame[ch] = frame[ch]*(1-r.mix) + wet*reverbWetGain*r.mix
+		}
+	}
+}
+
+// comb is a feedback comb filter, with a low-pass filter in its feedback
+type comb struct {
+	buf      []float32
+	pos      int
+	feedback float32
+	damp     float32
+	store    float32
+}
+
+func (c *comb) process(x float32) float32 {
+	out := c.buf[c.pos]
+	c.store = out*(1-c.damp) + c.store*c.damp
+	c.buf[c.pos] = x + c.store*c.feedback
+	c.pos = (c.pos + 1) % len(c.buf)
+	return out
+}
+
+// allpass is a Schroeder allpass filter
+type allpass struct {
+	buf []float32
+	pos int
+}
+
+func (a *allpass) process(x float32) float32 {
+	delayed := a.buf[a.pos]
+	a.buf[a.pos] = x + delayed*0.5
+	a.pos = (a.pos + 1) % len(a.buf)
+	return delayed - x
+}
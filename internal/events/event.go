@@ -0,0 +1,59 @@
+// Package events describes what's being played as a stream of events, timed to the audio that
+// has actually been written to the output device, so that visualizers and other tools can follow
+// along with the music.
+package events
+
+// Type is the kind of an event
+type Type string
+
+const (
+	// TypeSongStart is sent when the first audio of a song has been written
+	TypeSongStart = Type("song_start")
+	// TypeSongEnd is sent when the last audio of a song has been written
+	TypeSongEnd = Type("song_end")
+	// TypeOrder is sent when playback moves on to another order
+	TypeOrder = Type("order")
+	// TypeRow is sent at the start of every row
+	TypeRow = Type("row")
+	// TypeLevels is sent every tick with the levels of the channels
+	TypeLevels = Type("levels")
+)
+
+// Event is something that happened during playback
+type Event struct {
+	Type   Type      `json:"type"`
+	Time   float64   `json:"time"` // seconds since the start of the song
+	Song   *Song     `json:"song,omitempty"`
+	Order  int       `json:"order"`
+	Row    int       `json:"row"`
+	Cells  []Cell    `json:"cells,omitempty"`
+	Text   string    `json:"text,omitempty"` // the row as it's logged
+	Levels []float32 `json:"levels,omitempty"`
+}
+
+// Song describes the song that's being played
+type Song struct {
+	Index    int    `json:"index"` // index of the song in the playlist
+	Filepath string `json:"filepath"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist,omitempty"`
+	Orders   int    `json:"orders"`
+	Channels int    `json:"channels"`
+}
+
+// Cell is the pattern data of a channel on a row
+type Cell struct {
+	Channel    int      `json:"channel"`
+	Note       string   `json:"note,omitempty"`
+	NoteNumber *int     `json:"note_number,omitempty"` // semitone of the note, if it's a normal note
+	Instrument int      `json:"instrument,omitempty"`
+	Volume     *float32 `json:"volume,omitempty"`
+	Effect     string   `json:"effect,omitempty"`
+	Text       string   `json:"text"`
+}
+
+// Sink receives events. Publish is called while the audio is being written, so it must not block.
+type Sink interface {
+	Publish(ev Event)
+	Close() error
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"time"
+)
+
+// oscQueueSize is how many events may be waiting out the latency before further ones are dropped
+const oscQueueSize = 4096
+
+// OSCSender is a sink that sends the events as OSC (Open Sound Control) messages over UDP:
+//
+//	/gotracker/song/start <index> <title> <artist> <orders> <channels>
+//	/gotracker/song/end <index>
+//	/gotracker/order <order>
+//	/gotracker/row <order> <row>
+//	/gotracker/note <channel> <note> <instrument> <volume>
+//	/gotracker/noteoff <channel>
+//	/gotracker/levels <level>...
+//
+// Notes are semitones (C-0 = 0), volumes and levels are 0-1, and the volume of a note is -1 if
+// the row doesn't set one.
+type OSCSender struct {
+	conn    net.Conn
+	latency time.Duration
+	ch      chan oscPacket
+	done    chan struct{}
+}
+
+type oscPacket struct {
+	due  time.Time
+	msgs [][]byte
+}
+
+// NewOSCSender creates a sender of OSC messages to the host:port, each sent once the latency
+// has passed since the audio it describes was written
+func NewOSCSender(target string, latency time.Duration) (*OSCSender, error) {
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return nil, err
+	}
+
+	s := OSCSender{
+		conn:    conn,
+		latency: max(latency, 0),
+		ch:      make(chan oscPacket, oscQueueSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return &s, nil
+}
+
+// Publish queues the messages of the event to be sent
+func (s *OSCSender) Publish(ev Event) {
+	msgs := oscMessages(ev)
+	if len(msgs) == 0 {
+		return
+	}
+
+	select {
+	case s.ch <- oscPacket{due: time.Now().Add(s.latency), msgs: msgs}:
+	default:
+		// sending never takes long, so the queue only fills up if the latency is huge
+	}
+}
+
+// Close sends the messages that are still waiting out the latency, then closes the connection
+func (s *OSCSender) Close() error {
+	close(s.ch)
+	<-s.done
+	return s.conn.Close()
+}
+
+func (s *OSCSender) run() {
+	defer close(s.done)
+	for p := range s.ch {
+		if wait := time.Until(p.due); wait > 0 {
+			time.Sleep(wait)
+		}
+		for _, msg := range p.msgs {
+			// UDP is fire and forget - there's nobody to tell if nobody's listening
+			_, _ = s.conn.Write(msg) // lint
+		}
+	}
+}
+
+// oscMessages returns the OSC messages that describe the event
+func oscMessages(ev Event) [][]byte {
+	switch ev.Type {
+	case TypeSongStart:
+		if ev.Song == nil {
+			return nil
+		}
+		return [][]byte{oscMessage("/gotracker/song/start", int32(ev.Song.Index), ev.Song.Title, ev.Song.Artist, int32(ev.Song.Orders), int32(ev.Song.Channels))}
+	case TypeSongEnd:
+		if ev.Song == nil {
+			return nil
+		}
+		return [][]byte{oscMessage("/gotracker/song/end", int32(ev.Song.Index))}
+	case TypeOrder:
+		return [][]byte{oscMessage("/gotracker/order", int32(ev.Order))}
+	case TypeRow:
+		msgs := [][]byte{oscMessage("/gotracker/row", int32(ev.Order), int32(ev.Row))}
+		for _, c := range ev.Cells {
+			switch {
+			case c.NoteNumber != nil:
+				vol := float32(-1)
+				if c.Volume != nil {
+					vol = *c.Volume
+				}
+				msgs = append(msgs, oscMessage("/gotracker/note", int32(c.Channel), int32(*c.NoteNumber), int32(c.Instrument), vol))
+			case c.Note != "":
+				msgs = append(msgs, oscMessage("/gotracker/noteoff", int32(c.Channel)))
+			}
+		}
+		return msgs
+	case TypeLevels:
+		args := make([]any, len(ev.Levels))
+		for i, l := range ev.Levels {
+			args[i] = l
+		}
+		return [][]byte{oscMessage("/gotracker/levels", args...)}
+	}
+	return nil
+}
+
+// oscMessage encodes an OSC message. The arguments may be int32, float32 or string.
+func oscMessage(address string, args ...any) []byte {
+	var b bytes.Buffer
+	writeOSCString(&b, address)
+
+	tags := []byte{','}
+	for _, arg := range args {
+		switch arg.(type) {
+		case int32:
+			tags = append(tags, 'i')
+		case float32:
+			tags = append(tags, 'f')
+		case string:
+			tags = append(tags, 's')
+		}
+	}
+	writeOSCString(&b, string(tags))
+
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			_ = binary.Write(&b, binary.BigEndian, v) // lint
+		case float32:
+			_ = binary.Write(&b, binary.BigEndian, math.Float32bits(v)) // lint
+		case string:
+			writeOSCString(&b, v)
+		}
+	}
+	return b.Bytes()
+}
+
+// writeOSCString writes the string with a terminating NUL, padded to a multiple of 4 bytes
+func writeOSCString(b *bytes.Buffer, s string) {
+	b.WriteString(s)
+	b.Write(make([]byte, 4-len(s)%4))
+}
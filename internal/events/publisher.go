@@ -0,0 +1,236 @@
+package events
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	playbackOutput "github.com/gotracker/playback/output"
+	"github.com/gotracker/playback/player/render"
+)
+
+// marker is a premix that has been rendered, but not written yet
+type marker struct {
+	premix  *playbackOutput.PremixData
+	levels  []float32 // of the channels of the song, before the premix was mixed down
+	start   *Song     // the song that starts with this premix
+	end     bool      // the song ends with this premix
+	written bool
+}
+
+// Publisher turns the premixes written to the output device into events for its sinks.
+//
+// The premixes are rendered well ahead of being written, so the start and end of each song are
+// noted against the premixes as they're rendered, and only published once those premixes have
+// been written.
+type Publisher struct {
+	sinks      []Sink
+	sampleRate int
+
+	mu        sync.Mutex
+	pending   *Song // song started, but nothing rendered for it yet
+	channels  int   // of the song being rendered
+	queue     []*marker
+	last      *marker // the most recently rendered premix
+	song      *Song
+	elapsed   int64 // samples written for the current song
+	lastOrder int
+	order     int
+	row       int
+	closed    bool
+}
+
+// NewPublisher creates a publisher of the events of audio written at the sample rate
+func NewPublisher(sampleRate int, sinks ...Sink) *Publisher {
+	p := Publisher{
+		sinks:      sinks,
+		sampleRate: sampleRate,
+		lastOrder:  -1,
+	}
+	return &p
+}
+
+// SongStart notes that the next premix rendered is the start of the song
+func (p *Publisher) SongStart(s Song) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = &s
+}
+
+// Rendered notes that the premix has been rendered and will be written soon. The levels of its
+// channels are taken now, so it has to be given before anything mixes the channels down.
+func (p *Publisher) Rendered(premix *playbackOutput.PremixData) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending != nil {
+		p.channels = p.pending.Channels
+	}
+	m := marker{
+		premix: premix,
+		levels: channelLevels(premix, p.channels),
+		start:  p.pending,
+	}
+	p.pending = nil
+	p.queue = append(p.queue, &m)
+	p.last = &m
+}
+
+// SongEnd notes that the premix rendered most recently is the end of the song
+func (p *Publisher) SongEnd() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending != nil {
+		// nothing was rendered for it, so it never started
+		p.pending = nil
+		return
+	}
+	if p.last == nil {
+		return
+	}
+	if p.last.written {
+		p.endSong()
+	} else {
+		p.last.end = true
+	}
+}
+
+// Written publishes the events of the premix, which has just been written to the output device
+func (p *Publisher) Written(premix *playbackOutput.PremixData) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !slices.ContainsFunc(p.queue, func(m *marker) bool { return m.premix == premix }) {
+		return
+	}
+
+	for len(p.queue) > 0 {
+		m := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		m.written = true
+
+		if m.start != nil {
+			p.startSong(m.start)
+		}
+		if m.premix == premix {
+			p.write(m)
+		}
+		// premixes that were thrown away before being written still start and end their songs
+		if m.end {
+			p.endSong()
+		}
+		if m.premix == premix {
+			break
+		}
+	}
+}
+
+func (p *Publisher) startSong(s *Song) {
+	if p.song != nil {
+		p.endSong()
+	}
+	p.song = s
+	p.elapsed = 0
+	p.lastOrder = -1
+	p.order, p.row = 0, 0
+	p.publish(Event{
+		Type: TypeSongStart,
+		Song: s,
+	})
+}
+
+func (p *Publisher) endSong() {
+	if p.song == nil {
+		return
+	}
+	p.publish(Event{
+		Type:  TypeSongEnd,
+		Time:  p.seconds(),
+		Song:  p.song,
+		Order: p.order,
+		Row:   p.row,
+	})
+	p.song = nil
+}
+
+func (p *Publisher) write(m *marker) {
+	if p.song == nil {
+		return
+	}
+	premix := m.premix
+
+	if row, ok := premix.Userdata.(*render.RowRender); ok && row != nil {
+		p.order, p.row = row.Order, row.Row
+		if row.Order != p.lastOrder {
+			p.lastOrder = row.Order
+			p.publish(Event{
+				Type:  TypeOrder,
+				Time:  p.seconds(),
+				Order: row.Order,
+				Row:   row.Row,
+			})
+		}
+		if row.Tick == 0 {
+			var text string
+			if row.RowText != nil {
+				text = row.RowText.String()
+			}
+			p.publish(Event{
+				Type:  TypeRow,
+				Time:  p.seconds(),
+				Order: row.Order,
+				Row:   row.Row,
+				Cells: rowCells(row.RowText),
+				Text:  text,
+			})
+		}
+	}
+
+	if len(m.levels) > 0 {
+		p.publish(Event{
+			Type:   TypeLevels,
+			Time:   p.seconds(),
+			Order:  p.order,
+			Row:    p.row,
+			Levels: m.levels,
+		})
+	}
+
+	p.elapsed += int64(premix.SamplesLen)
+}
+
+func (p *Publisher) seconds() float64 {
+	if p.sampleRate <= 0 {
+		return 0
+	}
+	return float64(p.elapsed) / float64(p.sampleRate)
+}
+
+func (p *Publisher) publish(ev Event) {
+	if p.closed {
+		return
+	}
+	for _, s := range p.sinks {
+		s.Publish(ev)
+	}
+}
+
+// Close ends the current song and closes the sinks
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	p.endSong()
+	p.closed = true
+	p.queue = nil
+	p.last = nil
+	p.mu.Unlock()
+
+	var errs []error
+	for _, s := range p.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/gotracker/playback/mixing"
+	"github.com/gotracker/playback/mixing/volume"
+	playbackOutput "github.com/gotracker/playback/output"
+
+	"github.com/gotracker/gotracker/internal/mixdown"
+)
+
+// eventLog is a sink that keeps the events published to it
+type eventLog []Event
+
+func (l *eventLog) Publish(ev Event) {
+	*l = append(*l, ev)
+}
+
+func (l *eventLog) Close() error {
+	return nil
+}
+
+// channelSample is a single sample of a channel of a song, at the level
+func channelSample(level volume.Volume) mixing.Data {
+	var m volume.Matrix
+	m.Channels = 1
+	m.StaticMatrix[0] = level
+	return mixing.Data{
+		Data:       mixing.MixBuffer{m},
+		Volume:     1,
+		SamplesLen: 1,
+	}
+}
+
+func TestLevelsOfMixedDownPremix(t *testing.T) {
+	var sink eventLog
+	p := NewPublisher(44100, &sink)
+
+	premix := &playbackOutput.PremixData{
+		SamplesLen:  1,
+		MixerVolume: 1,
+		Data: []mixing.ChannelData{{
+			channelSample(0.5),
+			channelSample(0.25),
+			channelSample(0.125),
+		}},
+	}
+
+	p.SongStart(Song{Channels: 2})
+	p.Rendered(premix)
+	// as effects and oversampling do, once the channels' levels have been taken
+	mixdown.Replace(premix, []float32{0.75, 0.75}, 2)
+	p.Written(premix)
+
+	i := slices.IndexFunc(sink, func(ev Event) bool { return ev.Type == TypeLevels })
+	if i < 0 {
+		t.Fatalf("no levels published in %v", sink)
+	}
+	if expected := []float32{0.5, 0.25}; !slices.Equal(sink[i].Levels, expected) {
+		t.Errorf("got levels %v, expected %v", sink[i].Levels, expected)
+	}
+}
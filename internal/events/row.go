@@ -0,0 +1,104 @@
+package events
+
+import (
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/gotracker/playback/note"
+	playbackOutput "github.com/gotracker/playback/output"
+	"github.com/gotracker/playback/player/render"
+	"github.com/gotracker/playback/song"
+)
+
+// rowCells returns the cells of the row. The row text of every format is a render.RowText of its
+// own channel data type, so the cells are found by reflection.
+func rowCells(rs render.RowStringer) []Cell {
+	v := reflect.ValueOf(rs)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	vm := v.FieldByName("ViewModel")
+	if !vm.IsValid() || vm.Kind() != reflect.Struct {
+		return nil
+	}
+	channels := vm.FieldByName("Channels")
+	if !channels.IsValid() || channels.Kind() != reflect.Slice {
+		return nil
+	}
+
+	n := channels.Len()
+	if mc := vm.FieldByName("MaxChannels"); mc.IsValid() && mc.CanInt() && mc.Int() > 0 {
+		n = min(n, int(mc.Int()))
+	}
+
+	cells := make([]Cell, 0, n)
+	for i := 0; i < n; i++ {
+		d, ok := channels.Index(i).Interface().(song.ChannelDataIntf)
+		if !ok {
+			return nil
+		}
+		cells = append(cells, newCell(i, d))
+	}
+	return cells
+}
+
+func newCell(ch int, d song.ChannelDataIntf) Cell {
+	c := Cell{
+		Channel: ch,
+		Text:    d.String(),
+	}
+	if d.HasNote() {
+		n := d.GetNote()
+		c.Note = note.String(n)
+		if normal, ok := n.(note.Normal); ok {
+			semitone := int(normal)
+			c.NoteNumber = &semitone
+		}
+	}
+	if d.HasInstrument() {
+		c.Instrument = d.GetInstrument()
+	}
+	if d.HasVolume() {
+		vol := float32(d.GetVolumeGeneric())
+		c.Volume = &vol
+	}
+	if d.HasCommand() {
+		// the effect is the last column of the text of every format
+		if fields := strings.Fields(c.Text); len(fields) > 0 {
+			if eff := fields[len(fields)-1]; strings.Trim(eff, ".") != "" {
+				c.Effect = eff
+			}
+		}
+	}
+	return c
+}
+
+// channelLevels returns the peak level of each of the first channels of the premix. Past notes
+// (from new note actions) are not attributed to any channel.
+func channelLevels(premix *playbackOutput.PremixData, channels int) []float32 {
+	if len(premix.Data) == 0 {
+		return nil
+	}
+
+	outputs := premix.Data[0]
+	levels := make([]float32, min(channels, len(outputs)))
+	for i := range levels {
+		d := &outputs[i]
+		var peak float32
+		for _, m := range d.Data {
+			for c := 0; c < m.Channels; c++ {
+				peak = max(peak, float32(math.Abs(float64(m.StaticMatrix[c]))))
+			}
+		}
+		levels[i] = min(peak*float32(d.Volume)*float32(premix.MixerVolume), 1)
+	}
+	return levels
+}
@@ -0,0 +1,254 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/gotracker/gotracker/internal/logging"
+)
+
+// clientQueueSize is how many events a WebSocket client may fall behind before it is dropped
+const clientQueueSize = 1024
+
+// writeTimeout is how long a WebSocket client has to accept an event
+const writeTimeout = 10 * time.Second
+
+// WebSocketServer is a sink that sends the events, as JSON, to any number of WebSocket clients
+// connected to /events
+type WebSocketServer struct {
+	srv      *http.Server
+	ln       net.Listener
+	upgrader websocket.Upgrader
+	logger   logging.Log
+	wg       sync.WaitGroup // subscribed clients
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	closed  bool
+}
+
+// NewWebSocketServer creates the server and starts listening for clients. Unless anyOrigin is set,
+// only pages served from the server's own address or from localhost may follow the feed.
+func NewWebSocketServer(listen string, anyOrigin bool, logger logging.Log) (*WebSocketServer, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	s := WebSocketServer{
+		ln:      ln,
+		logger:  logger,
+		clients: make(map[chan []byte]struct{}),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkOrigin,
+		},
+	}
+	if anyOrigin {
+		s.upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/events", s.handleEvents)
+
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Println(err)
+		}
+	}()
+
+	return &s, nil
+}
+
+// checkOrigin allows clients that aren't browsers (which don't send an origin), the server's own
+// index page and pages served from localhost
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Addr returns the address the server is listening on
+func (s *WebSocketServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Publish sends the event to every client, dropping any that can't keep up
+func (s *WebSocketServer) Publish(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.clients) == 0 {
+		return
+	}
+
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	for ch := range s.clients {
+		select {
+		case ch <- msg:
+		default:
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close disconnects all of the clients and stops the server
+func (s *WebSocketServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ch := range s.clients {
+		delete(s.clients, ch)
+		close(ch)
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.srv.Shutdown(ctx)
+
+	// the clients' connections have been taken over from the server, so it doesn't wait for them
+	s.wg.Wait()
+	return err
+}
+
+func (s *WebSocketServer) subscribe() (chan []byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, false
+	}
+	ch := make(chan []byte, clientQueueSize)
+	s.clients[ch] = struct{}{}
+	s.wg.Add(1)
+	return ch, true
+}
+
+func (s *WebSocketServer) unsubscribe(ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[ch]; ok {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+func (s *WebSocketServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.subscribe()
+	if !ok {
+		http.Error(w, "playback has ended", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.wg.Done()
+	defer s.unsubscribe(ch)
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// nothing is expected from the client, but reading is how a close from its side is noticed
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second)) // lint
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout)) // lint
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *WebSocketServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, indexPage)
+}
+
+const indexPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Gotracker events</title></head>
+<body>
+<h1 id="song">Gotracker</h1>
+<pre id="row"></pre>
+<div id="levels"></div>
+<script>
+const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/events");
+ws.onmessage = (msg) => {
+	const ev = JSON.parse(msg.data);
+	switch (ev.type) {
+	case "song_start":
+		document.getElementById("song").textContent = ev.song.artist ? ev.song.artist + " - " + ev.song.title : ev.song.title;
+		break;
+	case "row":
+		const pos = String(ev.order).padStart(3, "0") + ":" + String(ev.row).padStart(3, "0");
+		document.getElementById("row").textContent = pos + " |" + (ev.cells || []).map((c) => c.text).join("|") + "|";
+		break;
+	case "levels":
+		document.getElementById("levels").innerHTML = ev.levels.map((l) =>
+			'<div style="height:4px;margin:1px;background:#4a4;width:' + Math.round(l * 400) + 'px"></div>').join("");
+		break;
+	}
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		host    string
+		origin  string
+		allowed bool
+	}{
+		{"192.168.1.10:8001", "", true},
+		{"192.168.1.10:8001", "http://192.168.1.10:8001", true},
+		{"192.168.1.10:8001", "http://localhost:3000", true},
+		{"192.168.1.10:8001", "http://127.0.0.1:3000", true},
+		{"192.168.1.10:8001", "http://[::1]:3000", true},
+		{"192.168.1.10:8001", "http://192.168.1.10:8002", false},
+		{"192.168.1.10:8001", "https://example.com", false},
+		{"192.168.1.10:8001", "http://localhost.example.com", false},
+		{"192.168.1.10:8001", "null", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/events", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if allowed := checkOrigin(r); allowed != tt.allowed {
+			t.Errorf("origin %q of a request to %s: got allowed = %v, expected %v", tt.origin, tt.host, allowed, tt.allowed)
+		}
+	}
+}
@@ -2,29 +2,39 @@ package logging
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 type Squelchable struct {
-	Squelch bool `pflag:"silent" env:"silent" pf:"q" usage:"disable non-error logging"`
+	Squelch bool      `pflag:"silent" env:"silent" pf:"q" usage:"disable non-error logging"`
+	Writer  io.Writer // if set, logging is written to it instead of stdout
 }
 
 func (s *Squelchable) Printf(format string, args ...any) {
 	if s.Squelch {
 		return
 	}
-	fmt.Printf(format, args...)
+	fmt.Fprintf(s.writer(), format, args...)
 }
 
 func (s *Squelchable) Println(args ...any) {
 	if s.Squelch {
 		return
 	}
-	fmt.Println(args...)
+	fmt.Fprintln(s.writer(), args...)
 }
 
 func (s *Squelchable) Print(args ...any) {
 	if s.Squelch {
 		return
 	}
-	fmt.Print(args...)
+	fmt.Fprint(s.writer(), args...)
+}
+
+func (s *Squelchable) writer() io.Writer {
+	if s.Writer != nil {
+		return s.Writer
+	}
+	return os.Stdout
 }
@@ -0,0 +1,158 @@
+package loudness
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheVersion is changed whenever the way songs are measured changes, so old measurements aren't
+// used
+const cacheVersion = 1
+
+type cacheFile struct {
+	Version int               `json:"version"`
+	Entries map[string]Result `json:"entries"`
+}
+
+// Cache keeps the measurements of songs, so they needn't be measured again each time they're
+// played. It's safe to use from more than one goroutine.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]Result
+	added   map[string]Result
+}
+
+// DefaultCachePath returns where the cache is kept, in the user's cache directory
+func DefaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gotracker", "loudness.json"), nil
+}
+
+// OpenCache opens the cache at the path. A cache that doesn't exist yet is empty.
+func OpenCache(path string) (*Cache, error) {
+	entries, err := readCache(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		path:    path,
+		entries: entries,
+		added:   make(map[string]Result),
+	}, nil
+}
+
+func readCache(path string) (map[string]Result, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]Result), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != cacheVersion || f.Entries == nil {
+		// start over, rather than fail because of a cache that's damaged or out of date
+		return make(map[string]Result), nil
+	}
+	return f.Entries, nil
+}
+
+// Get returns the measurement with the key, if there is one
+func (c *Cache) Get(key string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.entries[key]
+	return r, ok
+}
+
+// Put keeps the measurement with the key
+func (c *Cache) Put(key string, r Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = r
+	c.added[key] = r
+}
+
+// Save writes the measurements that have been added to the cache file, along with any that
+// another player has added since it was opened
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.added) == 0 {
+		return nil
+	}
+
+	entries, err := readCache(c.path)
+	if err != nil {
+		return err
+	}
+	for key, r := range c.added {
+		entries[key] = r
+	}
+
+	data, err := json.Marshal(cacheFile{
+		Version: cacheVersion,
+		Entries: entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.entries = entries
+	clear(c.added)
+	return nil
+}
+
+// Key returns the key of the measurement of the file, rendered with the settings. The file is
+// identified by its contents, so it's found again if it's moved, and measured again if it changes.
+func Key(filename string, settings any) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	s, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	h.Write(s)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
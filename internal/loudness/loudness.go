@@ -0,0 +1,288 @@
+// Package loudness measures the integrated loudness and true peak of audio, as EBU R128 (ITU-R
+// BS.1770) defines them, so songs can be played back at the same level.
+package loudness
+
+import (
+	"math"
+	"slices"
+)
+
+const (
+	// blockDuration is the length of the blocks of audio loudness is measured over, in seconds
+	blockDuration = 0.4
+	// blockSteps is how many steps each block is divided into - each block overlaps the one before
+	// it by all but one of them
+	blockSteps = 4
+	// absoluteGate is the loudness, in LUFS, below which blocks are taken to be silence
+	absoluteGate = -70
+	// relativeGate is how far below the loudness of the ungated blocks, in LU, that blocks are left
+	// out of the measurement
+	relativeGate = -10
+
+	// rangeBlockSteps is how many steps make up each of the 3s blocks the loudness range is
+	// measured over, as EBU Tech 3342 defines it
+	rangeBlockSteps = 30
+	// rangeGate is how far below the loudness of the ungated blocks, in LU, that blocks are left out
+	// of the loudness range
+	rangeGate = -20
+	// rangeLow and rangeHigh are the percentiles of the blocks' loudness the range lies between
+	rangeLow  = 0.10
+	rangeHigh = 0.95
+)
+
+// Result is the measurement of a song
+type Result struct {
+	Loudness float64 `json:"loudness"` // integrated loudness, in LUFS
+	Peak     float64 `json:"peak"`     // true peak (1 = full scale)
+	Blocks   int     `json:"blocks"`   // the number of blocks the loudness was measured over (0 = silent)
+}
+
+// Silent returns whether nothing loud enough to be measured was heard
+func (r Result) Silent() bool {
+	return r.Blocks == 0
+}
+
+// PeakDB returns the true peak in decibels relative to full scale
+func (r Result) PeakDB() float64 {
+	if r.Peak <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(r.Peak)
+}
+
+// Combine returns the measurement of the results played one after another, such as the songs of
+// an album. The loudness is the average of the songs' loudness, weighted by how long each was heard.
+func Combine(results []Result) Result {
+	var (
+		r     Result
+		power float64
+	)
+	for _, s := range results {
+		r.Peak = max(r.Peak, s.Peak)
+		if s.Silent() {
+			continue
+		}
+		power += float64(s.Blocks) * math.Pow(10, s.Loudness/10)
+		r.Blocks += s.Blocks
+	}
+	if r.Blocks > 0 {
+		r.Loudness = 10 * math.Log10(power/float64(r.Blocks))
+	}
+	return r
+}
+
+// Gain returns the gain, in decibels, that brings the result to the target loudness, in LUFS,
+// without letting its true peak go over full scale
+func Gain(r Result, target float64) float64 {
+	if r.Silent() {
+		return 0
+	}
+	gain := target - r.Loudness
+	if r.Peak > 0 {
+		gain = min(gain, -r.PeakDB())
+	}
+	return gain
+}
+
+// Meter measures audio as it's written to it
+type Meter struct {
+	channels int
+	weights  []float64
+	filters  [][2]biquad // K-weighting, by channel
+	peaks    []truePeak
+
+	stepLen int     // frames in each step of a block
+	pos     int     // frames into the current step
+	energy  float64 // weighted sum of the squares of the current step
+	steps   []float64
+}
+
+// New makes a meter of audio of the channels at the sample rate
+func New(sampleRate, channels int) *Meter {
+	m := Meter{
+		channels: channels,
+		weights:  channelWeights(channels),
+		filters:  make([][2]biquad, channels),
+		peaks:    make([]truePeak, channels),
+		stepLen:  max(int(float64(sampleRate)*blockDuration/blockSteps), 1),
+	}
+	shelf, highPass := kWeighting(sampleRate)
+	for c := range m.filters {
+		m.filters[c] = [2]biquad{shelf, highPass}
+	}
+	return &m
+}
+
+// channelWeights returns how much each channel counts towards the loudness. The surround channels
+// of a quad layout count for more, as they're heard from behind.
+func channelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for c := range weights {
+		weights[c] = 1
+		if channels == 4 && c >= 2 {
+			weights[c] = 1.41
+		}
+	}
+	return weights
+}
+
+// Write measures interleaved frames of the channels, where 1 is full scale
+func (m *Meter) Write(samples []float32) {
+	for f := 0; f+m.channels <= len(samples); f += m.channels {
+		for c := 0; c < m.channels; c++ {
+			x := float64(samples[f+c])
+			m.peaks[c].write(x)
+			y := m.filters[c][1].process(m.filters[c][0].process(x))
+			m.energy += m.weights[c] * y * y
+		}
+
+		m.pos++
+		if m.pos == m.stepLen {
+			m.steps = append(m.steps, m.energy/float64(m.stepLen))
+			m.pos, m.energy = 0, 0
+		}
+	}
+}
+
+// Result returns the measurement of the audio written so far
+func (m *Meter) Result() Result {
+	var r Result
+	for c := range m.peaks {
+		r.Peak = max(r.Peak, m.peaks[c].peak)
+	}
+
+	// the power of each block, over the absolute gate
+	var blocks []float64
+	for i := blockSteps - 1; i < len(m.steps); i++ {
+		var z float64
+		for _, s := range m.steps[i-blockSteps+1 : i+1] {
+			z += s
+		}
+		z /= blockSteps
+		if powerToLUFS(z) > absoluteGate {
+			blocks = append(blocks, z)
+		}
+	}
+	if len(blocks) == 0 {
+		return r
+	}
+
+	gate := powerToLUFS(mean(blocks)) + relativeGate
+	var gated []float64
+	for _, z := range blocks {
+		if powerToLUFS(z) > gate {
+			gated = append(gated, z)
+		}
+	}
+	if len(gated) == 0 {
+		return r
+	}
+
+	r.Loudness = powerToLUFS(mean(gated))
+	r.Blocks = len(gated)
+	return r
+}
+
+// Range returns the loudness range of the audio written so far, in LU - how far apart its quieter
+// and louder parts are, leaving out the extremes
+func (m *Meter) Range() float64 {
+	var blocks []float64
+	for i := rangeBlockSteps - 1; i < len(m.steps); i++ {
+		var z float64
+		for _, s := range m.steps[i-rangeBlockSteps+1 : i+1] {
+			z += s
+		}
+		z /= rangeBlockSteps
+		if powerToLUFS(z) > absoluteGate {
+			blocks = append(blocks, z)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	gate := powerToLUFS(mean(blocks)) + rangeGate
+	var levels []float64
+	for _, z := range blocks {
+		if l := powerToLUFS(z); l > gate {
+			levels = append(levels, l)
+		}
+	}
+	if len(levels) == 0 {
+		return 0
+	}
+
+	slices.Sort(levels)
+	percentile := func(p float64) float64 {
+		return levels[int(math.Round(p*float64(len(levels)-1)))]
+	}
+	return percentile(rangeHigh) - percentile(rangeLow)
+}
+
+func powerToLUFS(z float64) float64 {
+	if z <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(z)
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// biquad is a second-order filter, with its coefficients normalized so a0 is 1
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter at the sample rate: a high shelf that
+// accounts for the head, then a high-pass filter. BS.1770 gives their coefficients at 48kHz - these
+// are the analog designs they come from, as libebur128 derives them.
+func kWeighting(sampleRate int) (biquad, biquad) {
+	fs := float64(sampleRate)
+
+	const (
+		shelfFreq = 1681.974450955533
+		shelfGain = 3.999843853973347
+		shelfQ    = 0.7071752369554196
+	)
+	k := math.Tan(math.Pi * shelfFreq / fs)
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	const (
+		highPassFreq = 38.13547087602444
+		highPassQ    = 0.5003270373238773
+	)
+	k = math.Tan(math.Pi * highPassFreq / fs)
+	a0 = 1 + k/highPassQ + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/highPassQ + k*k) / a0,
+	}
+
+	return shelf, highPass
+}
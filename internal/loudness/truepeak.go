@@ -0,0 +1,51 @@
+package loudness
+
+import "math"
+
+const (
+	// oversampling is how many times the sample rate the audio is upsampled to, to find the peaks
+	// that fall between samples
+	oversampling = 4
+	// interpolatorTaps is the length of each phase of the upsampling filter
+	interpolatorTaps = 12
+)
+
+// interpolator is a windowed-sinc low-pass filter, split into a phase for each of the points
+// between a pair of samples
+var interpolator = makeInterpolator()
+
+func makeInterpolator() [oversampling][interpolatorTaps]float64 {
+	var phases [oversampling][interpolatorTaps]float64
+	const n = oversampling * interpolatorTaps
+	center := float64(n-1) / 2
+	for i := 0; i < n; i++ {
+		t := (float64(i) - center) / oversampling
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/n)
+		phases[i%oversampling][i/oversampling] = sinc * window
+	}
+	return phases
+}
+
+// truePeak finds the peak of a channel, as it would be once converted back to analog
+type truePeak struct {
+	history [interpolatorTaps]float64 // the latest samples, most recent first
+	peak    float64
+}
+
+func (t *truePeak) write(x float64) {
+	copy(t.history[1:], t.history[:interpolatorTaps-1])
+	t.history[0] = x
+
+	t.peak = max(t.peak, math.Abs(x))
+	for p := range interpolator {
+		var y float64
+		for k, h := range interpolator[p] {
+			y += t.history[k] * h
+		}
+		t.peak = max(t.peak, math.Abs(y))
+	}
+}
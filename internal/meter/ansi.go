@@ -0,0 +1,130 @@
+package meter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ANSI colors of the bars
+const (
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+	ansiBold   = "\x1b[1m"
+	ansiReset  = "\x1b[0m"
+)
+
+// the parts of a block character, in eighths
+var blockEighths = []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉', '█'}
+
+// the heights of a block character, in eighths
+var blockHeights = []rune{' ', '▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// Zone is the part of a meter a level falls in
+type Zone int
+
+const (
+	// ZoneNormal is a comfortable level
+	ZoneNormal = Zone(iota)
+	// ZoneHot is getting close to full scale
+	ZoneHot
+	// ZoneClip is at or over full scale
+	ZoneClip
+)
+
+// ZoneOf returns the part of a meter that the position (from Scale) falls in
+func ZoneOf(pos float32) Zone {
+	switch {
+	case pos >= 1:
+		return ZoneClip
+	case pos >= 0.875: // -6 dB
+		return ZoneHot
+	default:
+		return ZoneNormal
+	}
+}
+
+// ANSIBar returns a horizontal bar graph of the level, the width of the characters, colored by
+// how close the level is to full scale
+func ANSIBar(level float32, width int) string {
+	pos := Scale(level)
+	eighths := int(math.Round(float64(pos) * float64(width*8)))
+
+	var b strings.Builder
+	zone := Zone(-1)
+	for i := 0; i < width; i++ {
+		if z := ZoneOf(float32(i+1) / float32(width)); z != zone {
+			zone = z
+			b.WriteString(zoneColor(z))
+		}
+		fill := min(max(eighths-i*8, 0), 8)
+		b.WriteRune(blockEighths[fill])
+	}
+	b.WriteString(ansiReset)
+	return b.String()
+}
+
+// ANSISpectrum returns a graph of the levels of the spectrum, a character per band
+func ANSISpectrum(levels []float32) string {
+	var b strings.Builder
+	b.WriteString(ansiGreen)
+	for _, l := range levels {
+		b.WriteRune(blockHeights[int(math.Round(float64(l)*8))])
+	}
+	b.WriteString(ansiReset)
+	return b.String()
+}
+
+// ANSIStatus returns a line showing the reading: a bar for the peak of each channel, its RMS level
+// in dB, whether it's clipped, then the spectrum
+func ANSIStatus(r Reading, barWidth int) string {
+	var b strings.Builder
+	for c := range r.Peak {
+		fmt.Fprintf(&b, "%s ", ChannelName(c, len(r.Peak)))
+		b.WriteString(ANSIBar(r.Peak[c], barWidth))
+		fmt.Fprintf(&b, " %5s", FormatDB(r.RMS[c]))
+		if r.Clipped[c] {
+			b.WriteString(" " + ansiBold + ansiRed + "CLIP" + ansiReset)
+		} else {
+			b.WriteString("     ")
+		}
+		b.WriteString("  ")
+	}
+	b.WriteString(ANSISpectrum(r.Spectrum))
+	return b.String()
+}
+
+func zoneColor(z Zone) string {
+	switch z {
+	case ZoneClip:
+		return ansiRed
+	case ZoneHot:
+		return ansiYellow
+	default:
+		return ansiGreen
+	}
+}
+
+// ChannelName returns the short name of the channel of the output, such as L or R
+func ChannelName(c, channels int) string {
+	switch {
+	case channels == 1:
+		return "M"
+	case channels == 2:
+		return []string{"L", "R"}[c]
+	case channels == 4:
+		return []string{"FL", "FR", "RL", "RR"}[c]
+	default:
+		return fmt.Sprint(c + 1)
+	}
+}
+
+// FormatDB returns the level in decibels, for showing alongside a meter
+func FormatDB(level float32) string {
+	db := DB(level)
+	if db < floorDB {
+		return "-inf"
+	}
+	return fmt.Sprintf("%.1f", db)
+}
@@ -0,0 +1,138 @@
+// Package meter measures the audio written to the output device - the peak and RMS level of each
+// of its channels and the spectrum of the mix - for showing that something's playing, and whether
+// it's clipping.
+package meter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	playbackOutput "github.com/gotracker/playback/output"
+
+	"github.com/gotracker/gotracker/internal/mixdown"
+)
+
+// fftSize is the number of samples the spectrum is found from
+const fftSize = 2048
+
+// clipHold is how long a channel is shown as clipped after it last clipped
+const clipHold = time.Second
+
+// floorDB is the quietest level that shows on the meters
+const floorDB = -48
+
+// Reading is a measurement of the audio written since the previous reading
+type Reading struct {
+	Peak     []float32 // peak level of each channel (1 = full scale)
+	RMS      []float32 // RMS level of each channel (1 = full scale)
+	Clipped  []bool    // whether each channel has clipped lately
+	Spectrum []float32 // level of each band, from low to high frequencies (0-1)
+}
+
+// Meter measures the premixes as they're written. It's safe to take readings while it's fed.
+type Meter struct {
+	channels   int
+	sampleRate int
+
+	mu       sync.Mutex
+	peak     []float32
+	sumSq    []float64
+	count    int
+	lastClip []time.Time
+	ring     []float32 // the latest samples of the mix, for the spectrum
+	ringPos  int
+	mix      []float32 // scratch space for mixing a premix
+}
+
+// New creates a meter of audio with the channels at the sample rate
+func New(channels, sampleRate int) *Meter {
+	return &Meter{
+		channels:   channels,
+		sampleRate: sampleRate,
+		peak:       make([]float32, channels),
+		sumSq:      make([]float64, channels),
+		lastClip:   make([]time.Time, channels),
+		ring:       make([]float32, fftSize),
+	}
+}
+
+// Channels returns the number of channels measured
+func (m *Meter) Channels() int {
+	return m.channels
+}
+
+// Written measures the premix, which has just been written to the output device
+func (m *Meter) Written(premix *playbackOutput.PremixData) {
+	if premix == nil || premix.SamplesLen <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mix = mixdown.Interleaved(m.mix, premix, m.channels)
+	now := time.Now()
+	for i := 0; i < premix.SamplesLen; i++ {
+		var mono float32
+		for c := 0; c < m.channels; c++ {
+			v := m.mix[i*m.channels+c]
+			a := float32(math.Abs(float64(v)))
+			m.peak[c] = max(m.peak[c], a)
+			m.sumSq[c] += float64(v) * float64(v)
+			if a >= 1 {
+				m.lastClip[c] = now
+			}
+			mono += v
+		}
+		m.ring[m.ringPos] = mono / float32(m.channels)
+		m.ringPos = (m.ringPos + 1) % len(m.ring)
+	}
+	m.count += premix.SamplesLen
+}
+
+// Read returns the measurements of the audio written since the previous reading, with a spectrum
+// of the bands
+func (m *Meter) Read(bands int) Reading {
+	m.mu.Lock()
+	r := Reading{
+		Peak:    make([]float32, m.channels),
+		RMS:     make([]float32, m.channels),
+		Clipped: make([]bool, m.channels),
+	}
+	now := time.Now()
+	for c := range r.Peak {
+		r.Peak[c] = m.peak[c]
+		if m.count > 0 {
+			r.RMS[c] = float32(math.Sqrt(m.sumSq[c] / float64(m.count)))
+		}
+		r.Clipped[c] = !m.lastClip[c].IsZero() && now.Sub(m.lastClip[c]) < clipHold
+		m.peak[c], m.sumSq[c] = 0, 0
+	}
+	m.count = 0
+
+	samples := make([]float32, len(m.ring))
+	n := copy(samples, m.ring[m.ringPos:])
+	copy(samples[n:], m.ring[:m.ringPos])
+	m.mu.Unlock()
+
+	r.Spectrum = spectrum(samples, m.sampleRate, bands)
+	return r
+}
+
+// Scale returns where the level falls on a meter, from 0 (at or below the floor) to 1 (full scale)
+func Scale(level float32) float32 {
+	if level <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(float64(level))
+	return float32(min(max((db-floorDB)/-floorDB, 0), 1))
+}
+
+// DB returns the level in decibels relative to full scale
+func DB(level float32) float64 {
+	if level <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(float64(level))
+}
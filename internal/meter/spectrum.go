@@ -0,0 +1,83 @@
+package meter
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// The range of frequencies shown by the spectrum
+const (
+	spectrumLowHz  = 40
+	spectrumHighHz = 16000
+)
+
+// spectrumFloorDB is the quietest band level that shows on the spectrum
+const spectrumFloorDB = -60
+
+// spectrum returns the level of each of the bands of the samples, which are spaced evenly in pitch
+// between the lowest and highest frequencies shown
+func spectrum(samples []float32, sampleRate, bands int) []float32 {
+	if bands <= 0 || sampleRate <= 0 {
+		return nil
+	}
+
+	n := len(samples)
+	x := make([]complex128, n)
+	for i, s := range samples {
+		// Hann window, so the edges of the buffer don't smear across the spectrum
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		x[i] = complex(float64(s)*w, 0)
+	}
+	fft(x)
+
+	binHz := float64(sampleRate) / float64(n)
+	high := min(spectrumHighHz, float64(sampleRate)/2)
+	ratio := math.Pow(high/spectrumLowHz, 1/float64(bands))
+
+	levels := make([]float32, bands)
+	lo := float64(spectrumLowHz)
+	for b := range levels {
+		hi := lo * ratio
+		first := int(lo / binHz)
+		last := max(int(hi/binHz), first+1)
+
+		var peak float64
+		for k := first; k < last && k < n/2; k++ {
+			peak = max(peak, cmplx.Abs(x[k]))
+		}
+		// a full scale sine, windowed, peaks at n/4
+		db := 20 * math.Log10(peak/(float64(n)/4)+1e-12)
+		levels[b] = float32(min(max((db-spectrumFloorDB)/-spectrumFloorDB, 0), 1))
+		lo = hi
+	}
+	return levels
+}
+
+// fft transforms the samples in place. The number of them must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package mixdown mixes premixes down to interleaved samples, as the output devices do, for the
+// parts of the player that work on the audio itself.
+package mixdown
+
+import (
+	"github.com/gotracker/playback/mixing"
+	"github.com/gotracker/playback/mixing/volume"
+	playbackOutput "github.com/gotracker/playback/output"
+)
+
+// Interleaved mixes the premix down to interleaved frames of the channels, where 1 is full scale,
+// reusing the buffer if it's big enough
+func Interleaved(buf []float32, premix *playbackOutput.PremixData, channels int) []float32 {
+	n := premix.SamplesLen * channels
+	if cap(buf) < n {
+		buf = make([]float32, n)
+	}
+	buf = buf[:n]
+	clear(buf)
+
+	for _, row := range premix.Data {
+		for _, cdata := range row {
+			if len(cdata.Data) == 0 {
+				continue
+			}
+			volMtx := cdata.PanMatrix.Apply(cdata.Volume)
+			for i, samp := range cdata.Data {
+				pos := cdata.Pos + i
+				if pos >= premix.SamplesLen {
+					break
+				}
+				out := volMtx.ApplyToMatrix(samp).Apply(premix.MixerVolume).ToChannels(channels)
+				for c := 0; c < channels && c < out.Channels; c++ {
+					buf[pos*channels+c] += float32(out.StaticMatrix[c])
+				}
+			}
+		}
+	}
+	return buf
+}
+
+// Channels mixes the premix down to the channels, as Interleaved does, returning the samples
+// separated by channel
+func Channels(premix *playbackOutput.PremixData, channels int) [][]volume.Volume {
+	buf := Interleaved(nil, premix, channels)
+	data := make([][]volume.Volume, channels)
+	for c := range data {
+		data[c] = make([]volume.Volume, premix.SamplesLen)
+		for i := range data[c] {
+			data[c][i] = volume.Volume(buf[i*channels+c])
+		}
+	}
+	return data
+}
+
+// Replace leaves the premix holding the interleaved frames of the channels in place of its own
+// data, as though they were its mix
+func Replace(premix *playbackOutput.PremixData, buf []float32, channels int) {
+	frames := len(buf) / channels
+	data := make(mixing.MixBuffer, frames)
+	for i := range data {
+		data[i].Channels = channels
+		for ch := 0; ch < channels; ch++ {
+			data[i].StaticMatrix[ch] = volume.Volume(buf[i*channels+ch])
+		}
+	}
+
+	premix.Data = []mixing.ChannelData{{{
+		Data:       data,
+		PanMatrix:  unityPan{channels: channels},
+		Volume:     1,
+		SamplesLen: frames,
+	}}}
+	premix.SamplesLen = frames
+	premix.MixerVolume = 1
+}
+
+// unityPan passes each channel of the mix straight through to the same channel of the output
+type unityPan struct {
+	channels int
+}
+
+func (p unityPan) Apply(vol volume.Volume) volume.Matrix {
+	m := volume.Matrix{
+		Channels: p.channels,
+	}
+	for i := 0; i < p.channels; i++ {
+		m.StaticMatrix[i] = vol
+	}
+	return m
+}
+
+func (p unityPan) ApplyToMatrix(mtx volume.Matrix) volume.Matrix {
+	return p.Apply(1).ApplyToMatrix(mtx)
+}
@@ -0,0 +1,477 @@
+package mpd
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+type commandFunc func(s *Server, cl *client, resp *response, args []string) error
+
+// commands are the MPD commands that are implemented. Song IDs are the same as song positions.
+var commands map[string]commandFunc
+
+func init() {
+	commands = map[string]commandFunc{
+		"add":                cmdAdd,
+		"addid":              cmdAddID,
+		"clear":              cmdClear,
+		"commands":           cmdCommands,
+		"currentsong":        cmdCurrentSong,
+		"decoders":           cmdDecoders,
+		"getvol":             cmdGetVol,
+		"listplaylists":      cmdNothing,
+		"lsinfo":             cmdLsInfo,
+		"next":               cmdNext,
+		"notcommands":        cmdNothing,
+		"outputs":            cmdOutputs,
+		"pause":              cmdPause,
+		"ping":               cmdNothing,
+		"play":               cmdPlay,
+		"playid":             cmdPlay,
+		"playlistid":         cmdPlaylistInfo,
+		"playlistinfo":       cmdPlaylistInfo,
+		"previous":           cmdPrevious,
+		"replay_gain_status": cmdReplayGainStatus,
+		"seek":               cmdSeek,
+		"seekcur":            cmdSeekCur,
+		"seekid":             cmdSeek,
+		"setvol":             cmdSetVol,
+		"stats":              cmdStats,
+		"status":             cmdStatus,
+		"stop":               cmdStop,
+		"tagtypes":           cmdTagTypes,
+		"urlhandlers":        cmdNothing,
+	}
+}
+
+func (s *Server) execute(cl *client, resp *response, command string, args []string) error {
+	fn, ok := commands[command]
+	if !ok {
+		return newAckError(ackErrorUnknown, "unknown command \"%s\"", command)
+	}
+	return fn(s, cl, resp, args)
+}
+
+func checkArgs(args []string, minArgs, maxArgs int) error {
+	switch {
+	case len(args) < minArgs:
+		return newAckError(ackErrorArg, "too few arguments")
+	case len(args) > maxArgs:
+		return newAckError(ackErrorArg, "too many arguments")
+	}
+	return nil
+}
+
+func parseInt(arg string) (int, error) {
+	v, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, newAckError(ackErrorArg, "integer expected: %s", arg)
+	}
+	return v, nil
+}
+
+// parseSongPos parses the position (or ID) of a song in the playlist
+func parseSongPos(arg string, length int) (int, error) {
+	pos, err := parseInt(arg)
+	if err != nil {
+		return 0, err
+	}
+	if pos < 0 || pos >= length {
+		return 0, newAckError(ackErrorArg, "bad song index")
+	}
+	return pos, nil
+}
+
+func parseSeconds(arg string) (time.Duration, error) {
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, newAckError(ackErrorArg, "number expected: %s", arg)
+	}
+	return time.Duration(v * float64(time.Second)), nil
+}
+
+func cmdNothing(s *Server, cl *client, resp *response, args []string) error {
+	return nil
+}
+
+func cmdCommands(s *Server, cl *client, resp *response, args []string) error {
+	names := []string{"close", "command_list_begin", "command_list_ok_begin", "command_list_end", "idle", "noidle"}
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		resp.add("command", name)
+	}
+	return nil
+}
+
+func cmdTagTypes(s *Server, cl *client, resp *response, args []string) error {
+	// the tags can't be chosen, so requests to change them are accepted and ignored
+	if len(args) > 0 {
+		return nil
+	}
+	for _, tag := range []string{"Artist", "Title", "Comment"} {
+		resp.add("tagtype", tag)
+	}
+	return nil
+}
+
+func cmdDecoders(s *Server, cl *client, resp *response, args []string) error {
+	resp.add("plugin", "gotracker")
+	for _, ext := range moduleExtensions {
+		resp.add("suffix", strings.TrimPrefix(ext, "."))
+	}
+	return nil
+}
+
+func cmdOutputs(s *Server, cl *client, resp *response, args []string) error {
+	resp.add("outputid", 0)
+	resp.add("outputname", "gotracker")
+	resp.add("plugin", "gotracker")
+	resp.add("outputenabled", 1)
+	return nil
+}
+
+func cmdReplayGainStatus(s *Server, cl *client, resp *response, args []string) error {
+	resp.add("replay_gain_mode", "off")
+	return nil
+}
+
+func cmdStats(s *Server, cl *client, resp *response, args []string) error {
+	resp.add("uptime", int(time.Since(s.started).Seconds()))
+	return nil
+}
+
+func mpdState(st play.Status) string {
+	switch st.State {
+	case play.ControllerStatePlaying.String():
+		return "play"
+	case play.ControllerStatePaused.String():
+		return "pause"
+	default:
+		return "stop"
+	}
+}
+
+func boolArg(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func cmdStatus(s *Server, cl *client, resp *response, args []string) error {
+	st := s.c.Status()
+	resp.add("volume", st.Volume)
+	resp.add("repeat", boolArg(st.Looping))
+	resp.add("random", 0)
+	resp.add("single", 0)
+	resp.add("consume", 0)
+	resp.add("playlist", st.PlaylistVersion+1)
+	resp.add("playlistlength", st.Length)
+	resp.add("state", mpdState(st))
+
+	if st.Index >= 0 && st.Index < st.Length {
+		resp.add("song", st.Index)
+		resp.add("songid", st.Index)
+		if next := st.Index + 1; next < st.Length {
+			resp.add("nextsong", next)
+			resp.add("nextsongid", next)
+		}
+	}
+
+	if st.Song != nil {
+		var duration time.Duration
+		if tags, err := s.lib.songTags(st.Song.Filepath); err == nil && tags.timing != nil {
+			duration = tags.timing.Duration
+		}
+		resp.add("time", fmt.Sprintf("%d:%d", int(st.Song.Elapsed), int(duration.Seconds())))
+		resp.add("elapsed", fmt.Sprintf("%.3f", st.Song.Elapsed))
+		if duration > 0 {
+			resp.add("duration", fmt.Sprintf("%.3f", duration.Seconds()))
+		}
+	}
+	return nil
+}
+
+// writeSong adds the song's tags to the response, along with its position in the playlist
+// (if it's in it)
+func (s *Server) writeSong(resp *response, song playlist.Song, pos int) {
+	resp.add("file", s.lib.uri(song.Filepath))
+
+	title := song.Title
+	tags, err := s.lib.songTags(song.Filepath)
+	if err == nil {
+		resp.add("Last-Modified", tags.modTime.UTC().Format(time.RFC3339))
+		if title == "" {
+			title = tags.title
+		}
+	}
+	if song.Artist != "" {
+		resp.add("Artist", song.Artist)
+	}
+	if title != "" {
+		resp.add("Title", title)
+	}
+	if err == nil {
+		if tags.format != "" {
+			resp.add("Comment", tags.format)
+		}
+		if tags.timing != nil {
+			resp.add("Time", int(math.Round(tags.timing.Duration.Seconds())))
+			resp.add("duration", fmt.Sprintf("%.3f", tags.timing.Duration.Seconds()))
+		}
+	}
+
+	if pos >= 0 {
+		resp.add("Pos", pos)
+		resp.add("Id", pos)
+	}
+}
+
+func cmdCurrentSong(s *Server, cl *client, resp *response, args []string) error {
+	st := s.c.Status()
+	if st.Index < 0 || st.Index >= st.Length {
+		return nil
+	}
+
+	songs := s.c.Songs()
+	if st.Index >= len(songs) {
+		return nil
+	}
+	s.writeSong(resp, songs[st.Index], st.Index)
+	return nil
+}
+
+func cmdPlaylistInfo(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return err
+	}
+
+	songs := s.c.Songs()
+	start, end := 0, len(songs)
+	if len(args) > 0 {
+		first, last, isRange := strings.Cut(args[0], ":")
+		var err error
+		if start, err = parseInt(first); err != nil {
+			return err
+		}
+		end = start + 1
+		if isRange && last != "" {
+			if end, err = parseInt(last); err != nil {
+				return err
+			}
+		} else if isRange {
+			end = len(songs)
+		}
+		if start < 0 || start >= len(songs) || end < start {
+			return newAckError(ackErrorArg, "bad song index")
+		}
+		end = min(end, len(songs))
+	}
+
+	for i := start; i < end; i++ {
+		s.writeSong(resp, songs[i], i)
+	}
+	return nil
+}
+
+func cmdLsInfo(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return err
+	}
+	var uri string
+	if len(args) > 0 {
+		uri = args[0]
+	}
+
+	fn, err := s.lib.resolve(uri)
+	if err != nil {
+		return err
+	}
+	if isModule(fn) {
+		if _, err := s.lib.songTags(fn); err != nil {
+			return newAckError(ackErrorNoExist, "no such song: %s", uri)
+		}
+		s.writeSong(resp, playlist.Song{Filepath: fn}, -1)
+		return nil
+	}
+
+	entries, err := s.lib.list(uri)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.isDir {
+			resp.add("directory", e.uri)
+			resp.add("Last-Modified", e.modTime.UTC().Format(time.RFC3339))
+			continue
+		}
+		s.writeSong(resp, playlist.Song{Filepath: e.path}, -1)
+	}
+	return nil
+}
+
+func cmdAdd(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return err
+	}
+	songs, err := s.lib.songs(args[0])
+	if err != nil {
+		return err
+	}
+	s.c.Enqueue(songs...)
+	return nil
+}
+
+func cmdAddID(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return newAckError(ackErrorArg, "songs can only be added to the end of the playlist")
+	}
+
+	songs, err := s.lib.songs(args[0])
+	if err != nil {
+		return err
+	}
+	if len(songs) != 1 {
+		return newAckError(ackErrorNoExist, "not a song: %s", args[0])
+	}
+	resp.add("Id", s.c.Enqueue(songs...)-1)
+	return nil
+}
+
+func cmdClear(s *Server, cl *client, resp *response, args []string) error {
+	return s.c.Clear()
+}
+
+func cmdPlay(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return s.c.Play(-1)
+	}
+
+	pos, err := parseSongPos(args[0], s.c.Len())
+	if err != nil {
+		return err
+	}
+	return s.c.Play(pos)
+}
+
+func cmdPause(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return err
+	}
+
+	pause := s.c.Status().State == play.ControllerStatePlaying.String()
+	if len(args) > 0 {
+		switch args[0] {
+		case "0":
+			pause = false
+		case "1":
+			pause = true
+		default:
+			return newAckError(ackErrorArg, "boolean (0/1) expected: %s", args[0])
+		}
+	}
+
+	if pause {
+		return s.c.Pause()
+	}
+	return s.c.Resume()
+}
+
+func cmdStop(s *Server, cl *client, resp *response, args []string) error {
+	return s.c.Stop()
+}
+
+func cmdNext(s *Server, cl *client, resp *response, args []string) error {
+	return s.c.Next()
+}
+
+func cmdPrevious(s *Server, cl *client, resp *response, args []string) error {
+	return s.c.Previous()
+}
+
+func cmdSeek(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return err
+	}
+
+	st := s.c.Status()
+	pos, err := parseSongPos(args[0], st.Length)
+	if err != nil {
+		return err
+	}
+	d, err := parseSeconds(args[1])
+	if err != nil {
+		return err
+	}
+
+	if st.Song == nil || pos != st.Index {
+		return newAckError(ackErrorArg, "seeking is only supported in the current song")
+	}
+	return s.seek(st, d)
+}
+
+func cmdSeekCur(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return err
+	}
+
+	st := s.c.Status()
+	if st.Song == nil {
+		return newAckError(ackErrorArg, "not playing")
+	}
+
+	d, err := parseSeconds(args[0])
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+		d += time.Duration(st.Song.Elapsed * float64(time.Second))
+	}
+	return s.seek(st, max(d, 0))
+}
+
+func (s *Server) seek(st play.Status, d time.Duration) error {
+	timing, err := s.lib.timing(st.Song.Filepath)
+	if err != nil {
+		return err
+	}
+	if err := s.c.SeekTime(d, timing); err != nil {
+		return newAckError(ackErrorArg, "%v", err)
+	}
+	return nil
+}
+
+func cmdSetVol(s *Server, cl *client, resp *response, args []string) error {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return err
+	}
+	v, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	if err := s.c.SetVolume(v); err != nil {
+		return newAckError(ackErrorArg, "%v", err)
+	}
+	return nil
+}
+
+func cmdGetVol(s *Server, cl *client, resp *response, args []string) error {
+	resp.add("volume", s.c.Status().Volume)
+	return nil
+}
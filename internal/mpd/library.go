@@ -0,0 +1,293 @@
+package mpd
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotracker/playback/format"
+	"github.com/gotracker/playback/format/it"
+	"github.com/gotracker/playback/format/mod"
+	"github.com/gotracker/playback/format/s3m"
+	"github.com/gotracker/playback/format/xm"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+// moduleExtensions are the file extensions of the modules that are listed in the library
+var moduleExtensions = []string{".it", ".mod", ".s3m", ".xm"}
+
+// formatNames describes the formats of the modules, reported in the Comment tag
+var formatNames = map[format.Format]string{
+	s3m.S3M: "S3M - ScreamTracker 3",
+	mod.MOD: "MOD - Protracker/Fasttracker/Startrekker",
+	xm.XM:   "XM - Fasttracker II",
+	it.IT:   "IT - Impulse Tracker",
+}
+
+// songTags is what is known about a module file
+type songTags struct {
+	modTime time.Time
+	title   string
+	format  string
+	timing  *play.SongTiming // nil until the song has been timed
+}
+
+// library is the directory of modules that clients browse, along with the tags of the modules in it
+type library struct {
+	root     string
+	features []playbackFeature.Feature
+	settings *play.Settings
+	logger   logging.Log
+
+	mu      sync.Mutex
+	tags    map[string]*songTags
+	timeCh  chan string
+	pending map[string]struct{}
+	closed  bool
+}
+
+func newLibrary(root string, features []playbackFeature.Feature, settings *play.Settings, logger logging.Log) (*library, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: root, Err: errors.New("not a directory")}
+	}
+
+	l := library{
+		root:     root,
+		features: features,
+		settings: settings,
+		logger:   logger,
+		tags:     make(map[string]*songTags),
+		timeCh:   make(chan string, 1024),
+		pending:  make(map[string]struct{}),
+	}
+	return &l, nil
+}
+
+// runTimer times the songs queued by requestTiming, one at a time, until the channel is closed
+func (l *library) runTimer() {
+	for fn := range l.timeCh {
+		if _, err := l.timing(fn); err != nil {
+			l.logger.Printf("Could not time %q: %v\n", fn, err)
+		}
+		l.mu.Lock()
+		delete(l.pending, fn)
+		l.mu.Unlock()
+	}
+}
+
+func (l *library) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.timeCh)
+	}
+}
+
+// resolve returns the path of the file or directory referred to by the URI
+func (l *library) resolve(uri string) (string, error) {
+	uri = strings.Trim(uri, "/")
+	if uri == "" {
+		return l.root, nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(uri)) {
+		return "", newAckError(ackErrorNoExist, "no such file or directory: %s", uri)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(uri)), nil
+}
+
+// uri returns the URI of the file, which is its absolute path if it's outside of the library
+func (l *library) uri(fn string) string {
+	rel, err := filepath.Rel(l.root, fn)
+	if err != nil || !filepath.IsLocal(rel) {
+		return fn
+	}
+	return filepath.ToSlash(rel)
+}
+
+func isModule(name string) bool {
+	return slices.Contains(moduleExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// libraryEntry is an item of a directory listing
+type libraryEntry struct {
+	uri     string
+	path    string
+	isDir   bool
+	modTime time.Time
+}
+
+// list returns the subdirectories and modules in the directory at the URI
+func (l *library) list(uri string) ([]libraryEntry, error) {
+	dir, err := l.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, newAckError(ackErrorNoExist, "no such directory: %s", uri)
+		}
+		return nil, err
+	}
+
+	var entries []libraryEntry
+	for _, de := range des {
+		if strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, de.Name()))
+		if err != nil {
+			continue
+		}
+		if !fi.IsDir() && !isModule(de.Name()) {
+			continue
+		}
+		entries = append(entries, libraryEntry{
+			uri:     path.Join(strings.Trim(uri, "/"), de.Name()),
+			path:    filepath.Join(dir, de.Name()),
+			isDir:   fi.IsDir(),
+			modTime: fi.ModTime(),
+		})
+	}
+	return entries, nil
+}
+
+// songs returns the modules at the URI, which are all of the modules under it if it's a directory
+func (l *library) songs(uri string) ([]playlist.Song, error) {
+	fn, err := l.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(fn)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, newAckError(ackErrorNoExist, "no such file or directory: %s", uri)
+		}
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return []playlist.Song{{Filepath: fn}}, nil
+	}
+
+	var songs []playlist.Song
+	err = filepath.WalkDir(fn, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != fn {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && isModule(d.Name()) {
+			songs = append(songs, playlist.Song{Filepath: p})
+		}
+		return nil
+	})
+	return songs, err
+}
+
+// songTags returns the tags of the module, loading it if they aren't known yet. The module is
+// queued to be timed if it hasn't been yet.
+func (l *library) songTags(fn string) (songTags, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return songTags{}, err
+	}
+
+	l.mu.Lock()
+	t, ok := l.tags[fn]
+	if ok && t.modTime.Equal(fi.ModTime()) {
+		tags := *t
+		l.mu.Unlock()
+		if tags.timing == nil {
+			l.requestTiming(fn)
+		}
+		return tags, nil
+	}
+	l.mu.Unlock()
+
+	songData, songFmt, err := format.Load(fn, l.features...)
+	if err != nil {
+		return songTags{}, err
+	}
+
+	tags := songTags{
+		modTime: fi.ModTime(),
+		title:   strings.TrimSpace(songData.GetName()),
+		format:  formatNames[songFmt],
+	}
+
+	l.mu.Lock()
+	l.tags[fn] = &tags
+	l.mu.Unlock()
+
+	l.requestTiming(fn)
+	return tags, nil
+}
+
+// requestTiming queues the module to be timed in the background
+func (l *library) requestTiming(fn string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.pending[fn]; ok || l.closed {
+		return
+	}
+	select {
+	case l.timeCh <- fn:
+		l.pending[fn] = struct{}{}
+	default:
+		// the queue is full - it'll be requested again the next time the song is listed
+	}
+}
+
+// timing returns the timing of the module, timing it if it hasn't been already
+func (l *library) timing(fn string) (*play.SongTiming, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	if t, ok := l.tags[fn]; ok && t.timing != nil && t.modTime.Equal(fi.ModTime()) {
+		l.mu.Unlock()
+		return t.timing, nil
+	}
+	l.mu.Unlock()
+
+	timing, err := play.MeasureSong(&playlist.Song{Filepath: fn}, l.features, l.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := l.tags[fn]; ok && t.modTime.Equal(fi.ModTime()) {
+		t.timing = timing
+	}
+	return timing, nil
+}
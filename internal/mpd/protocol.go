@@ -0,0 +1,110 @@
+// Package mpd implements a subset of the Music Player Daemon protocol on top of a play.Controller,
+// so that existing MPD clients can browse a directory of modules and control their playback.
+package mpd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// protocolVersion is the version of the MPD protocol announced to clients
+const protocolVersion = "0.21.0"
+
+// The error codes of the MPD protocol
+const (
+	ackErrorNotList = 1
+	ackErrorArg     = 2
+	ackErrorUnknown = 5
+	ackErrorNoExist = 50
+	ackErrorSystem  = 52
+)
+
+// ackError is an error reported to the client with an ACK line
+type ackError struct {
+	code int
+	msg  string
+}
+
+func (e *ackError) Error() string {
+	return e.msg
+}
+
+func newAckError(code int, format string, args ...any) error {
+	return &ackError{
+		code: code,
+		msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// formatAck formats the error as the ACK line for the command at the index of a command list
+func formatAck(err error, listNum int, command string) string {
+	code := ackErrorSystem
+	var ae *ackError
+	if errors.As(err, &ae) {
+		code = ae.code
+	}
+	msg := strings.ReplaceAll(err.Error(), "\n", " ")
+	return fmt.Sprintf("ACK [%d@%d] {%s} %s\n", code, listNum, command, msg)
+}
+
+// parseLine splits a request line into its command and arguments. Arguments may be quoted,
+// in which case backslashes escape the character that follows them.
+func parseLine(line string) (string, []string, error) {
+	var (
+		args []string
+		arg  strings.Builder
+	)
+
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		arg.Reset()
+		if line[i] == '"' {
+			i++
+			closed := false
+			for i < len(line) {
+				ch := line[i]
+				i++
+				if ch == '"' {
+					closed = true
+					break
+				}
+				if ch == '\\' && i < len(line) {
+					ch = line[i]
+					i++
+				}
+				arg.WriteByte(ch)
+			}
+			if !closed {
+				return "", nil, newAckError(ackErrorArg, "missing closing '\"'")
+			}
+		} else {
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				arg.WriteByte(line[i])
+				i++
+			}
+		}
+		args = append(args, arg.String())
+	}
+
+	if len(args) == 0 {
+		return "", nil, newAckError(ackErrorUnknown, "no command given")
+	}
+	return args[0], args[1:], nil
+}
+
+// response collects the lines of the answer to a command
+type response struct {
+	strings.Builder
+}
+
+func (r *response) add(key string, value any) {
+	fmt.Fprintf(r, "%s: %v\n", key, value)
+}
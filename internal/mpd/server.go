@@ -0,0 +1,317 @@
+package mpd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	playbackFeature "github.com/gotracker/playback/player/feature"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/play"
+)
+
+// maxRequestSize is the longest request line that will be accepted
+const maxRequestSize = 64 * 1024
+
+// Config is the configuration of an MPD server
+type Config struct {
+	Listen   string // address to listen on
+	MusicDir string // directory of modules that clients can browse
+	Features []playbackFeature.Feature
+	Settings *play.Settings
+}
+
+// Server answers MPD clients on behalf of a controller
+type Server struct {
+	c       *play.Controller
+	lib     *library
+	ln      net.Listener
+	logger  logging.Log
+	started time.Time
+
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// Listen starts listening for MPD clients
+func Listen(cfg Config, c *play.Controller, logger logging.Log) (*Server, error) {
+	lib, err := newLibrary(cfg.MusicDir, cfg.Features, cfg.Settings, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{
+		c:       c,
+		lib:     lib,
+		ln:      ln,
+		logger:  logger,
+		started: time.Now(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	go lib.runTimer()
+	return &s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve handles clients until the context is done
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.ln.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	defer s.wg.Wait()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			if err := s.handle(conn); err != nil && err != io.EOF {
+				s.logger.Printf("MPD client %s: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Close stops listening for clients
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.lib.close()
+	return err
+}
+
+// client is the state of a connection
+type client struct {
+	w       *bufio.Writer
+	lines   <-chan string
+	sub     *play.Subscription
+	pending play.Change // changes that haven't been reported by idle yet
+	closing bool
+}
+
+func (s *Server) handle(conn net.Conn) error {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 0, 4096), maxRequestSize)
+		for scanner.Scan() {
+			lines <- strings.TrimRight(scanner.Text(), "\r")
+		}
+		readErr <- scanner.Err()
+	}()
+
+	cl := client{
+		w:     bufio.NewWriter(conn),
+		lines: lines,
+		sub:   s.c.Subscribe(),
+	}
+	defer cl.sub.Close()
+	defer func() {
+		// unblock the reader if we're the ones who are stopping
+		conn.Close()
+		for range lines {
+		}
+	}()
+
+	fmt.Fprintf(cl.w, "OK MPD %s\n", protocolVersion)
+	if err := cl.w.Flush(); err != nil {
+		return err
+	}
+
+	for !cl.closing {
+		line, ok := <-lines
+		if !ok {
+			if err := <-readErr; err != nil {
+				return err
+			}
+			return io.EOF
+		}
+
+		if err := s.handleLine(&cl, line); err != nil {
+			return err
+		}
+		if err := cl.w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleLine runs a command (or a command list, which starts with the line), writing the response
+func (s *Server) handleLine(cl *client, line string) error {
+	command, args, err := parseLine(line)
+	if err != nil {
+		cl.w.WriteString(formatAck(err, 0, ""))
+		return nil
+	}
+
+	switch command {
+	case "command_list_begin", "command_list_ok_begin":
+		return s.handleCommandList(cl, command == "command_list_ok_begin")
+	case "command_list_end":
+		cl.w.WriteString(formatAck(newAckError(ackErrorNotList, "not in command list mode"), 0, command))
+		return nil
+	case "idle":
+		return s.idle(cl, args)
+	case "noidle":
+		// not idle - nothing to cancel
+		return nil
+	case "close":
+		cl.closing = true
+		return nil
+	}
+
+	var resp response
+	if err := s.execute(cl, &resp, command, args); err != nil {
+		cl.w.WriteString(resp.String())
+		cl.w.WriteString(formatAck(err, 0, command))
+		return nil
+	}
+	cl.w.WriteString(resp.String())
+	cl.w.WriteString("OK\n")
+	return nil
+}
+
+// handleCommandList collects the commands up to command_list_end and runs them, stopping at the
+// first one that fails
+func (s *Server) handleCommandList(cl *client, listOK bool) error {
+	var list []string
+	for {
+		line, ok := <-cl.lines
+		if !ok {
+			return io.EOF
+		}
+		if strings.TrimSpace(line) == "command_list_end" {
+			break
+		}
+		list = append(list, line)
+	}
+
+	for i, line := range list {
+		command, args, err := parseLine(line)
+		if err == nil {
+			switch command {
+			case "idle", "noidle", "close", "command_list_begin", "command_list_ok_begin":
+				err = newAckError(ackErrorArg, "%s is not allowed in a command list", command)
+			}
+		}
+
+		var resp response
+		if err == nil {
+			err = s.execute(cl, &resp, command, args)
+		}
+		cl.w.WriteString(resp.String())
+		if err != nil {
+			cl.w.WriteString(formatAck(err, i, command))
+			return nil
+		}
+		if listOK {
+			cl.w.WriteString("list_OK\n")
+		}
+	}
+	cl.w.WriteString("OK\n")
+	return nil
+}
+
+// idle waits for a change to one of the subsystems (any of them, if none are given), or for the
+// client to send noidle
+func (s *Server) idle(cl *client, args []string) error {
+	var mask play.Change
+	for _, name := range args {
+		sub, ok := subsystemsByName[name]
+		if !ok {
+			cl.w.WriteString(formatAck(newAckError(ackErrorArg, "unrecognized idle event: %s", name), 0, "idle"))
+			return nil
+		}
+		mask |= sub
+	}
+	if mask == 0 {
+		mask = allSubsystems
+	}
+
+	if err := cl.w.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		cl.pending |= cl.sub.Take()
+		if changed := cl.pending & mask; changed != 0 {
+			cl.pending &^= changed
+			writeChanges(cl.w, changed)
+			cl.w.WriteString("OK\n")
+			return nil
+		}
+
+		select {
+		case <-cl.sub.Changed():
+		case line, ok := <-cl.lines:
+			if !ok {
+				return io.EOF
+			}
+			if strings.TrimSpace(line) != "noidle" {
+				// nothing else may be sent while idle
+				cl.closing = true
+				return nil
+			}
+			cl.w.WriteString("OK\n")
+			return nil
+		}
+	}
+}
+
+// subsystemsByName maps the names of MPD's idle subsystems onto the changes reported by the controller
+var subsystemsByName = map[string]play.Change{
+	"player":   play.ChangePlayer,
+	"mixer":    play.ChangeMixer,
+	"playlist": play.ChangePlaylist,
+}
+
+const allSubsystems = play.ChangePlayer | play.ChangeMixer | play.ChangePlaylist
+
+func writeChanges(w io.StringWriter, changed play.Change) {
+	for _, name := range []string{"player", "mixer", "playlist"} {
+		if changed&subsystemsByName[name] != 0 {
+			w.WriteString("changed: " + name + "\n")
+		}
+	}
+}
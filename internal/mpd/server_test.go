@@ -0,0 +1,303 @@
+package mpd
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		command string
+		args    []string
+		err     string
+	}{
+		{line: "status", command: "status"},
+		{line: "  play\t 3 ", command: "play", args: []string{"3"}},
+		{line: `lsinfo "dir with spaces/song.mod"`, command: "lsinfo", args: []string{"dir with spaces/song.mod"}},
+		{line: `add "say \"hi\"\\.mod"`, command: "add", args: []string{`say "hi"\.mod`}},
+		{line: `add ""`, command: "add", args: []string{""}},
+		{line: `add "a"b`, command: "add", args: []string{"a", "b"}},
+		{line: `add "unterminated`, err: `missing closing '"'`},
+		{line: `add "trailing\`, err: `missing closing '"'`},
+		{line: "   ", err: "no command given"},
+	}
+
+	for _, tt := range tests {
+		command, args, err := parseLine(tt.line)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseLine(%q): got error %v, expected %q", tt.line, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseLine(%q): %v", tt.line, err)
+			continue
+		}
+		if command != tt.command || !slices.Equal(args, tt.args) {
+			t.Errorf("parseLine(%q): got %q %q, expected %q %q", tt.line, command, args, tt.command, tt.args)
+		}
+	}
+}
+
+// testMusic is the music directory served in the tests, filled from the repository's test modules
+var testMusic = map[string]string{
+	"a/PeriodLimit.s3m":       "PeriodLimit.s3m",
+	"a/VibratoTypeChange.s3m": "VibratoTypeChange.s3m",
+	"Porta-LinkMem.xm":        "Porta-LinkMem.xm",
+	".hidden/PeriodLimit.s3m": "PeriodLimit.s3m",
+}
+
+// startServer starts a server on a music directory of testMusic, with an empty playlist
+func startServer(t *testing.T) *Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range testMusic {
+		data, err := os.ReadFile(filepath.Join("..", "..", "test", src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a module"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &logging.Squelchable{Writer: io.Discard}
+	settings := &play.Settings{}
+	c := play.NewController(playlist.New(), nil, settings, deviceCommon.Settings{}, logger)
+	s, err := Listen(Config{
+		Listen:   "127.0.0.1:0",
+		MusicDir: dir,
+		Settings: settings,
+	}, c, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		s.Close()
+	})
+	return s
+}
+
+// testClient is a connection to the server under test
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, s *Server) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	c := &testClient{
+		t:    t,
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+	if welcome := c.readLine(); !strings.HasPrefix(welcome, "OK MPD ") {
+		t.Fatalf("unexpected welcome: %q", welcome)
+	}
+	return c
+}
+
+func (c *testClient) send(lines ...string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, strings.Join(lines, "\n")+"\n"); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) readLine() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// response reads the lines of a response, up to and including its OK or ACK line
+func (c *testClient) response() []string {
+	c.t.Helper()
+	var lines []string
+	for {
+		line := c.readLine()
+		lines = append(lines, line)
+		if line == "OK" || strings.HasPrefix(line, "ACK ") {
+			return lines
+		}
+	}
+}
+
+// command sends the command, returning the lines of its response
+func (c *testClient) command(line string) []string {
+	c.t.Helper()
+	c.send(line)
+	return c.response()
+}
+
+// values returns the values of the key in the response lines
+func values(lines []string, key string) []string {
+	var v []string
+	for _, line := range lines {
+		if k, value, ok := strings.Cut(line, ": "); ok && k == key {
+			v = append(v, value)
+		}
+	}
+	return v
+}
+
+func expectLines(t *testing.T, what string, got, expected []string) {
+	t.Helper()
+	if !slices.Equal(got, expected) {
+		t.Errorf("%s: got %q, expected %q", what, got, expected)
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	c.send("command_list_ok_begin", "ping", "setvol 40", "getvol", "command_list_end")
+	expectLines(t, "command_list_ok_begin", c.response(), []string{"list_OK", "list_OK", "volume: 40", "list_OK", "OK"})
+
+	c.send("command_list_begin", "ping", "getvol", "command_list_end")
+	expectLines(t, "command_list_begin", c.response(), []string{"volume: 40", "OK"})
+
+	// the list stops at the first command that fails, which is reported with its index
+	c.send("command_list_ok_begin", "ping", "bogus", "setvol 10", "command_list_end")
+	expectLines(t, "failing command list", c.response(), []string{"list_OK", `ACK [5@1] {bogus} unknown command "bogus"`})
+	expectLines(t, "volume after failing list", c.command("getvol"), []string{"volume: 40", "OK"})
+
+	c.send("command_list_begin", "setvol 10", "idle", "command_list_end")
+	expectLines(t, "idle in a command list", c.response(), []string{"ACK [2@1] {idle} idle is not allowed in a command list"})
+
+	expectLines(t, "command_list_end", c.command("command_list_end"), []string{"ACK [1@0] {command_list_end} not in command list mode"})
+}
+
+func TestIdle(t *testing.T) {
+	s := startServer(t)
+	idler := dial(t, s)
+	c := dial(t, s)
+
+	idler.send("idle playlist")
+	expectLines(t, "add", c.command("add Porta-LinkMem.xm"), []string{"OK"})
+	expectLines(t, "idle playlist", idler.response(), []string{"changed: playlist", "OK"})
+
+	// a change made while the client wasn't idle is reported by its next idle
+	expectLines(t, "setvol", c.command("setvol 50"), []string{"OK"})
+	expectLines(t, "idle", idler.command("idle"), []string{"changed: mixer", "OK"})
+
+	// changes to other subsystems don't end the idle, but noidle does
+	idler.send("idle player")
+	expectLines(t, "setvol", c.command("setvol 60"), []string{"OK"})
+	idler.send("noidle")
+	expectLines(t, "noidle", idler.response(), []string{"OK"})
+	expectLines(t, "idle mixer", idler.command("idle mixer"), []string{"changed: mixer", "OK"})
+
+	expectLines(t, "bad idle", idler.command("idle bogus"), []string{"ACK [2@0] {idle} unrecognized idle event: bogus"})
+}
+
+func TestPlaylistInfo(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	// the whole library, in order
+	expectLines(t, "add", c.command(`add ""`), []string{"OK"})
+	all := []string{"Porta-LinkMem.xm", "a/PeriodLimit.s3m", "a/VibratoTypeChange.s3m"}
+
+	tests := []struct {
+		args     string
+		expected []string
+	}{
+		{"", all},
+		{" 1", all[1:2]},
+		{" 1:", all[1:]},
+		{" 0:2", all[:2]},
+		{" 1:9", all[1:]},
+		{" 2:2", nil},
+	}
+	for _, tt := range tests {
+		resp := c.command("playlistinfo" + tt.args)
+		if last := resp[len(resp)-1]; last != "OK" {
+			t.Errorf("playlistinfo%s: %s", tt.args, last)
+			continue
+		}
+		expectLines(t, "playlistinfo"+tt.args, values(resp, "file"), tt.expected)
+		for i, pos := range values(resp, "Pos") {
+			if pos != values(resp, "Id")[i] {
+				t.Errorf("playlistinfo%s: position %s has ID %s", tt.args, pos, values(resp, "Id")[i])
+			}
+		}
+	}
+
+	for _, args := range []string{"3", "-1", "2:1", "x"} {
+		resp := c.command("playlistinfo " + args)
+		if len(resp) != 1 || !strings.HasPrefix(resp[0], "ACK [2@0] {playlistinfo} ") {
+			t.Errorf("playlistinfo %s: got %q, expected an argument error", args, resp)
+		}
+	}
+}
+
+func TestLsInfo(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	resp := c.command("lsinfo")
+	expectLines(t, "lsinfo directories", values(resp, "directory"), []string{"a"})
+	expectLines(t, "lsinfo files", values(resp, "file"), []string{"Porta-LinkMem.xm"})
+
+	resp = c.command(`lsinfo "/a/"`)
+	expectLines(t, "lsinfo a", values(resp, "file"), []string{"a/PeriodLimit.s3m", "a/VibratoTypeChange.s3m"})
+
+	resp = c.command("lsinfo a/PeriodLimit.s3m")
+	expectLines(t, "lsinfo of a song", values(resp, "file"), []string{"a/PeriodLimit.s3m"})
+
+	// nothing outside of the music directory can be listed or added
+	for _, uri := range []string{"..", "a/../..", "../" + filepath.Base(os.TempDir()), "a/../../a"} {
+		for _, command := range []string{"lsinfo", "add"} {
+			resp := c.command(command + ` "` + uri + `"`)
+			expected := "ACK [50@0] {" + command + "} no such file or directory: " + uri
+			expectLines(t, command+" "+uri, resp, []string{expected})
+		}
+	}
+
+	expectLines(t, "lsinfo of a missing directory", c.command("lsinfo b"), []string{"ACK [50@0] {lsinfo} no such directory: b"})
+	expectLines(t, "playlist after failed adds", c.command("playlistinfo"), []string{"OK"})
+}
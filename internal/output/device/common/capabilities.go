@@ -0,0 +1,101 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Capabilities describes the output formats supported by a device
+type Capabilities struct {
+	MinSampleRate int
+	MaxSampleRate int
+	BitsPerSample []int // in ascending order
+	Channels      []int // in ascending order
+}
+
+// Union returns the capabilities supported by either of the two capabilities
+func (c Capabilities) Union(o Capabilities) Capabilities {
+	u := Capabilities{
+		MinSampleRate: min(c.MinSampleRate, o.MinSampleRate),
+		MaxSampleRate: max(c.MaxSampleRate, o.MaxSampleRate),
+		BitsPerSample: slices.Clone(c.BitsPerSample),
+		Channels:      slices.Clone(c.Channels),
+	}
+	if c.MaxSampleRate == 0 {
+		u.MinSampleRate = o.MinSampleRate
+	} else if o.MaxSampleRate == 0 {
+		u.MinSampleRate = c.MinSampleRate
+	}
+
+	for _, b := range o.BitsPerSample {
+		if !slices.Contains(u.BitsPerSample, b) {
+			u.BitsPerSample = append(u.BitsPerSample, b)
+		}
+	}
+	slices.Sort(u.BitsPerSample)
+
+	for _, ch := range o.Channels {
+		if !slices.Contains(u.Channels, ch) {
+			u.Channels = append(u.Channels, ch)
+		}
+	}
+	slices.Sort(u.Channels)
+	return u
+}
+
+// Negotiate adjusts the format in the settings to the closest one supported.
+// It returns a description of each adjustment made - or, if the settings ask
+// for a strict format, an error describing the first unsupported value.
+func (c Capabilities) Negotiate(settings *Settings) ([]string, error) {
+	var adjustments []string
+
+	if rate := settings.SamplesPerSecond; rate < c.MinSampleRate || rate > c.MaxSampleRate {
+		supported := fmt.Sprintf("%d-%dHz", c.MinSampleRate, c.MaxSampleRate)
+		if settings.StrictFormat {
+			return nil, fmt.Errorf("sample rate of %dHz is not supported (supported: %s)", rate, supported)
+		}
+		settings.SamplesPerSecond = min(max(rate, c.MinSampleRate), c.MaxSampleRate)
+		adjustments = append(adjustments, fmt.Sprintf("sample rate %dHz -> %dHz (supported: %s)", rate, settings.SamplesPerSecond, supported))
+	}
+
+	if bits := settings.BitsPerSample; !slices.Contains(c.BitsPerSample, bits) {
+		supported := joinInts(c.BitsPerSample)
+		if settings.StrictFormat || len(c.BitsPerSample) == 0 {
+			return nil, fmt.Errorf("%d bits per sample is not supported (supported: %s)", bits, supported)
+		}
+		settings.BitsPerSample = closestSupported(c.BitsPerSample, bits)
+		adjustments = append(adjustments, fmt.Sprintf("bits per sample %d -> %d (supported: %s)", bits, settings.BitsPerSample, supported))
+	}
+
+	if channels := settings.Channels; !slices.Contains(c.Channels, channels) {
+		supported := joinInts(c.Channels)
+		if settings.StrictFormat || len(c.Channels) == 0 {
+			return nil, fmt.Errorf("%d channels is not supported (supported: %s)", channels, supported)
+		}
+		settings.Channels = closestSupported(c.Channels, channels)
+		adjustments = append(adjustments, fmt.Sprintf("channels %d -> %d (supported: %s)", channels, settings.Channels, supported))
+	}
+
+	return adjustments, nil
+}
+
+// closestSupported returns the smallest supported value that is at least the requested
+// value, so nothing is lost - or the largest supported value, if there isn't one
+func closestSupported(supported []int, value int) int {
+	for _, s := range supported {
+		if s >= value {
+			return s
+		}
+	}
+	return supported[len(supported)-1]
+}
+
+func joinInts(values []int) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = strconv.Itoa(v)
+	}
+	return strings.Join(strs, ", ")
+}
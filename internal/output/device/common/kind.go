@@ -10,4 +10,6 @@ const (
 	KindFile
 	// KindSoundCard is an active sound playback device (e.g.: a sound card attached to speakers)
 	KindSoundCard
+	// KindNetwork is a device that streams to listeners over the network (e.g.: an HTTP audio stream)
+	KindNetwork
 )
@@ -0,0 +1,14 @@
+package common
+
+// Metadata is the description of what's currently being played
+type Metadata struct {
+	Title  string
+	Artist string
+}
+
+// Sink is an output target (e.g.: a specific sound card) provided by a device
+type Sink struct {
+	ID          string
+	Description string
+	Default     bool
+}
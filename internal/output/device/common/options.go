@@ -0,0 +1,196 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heucuva/optional"
+
+	"github.com/gotracker/gotracker/internal/output/device/dither"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
+)
+
+// OptionType is an enumeration of the types of value a device option accepts
+type OptionType int
+
+const (
+	// OptionTypeString is a free-form string value
+	OptionTypeString = OptionType(iota)
+	// OptionTypeInt is an integer value
+	OptionTypeInt
+	// OptionTypeBool is a boolean value
+	OptionTypeBool
+	// OptionTypeDuration is a duration value (e.g.: 50ms)
+	OptionTypeDuration
+)
+
+func (t OptionType) String() string {
+	switch t {
+	case OptionTypeString:
+		return "string"
+	case OptionTypeInt:
+		return "int"
+	case OptionTypeBool:
+		return "bool"
+	case OptionTypeDuration:
+		return "duration"
+	default:
+		return "unknown"
+	}
+}
+
+// OptionSpec describes an option accepted by a device
+type OptionSpec struct {
+	Name    string
+	Type    OptionType
+	Default string
+	Usage   string
+	Choices []string            // if not empty, the only values accepted
+	Min     optional.Value[int] // if set, the minimum value accepted by an int option
+	Max     optional.Value[int] // if set, the maximum value accepted by an int option
+}
+
+// CommonOptions are the options accepted by every device
+var CommonOptions = []OptionSpec{
+	{Name: "channels", Type: OptionTypeInt, Usage: "number of output channels (overrides --channels for this device)", Min: optional.NewValue(1)},
+	{Name: "bits", Type: OptionTypeInt, Usage: "bits per sample (overrides --bits-per-sample for this device)", Choices: []string{"8", "16", "24", "32"}},
+	{Name: "upmix", Type: OptionTypeString, Usage: "surround upmix strategy (overrides --upmix for this device)", Choices: surround.StrategyNames},
+	{Name: "dither", Type: OptionTypeString, Usage: "dither (overrides --dither for this device)", Choices: dither.ModeNames},
+}
+
+// Validate checks that the value is acceptable for the option
+func (s OptionSpec) Validate(value string) error {
+	switch s.Type {
+	case OptionTypeInt:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("option %q expects an integer value - got %q", s.Name, value)
+		}
+		if min, ok := s.Min.Get(); ok && v < min {
+			return fmt.Errorf("option %q must be at least %d - got %d", s.Name, min, v)
+		}
+		if max, ok := s.Max.Get(); ok && v > max {
+			return fmt.Errorf("option %q must be at most %d - got %d", s.Name, max, v)
+		}
+	case OptionTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("option %q expects a boolean value - got %q", s.Name, value)
+		}
+	case OptionTypeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("option %q expects a duration value (e.g.: 50ms) - got %q", s.Name, value)
+		}
+	}
+
+	if len(s.Choices) > 0 && !slices.Contains(s.Choices, value) {
+		return fmt.Errorf("option %q must be one of {%s} - got %q", s.Name, strings.Join(s.Choices, ", "), value)
+	}
+	return nil
+}
+
+// Options are the option values provided to a device
+type Options struct {
+	specs  []OptionSpec
+	values map[string]string
+}
+
+// ParseOptions validates the provided values against the option specifications
+func ParseOptions(specs []OptionSpec, values url.Values) (Options, error) {
+	o := Options{
+		specs:  specs,
+		values: make(map[string]string),
+	}
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec, ok := o.getSpec(name)
+		if !ok {
+			var accepted []string
+			for _, s := range specs {
+				accepted = append(accepted, s.Name)
+			}
+			if len(accepted) == 0 {
+				return Options{}, fmt.Errorf("unknown option %q - device accepts no options", name)
+			}
+			return Options{}, fmt.Errorf("unknown option %q - device accepts {%s}", name, strings.Join(accepted, ", "))
+		}
+
+		vals := values[name]
+		value := vals[len(vals)-1]
+		if err := spec.Validate(value); err != nil {
+			return Options{}, err
+		}
+		o.values[name] = value
+	}
+
+	return o, nil
+}
+
+func (o Options) getSpec(name string) (OptionSpec, bool) {
+	for _, s := range o.specs {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return OptionSpec{}, false
+}
+
+// IsZero returns true if the options have not been parsed
+func (o Options) IsZero() bool {
+	return o.specs == nil && o.values == nil
+}
+
+// IsSet returns true if the option was explicitly provided
+func (o Options) IsSet(name string) bool {
+	_, ok := o.values[name]
+	return ok
+}
+
+// Names returns the names of the options that were explicitly provided
+func (o Options) Names() []string {
+	var names []string
+	for name := range o.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetString returns the value of the option (or its default, if it was not provided)
+func (o Options) GetString(name string) string {
+	if v, ok := o.values[name]; ok {
+		return v
+	}
+	if spec, ok := o.getSpec(name); ok {
+		return spec.Default
+	}
+	return ""
+}
+
+// GetInt returns the value of the option as an integer
+func (o Options) GetInt(name string) int {
+	v, _ := strconv.Atoi(o.GetString(name))
+	return v
+}
+
+// GetBool returns the value of the option as a boolean
+func (o Options) GetBool(name string) bool {
+	v, _ := strconv.ParseBool(o.GetString(name))
+	return v
+}
+
+// GetDuration returns the value of the option as a duration
+func (o Options) GetDuration(name string) time.Duration {
+	v, _ := time.ParseDuration(o.GetString(name))
+	return v
+}
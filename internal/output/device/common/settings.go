@@ -1,12 +1,26 @@
 package common
 
+import (
+	"io"
+
+	"github.com/gotracker/gotracker/internal/logging"
+)
+
 // Settings is the settings for configuring an output device
 type Settings struct {
-	Name             string `pflag:"output" env:"output" pf:"O" usage:"output device"`
-	Channels         int    `pflag:"channels" env:"channels" pf:"c" usage:"channels"`
-	SamplesPerSecond int    `pflag:"sample-rate" env:"sample_rate" pf:"s" usage:"sample rate"`
-	BitsPerSample    int    `pflag:"bits-per-sample" env:"bits_per_sample" pf:"b" usage:"bits per sample"`
-	StereoSeparation int    `pflag:"stereo-separation" env:"stereo_separation" pf:"S" usage:"stereo separation (0-100)"`
-	Filepath         string `pflag:"output-file" env:"-" pf:"f" usage:"output filepath"`
+	Name             string
+	Outputs          []string `pflag:"output" env:"output" pf:"O" usage:"output device(s) - repeat to output to more than one device (format: name[:filepath][?option=value&...]) (default: the highest priority sound card that can be opened)"`
+	Channels         int      `pflag:"channels" env:"channels" pf:"c" usage:"channels"`
+	SamplesPerSecond int      `pflag:"sample-rate" env:"sample_rate" pf:"s" usage:"sample rate"`
+	BitsPerSample    int      `pflag:"bits-per-sample" env:"bits_per_sample" pf:"b" usage:"bits per sample"`
+	StereoSeparation int      `pflag:"stereo-separation" env:"stereo_separation" pf:"S" usage:"stereo separation (0-100)"`
+	Upmix            string   `pflag:"upmix" env:"upmix" usage:"strategy for deriving the center, LFE and surround channels of 5.1/7.1 output from stereo {matrix, mirror, front}"`
+	Dither           string   `pflag:"dither" env:"dither" usage:"dither added when reducing the mix to 8 or 16 bits per sample {none, tpdf, shaped} - shaped moves most of the noise to the frequencies that are hardest to hear"`
+	Filepath         string   `pflag:"output-file" env:"-" pf:"f" usage:"output filepath - may be a template, e.g.: \"renders/{index:03}-{title}.{ext}\" (fields: index, path, name, title, start, end, ext)"`
+	FileFormat       string   `pflag:"output-format" env:"output_format" usage:"output file format to use for the {ext} field of an output filepath template"`
+	StrictFormat     bool     `pflag:"strict-format" env:"strict_format" usage:"fail instead of adjusting the output format to the closest one supported by the output device(s)"`
+	Options          Options
+	Writer           io.Writer   // if set, file devices write to it instead of creating Filepath
+	Logger           logging.Log // if set, devices that run in the background report their errors to it
 	OnRowOutput      WrittenCallback
 }
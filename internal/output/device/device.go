@@ -26,11 +26,23 @@ type kindGetter interface {
 	GetKind() deviceCommon.Kind
 }
 
+type metadataSetter interface {
+	SetMetadata(md deviceCommon.Metadata) error
+}
+
 type createOutputDeviceFunc func(settings deviceCommon.Settings) (Device, error)
 
+type getCapabilitiesFunc func(settings deviceCommon.Settings) (deviceCommon.Capabilities, error)
+
+type listSinksFunc func() ([]deviceCommon.Sink, error)
+
 type deviceDetails struct {
-	create createOutputDeviceFunc
-	Kind   deviceCommon.Kind
+	create          createOutputDeviceFunc
+	getCapabilities getCapabilitiesFunc // if nil, Capabilities applies to all settings
+	listSinks       listSinksFunc       // if nil, the device has no selectable sinks
+	Kind            deviceCommon.Kind
+	Options         []deviceCommon.OptionSpec
+	Capabilities    deviceCommon.Capabilities
 }
 
 // GetKind returns the kind for the passed in device
@@ -41,14 +53,64 @@ func GetKind(d Device) deviceCommon.Kind {
 	return deviceCommon.KindNone
 }
 
+// SetMetadata tells the device what's currently being played, if the device can make use of it
+func SetMetadata(d Device, md deviceCommon.Metadata) error {
+	if dev, ok := d.(metadataSetter); ok {
+		return dev.SetMetadata(md)
+	}
+	return nil
+}
+
 var (
 	// Map is the mapping of device name to device details
 	Map = make(map[string]deviceDetails)
 )
 
+// GetOptionSpecs returns the specifications of the options accepted by the named device
+func GetOptionSpecs(name string) []deviceCommon.OptionSpec {
+	specs := append([]deviceCommon.OptionSpec{}, deviceCommon.CommonOptions...)
+	if details, ok := Map[name]; ok {
+		specs = append(specs, details.Options...)
+	}
+	return specs
+}
+
+// GetCapabilities returns the output formats supported by the device described by the settings
+func GetCapabilities(settings deviceCommon.Settings) (deviceCommon.Capabilities, error) {
+	details, ok := Map[settings.Name]
+	if !ok {
+		return deviceCommon.Capabilities{}, fmt.Errorf("%w: %s", ErrDeviceNotSupported, settings.Name)
+	}
+
+	if details.getCapabilities != nil {
+		return details.getCapabilities(settings)
+	}
+	return details.Capabilities, nil
+}
+
+// ListSinks returns the sinks that the named device can play to
+func ListSinks(name string) ([]deviceCommon.Sink, error) {
+	details, ok := Map[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotSupported, name)
+	}
+
+	if details.listSinks == nil {
+		return nil, nil
+	}
+	return details.listSinks()
+}
+
 // CreateOutputDevice creates an output device based on the provided settings
 func CreateOutputDevice(settings deviceCommon.Settings) (Device, error) {
 	if details, ok := Map[settings.Name]; ok && details.create != nil {
+		if settings.Options.IsZero() {
+			opts, err := deviceCommon.ParseOptions(GetOptionSpecs(settings.Name), nil)
+			if err != nil {
+				return nil, err
+			}
+			settings.Options = opts
+		}
 		dev, err := details.create(settings)
 		if err != nil {
 			return nil, err
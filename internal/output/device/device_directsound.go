@@ -8,7 +8,9 @@ import (
 	"errors"
 	"io"
 
+	"github.com/gotracker/gotracker/internal/mixdown"
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
 	"github.com/gotracker/playback/mixing"
 	"github.com/gotracker/playback/mixing/sampling"
 	"github.com/gotracker/playback/output"
@@ -29,6 +31,7 @@ type dsoundDevice struct {
 
 	mix     mixing.Mixer
 	sampFmt sampling.Format
+	dither  *dither.Quantizer // nil if the mix is truncated
 }
 
 // Name returns the device name
@@ -57,6 +60,12 @@ func newDSoundDevice(settings deviceCommon.Settings) (Device, error) {
 		d.sampFmt = sampling.Format16BitLESigned
 	}
 
+	mode, err := dither.ParseMode(settings.Dither)
+	if err != nil {
+		return nil, err
+	}
+	d.dither = dither.NewQuantizer(mode, settings.BitsPerSample)
+
 	preferredDeviceName := ""
 	ds, err := directsound.NewDSound(preferredDeviceName)
 	if err != nil {
@@ -97,7 +106,9 @@ type playbackBuffer struct {
 	writePos   int
 }
 
-func (p *playbackBuffer) Add(mix *mixing.Mixer, row *output.PremixData, pos int, size int, blockAlign int, panmixer mixing.PanMixer, format sampling.Format) (int, error) {
+// Add writes as much of the row as fits into the buffer, starting from the sample at pos. If the
+// row has already been dithered, its dithered data is written instead of mixing it again.
+func (p *playbackBuffer) Add(mix *mixing.Mixer, row *output.PremixData, dithered []byte, pos int, size int, blockAlign int, panmixer mixing.PanMixer, format sampling.Format) (int, error) {
 	remaining := p.maxSamples - p.writePos
 	samples := row.SamplesLen - pos
 	if samples >= remaining {
@@ -120,7 +131,14 @@ func (p *playbackBuffer) Add(mix *mixing.Mixer, row *output.PremixData, pos int,
 		rear := make([]byte, rem*blockAlign)
 		writeSegs = append(writeSegs, rear)
 	}
-	mix.FlattenTo(writeSegs, panmixer.NumChannels(), row.SamplesLen, row.Data, row.MixerVolume, format)
+	if dithered != nil {
+		for _, seg := range writeSegs {
+			n := copy(seg, dithered)
+			dithered = dithered[n:]
+		}
+	} else {
+		mix.FlattenTo(writeSegs, panmixer.NumChannels(), row.SamplesLen, row.Data, row.MixerVolume, format)
+	}
 	if err := p.buffer.Unlock(segments); err != nil {
 		return 0, err
 	}
@@ -210,6 +228,11 @@ func (d *dsoundDevice) PlayWithCtx(ctx context.Context, in <-chan *output.Premix
 				size := row.SamplesLen
 				pos := 0
 
+				var dithered []byte
+				if d.dither != nil {
+					dithered = d.dither.Flatten(mixdown.Channels(row, d.mix.Channels), d.sampFmt)
+				}
+
 				blockAlign := int(d.wfx.NBlockAlign)
 				if size > 0 {
 					event, err := getAvailableEvent()
@@ -223,7 +246,7 @@ func (d *dsoundDevice) PlayWithCtx(ctx context.Context, in <-chan *output.Premix
 					})
 				}
 				for size > 0 {
-					n, err := currentBuffer.Add(&d.mix, row, pos, row.SamplesLen, blockAlign, panmixer, d.sampFmt)
+					n, err := currentBuffer.Add(&d.mix, row, dithered, pos, row.SamplesLen, blockAlign, panmixer, d.sampFmt)
 					size -= n
 					pos += n
 					if err != nil {
@@ -313,5 +336,11 @@ func init() {
 	Map[dsoundName] = deviceDetails{
 		create: newDSoundDevice,
 		Kind:   deviceCommon.KindSoundCard,
+		Capabilities: deviceCommon.Capabilities{
+			MinSampleRate: 8000,
+			MaxSampleRate: 192000,
+			BitsPerSample: []int{8, 16},
+			Channels:      []int{1, 2, 4},
+		},
 	}
 }
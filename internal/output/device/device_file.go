@@ -2,8 +2,9 @@ package device
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"path"
+	"slices"
 	"strings"
 
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
@@ -11,7 +12,11 @@ import (
 	"github.com/gotracker/playback/output"
 )
 
-const fileName = "file"
+const (
+	fileName = "file"
+
+	fileOptionFormat = "format"
+)
 
 type fileDevice struct {
 	device
@@ -51,10 +56,40 @@ func (d *fileDevice) Close() error {
 	return d.processor.Close()
 }
 
-func newFileDevice(settings deviceCommon.Settings) (Device, error) {
+// getFileFormat returns the file format to write, based on the format option or the output filepath extension
+func getFileFormat(settings deviceCommon.Settings) (string, deviceFile.FileFormat, bool) {
 	ext := strings.ToLower(path.Ext(settings.Filepath))
-	if factory, ok := deviceFile.GetFileDevice(ext); ok && factory != nil {
-		processor, err := factory(settings)
+	if settings.Options.IsSet(fileOptionFormat) {
+		ext = "." + settings.Options.GetString(fileOptionFormat)
+	}
+	format, ok := deviceFile.GetFileFormat(ext)
+	return ext, format, ok
+}
+
+func getFileDeviceCapabilities(settings deviceCommon.Settings) (deviceCommon.Capabilities, error) {
+	ext, format, ok := getFileFormat(settings)
+	if !ok {
+		return deviceCommon.Capabilities{}, fmt.Errorf("unsupported output format: %q", ext)
+	}
+	return format.Capabilities, nil
+}
+
+func newFileDevice(settings deviceCommon.Settings) (Device, error) {
+	ext, format, ok := getFileFormat(settings)
+	if ok && format.Create != nil {
+		// make sure the options provided are supported by the format we're writing
+		for _, name := range settings.Options.Names() {
+			if name == fileOptionFormat || slices.ContainsFunc(deviceCommon.CommonOptions, func(spec deviceCommon.OptionSpec) bool {
+				return spec.Name == name
+			}) || slices.ContainsFunc(format.Options, func(spec deviceCommon.OptionSpec) bool {
+				return spec.Name == name
+			}) {
+				continue
+			}
+			return nil, fmt.Errorf("option %q is not supported by the %s file format", name, strings.TrimPrefix(ext, "."))
+		}
+
+		processor, err := format.Create(settings)
 		if err != nil {
 			return nil, err
 		}
@@ -67,12 +102,44 @@ func newFileDevice(settings deviceCommon.Settings) (Device, error) {
 		return &dev, nil
 	}
 
-	return nil, errors.New("unsupported output format")
+	return nil, fmt.Errorf("unsupported output format: %q", ext)
+}
+
+func getFileDeviceOptions() []deviceCommon.OptionSpec {
+	options := []deviceCommon.OptionSpec{
+		{
+			Name:    fileOptionFormat,
+			Type:    deviceCommon.OptionTypeString,
+			Usage:   "file format (default: based on the output filepath extension)",
+			Choices: deviceFile.GetFileFormats(),
+		},
+	}
+	for _, name := range deviceFile.GetFileFormats() {
+		format, _ := deviceFile.GetFileFormat("." + name)
+		for _, spec := range format.Options {
+			spec.Usage = fmt.Sprintf("[%s] %s", name, spec.Usage)
+			options = append(options, spec)
+		}
+	}
+	return options
+}
+
+// getAllFileFormatCapabilities returns the output formats supported by any of the file formats
+func getAllFileFormatCapabilities() deviceCommon.Capabilities {
+	var caps deviceCommon.Capabilities
+	for _, name := range deviceFile.GetFileFormats() {
+		format, _ := deviceFile.GetFileFormat("." + name)
+		caps = caps.Union(format.Capabilities)
+	}
+	return caps
 }
 
 func init() {
 	Map[fileName] = deviceDetails{
-		create: newFileDevice,
-		Kind:   deviceCommon.KindFile,
+		create:          newFileDevice,
+		getCapabilities: getFileDeviceCapabilities,
+		Kind:            deviceCommon.KindFile,
+		Options:         getFileDeviceOptions(),
+		Capabilities:    getAllFileFormatCapabilities(),
 	}
 }
@@ -0,0 +1,211 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gotracker/playback/mixing"
+	"github.com/gotracker/playback/output"
+	"github.com/gotracker/playback/player/render"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
+	"github.com/gotracker/gotracker/internal/output/device/httpstream"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
+)
+
+const (
+	httpName = "http"
+
+	httpOptionListen = "listen"
+	httpOptionName   = "name"
+	httpOptionLead   = "lead"
+)
+
+type httpDevice struct {
+	device
+	mix           mixing.Mixer
+	surround      *surround.Mixer
+	dither        *dither.Quantizer // nil if the mix is truncated
+	bitsPerSample int
+	sampleRate    int
+	lead          time.Duration
+	srv           *httpstream.Server
+}
+
+func (httpDevice) GetKind() deviceCommon.Kind {
+	return deviceCommon.KindNetwork
+}
+
+// Name returns the device name
+func (httpDevice) Name() string {
+	return httpName
+}
+
+func newHTTPDevice(settings deviceCommon.Settings) (Device, error) {
+	d := httpDevice{
+		device: device{
+			onRowOutput: settings.OnRowOutput,
+		},
+		mix: mixing.Mixer{
+			Channels: settings.Channels,
+		},
+		bitsPerSample: settings.BitsPerSample,
+		sampleRate:    settings.SamplesPerSecond,
+		lead:          settings.Options.GetDuration(httpOptionLead),
+	}
+
+	mode, err := dither.ParseMode(settings.Dither)
+	if err != nil {
+		return nil, err
+	}
+	d.dither = dither.NewQuantizer(mode, settings.BitsPerSample)
+
+	if surround.IsSurround(settings.Channels) {
+		strategy, err := surround.ParseStrategy(settings.Upmix)
+		if err != nil {
+			return nil, err
+		}
+		if d.surround, err = surround.NewMixer(settings.Channels, settings.SamplesPerSecond, strategy); err != nil {
+			return nil, err
+		}
+	}
+
+	logger := settings.Logger
+	if logger == nil {
+		logger = &logging.Squelchable{}
+	}
+
+	srv, err := httpstream.New(httpstream.Config{
+		Listen: settings.Options.GetString(httpOptionListen),
+		Name:   settings.Options.GetString(httpOptionName),
+		Format: httpstream.Format{
+			SampleRate:    settings.SamplesPerSecond,
+			Channels:      settings.Channels,
+			BitsPerSample: settings.BitsPerSample,
+		},
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	d.srv = srv
+	return &d, nil
+}
+
+// SetMetadata updates the title reported to listeners
+func (d *httpDevice) SetMetadata(md deviceCommon.Metadata) error {
+	d.srv.SetMetadata(md.Title, md.Artist)
+	return nil
+}
+
+// Play starts the stream playing
+func (d *httpDevice) Play(in <-chan *output.PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the stream playing
+func (d *httpDevice) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData) error {
+	var panmixer mixing.PanMixer
+	if d.surround == nil {
+		panmixer = mixing.GetPanMixer(d.mix.Channels)
+		if panmixer == nil {
+			return errors.New("invalid pan mixer - check channel count")
+		}
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the stream is paced in real time, so that listeners hear it live
+	var (
+		start   = time.Now()
+		samples int64
+	)
+
+	for {
+		select {
+		case <-myCtx.Done():
+			return myCtx.Err()
+		case row, ok := <-in:
+			if !ok {
+				return nil
+			}
+			var mixedData [][]int32
+			if d.dither != nil {
+				mixedData = d.dither.ToInts(surround.Channels(d.surround, row, d.mix.Channels))
+			} else if d.surround != nil {
+				mixedData = d.surround.FlattenToInts(row, d.bitsPerSample)
+			} else {
+				mixedData = d.mix.FlattenToInts(panmixer.NumChannels(), row.SamplesLen, d.bitsPerSample, row.Data, row.MixerVolume)
+			}
+			d.srv.Publish(httpstream.Chunk{
+				Samples: mixedData,
+				Len:     row.SamplesLen,
+			})
+			if rr, ok := row.Userdata.(*render.RowRender); ok {
+				d.srv.SetPosition(rr.Order, rr.Row)
+			}
+			if d.onRowOutput != nil {
+				d.onRowOutput(deviceCommon.KindNetwork, row)
+			}
+
+			samples += int64(row.SamplesLen)
+			elapsed := time.Duration(samples) * time.Second / time.Duration(d.sampleRate)
+			ahead := elapsed - time.Since(start)
+			if ahead < 0 {
+				// rendering fell behind (or was suspended) - pick the pace back up from here
+				start = time.Now().Add(-elapsed)
+			} else if ahead > d.lead {
+				select {
+				case <-myCtx.Done():
+					return myCtx.Err()
+				case <-time.After(ahead - d.lead):
+				}
+			}
+		}
+	}
+}
+
+// Close stops the stream and disconnects all of the listeners
+func (d *httpDevice) Close() error {
+	if d.srv != nil {
+		return d.srv.Close()
+	}
+	return nil
+}
+
+func init() {
+	Map[httpName] = deviceDetails{
+		create: newHTTPDevice,
+		Kind:   deviceCommon.KindNetwork,
+		Capabilities: deviceCommon.Capabilities{
+			MinSampleRate: 8000,
+			MaxSampleRate: 192000,
+			BitsPerSample: []int{8, 16},
+			Channels:      []int{1, 2, 4, 6, 8},
+		},
+		Options: []deviceCommon.OptionSpec{
+			{
+				Name:    httpOptionListen,
+				Type:    deviceCommon.OptionTypeString,
+				Default: ":8000",
+				Usage:   "address to listen for listeners on",
+			},
+			{
+				Name:    httpOptionName,
+				Type:    deviceCommon.OptionTypeString,
+				Default: "gotracker",
+				Usage:   "name of the stream, reported to listeners",
+			},
+			{
+				Name:    httpOptionLead,
+				Type:    deviceCommon.OptionTypeDuration,
+				Default: "500ms",
+				Usage:   "how far ahead of real time the stream is rendered",
+			},
+		},
+	}
+}
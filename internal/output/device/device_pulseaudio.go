@@ -6,22 +6,41 @@ package device
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/gotracker/playback/mixing"
 	"github.com/gotracker/playback/mixing/sampling"
 	"github.com/gotracker/playback/output"
 
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
 	"github.com/gotracker/gotracker/internal/output/device/pulseaudio"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
 )
 
-const pulseaudioName = "pulseaudio"
+const (
+	pulseaudioName = "pulseaudio"
+
+	pulseaudioOptionSink             = "sink"
+	pulseaudioOptionLatency          = "latency"
+	pulseaudioOptionAppName          = "app-name"
+	pulseaudioOptionServer           = "server"
+	pulseaudioOptionReconnectTimeout = "reconnect-timeout"
+
+	pulseaudioDefaultAppName = "Music"
+
+	// pulseaudioFloatBitsPerSample is the bit depth that's played as 32-bit floating-point
+	// samples, as the mixer has no 32-bit integer format to give the server
+	pulseaudioFloatBitsPerSample = 32
+)
 
 type pulseaudioDevice struct {
 	device
-	mix     mixing.Mixer
-	sampFmt sampling.Format
-	pa      *pulseaudio.Client
+	mix      mixing.Mixer
+	surround *surround.Mixer
+	sampFmt  sampling.Format
+	dither   *dither.Quantizer // nil if the mix is truncated
+	pa       *pulseaudio.Client
 }
 
 func (pulseaudioDevice) GetKind() deviceCommon.Kind {
@@ -43,14 +62,48 @@ func newPulseAudioDevice(settings deviceCommon.Settings) (Device, error) {
 		},
 	}
 
+	var format pulseaudio.SampleFormat
 	switch settings.BitsPerSample {
 	case 8:
 		d.sampFmt = sampling.Format8BitUnsigned
+		format = pulseaudio.SampleFormatUint8
 	case 16:
 		d.sampFmt = sampling.Format16BitLESigned
+		format = pulseaudio.SampleFormatInt16
+	case pulseaudioFloatBitsPerSample:
+		d.sampFmt = sampling.Format32BitLEFloat
+		format = pulseaudio.SampleFormatFloat32
+	default:
+		return nil, fmt.Errorf("unsupported bits per sample: %d", settings.BitsPerSample)
+	}
+
+	mode, err := dither.ParseMode(settings.Dither)
+	if err != nil {
+		return nil, err
 	}
+	d.dither = dither.NewQuantizer(mode, settings.BitsPerSample)
 
-	play, err := pulseaudio.New("Music", settings.SamplesPerSecond, settings.Channels, settings.BitsPerSample)
+	if surround.IsSurround(settings.Channels) {
+		strategy, err := surround.ParseStrategy(settings.Upmix)
+		if err != nil {
+			return nil, err
+		}
+		if d.surround, err = surround.NewMixer(settings.Channels, settings.SamplesPerSecond, strategy); err != nil {
+			return nil, err
+		}
+	}
+
+	play, err := pulseaudio.New(pulseaudio.Config{
+		AppName:    settings.Options.GetString(pulseaudioOptionAppName),
+		SampleRate: settings.SamplesPerSecond,
+		Channels:   settings.Channels,
+		Format:     format,
+		Sink:       settings.Options.GetString(pulseaudioOptionSink),
+		Latency:    settings.Options.GetDuration(pulseaudioOptionLatency),
+		Server:     settings.Options.GetString(pulseaudioOptionServer),
+
+		ReconnectTimeout: settings.Options.GetDuration(pulseaudioOptionReconnectTimeout),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +112,11 @@ func newPulseAudioDevice(settings deviceCommon.Settings) (Device, error) {
 	return &d, nil
 }
 
+// SetMetadata updates the stream properties shown by desktop mixers
+func (d *pulseaudioDevice) SetMetadata(md deviceCommon.Metadata) error {
+	return d.pa.SetMetadata(md.Title, md.Artist)
+}
+
 // Play starts the wave output device playing
 func (d *pulseaudioDevice) Play(in <-chan *output.PremixData) error {
 	return d.PlayWithCtx(context.Background(), in)
@@ -66,9 +124,11 @@ func (d *pulseaudioDevice) Play(in <-chan *output.PremixData) error {
 
 // PlayWithCtx starts the wave output device playing
 func (d *pulseaudioDevice) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData) error {
-	panmixer := mixing.GetPanMixer(d.mix.Channels)
-	if panmixer == nil {
-		return errors.New("invalid pan mixer - check channel count")
+	if d.surround == nil {
+		panmixer := mixing.GetPanMixer(d.mix.Channels)
+		if panmixer == nil {
+			return errors.New("invalid pan mixer - check channel count")
+		}
 	}
 
 	myCtx, cancel := context.WithCancel(ctx)
@@ -82,8 +142,17 @@ func (d *pulseaudioDevice) PlayWithCtx(ctx context.Context, in <-chan *output.Pr
 			if !ok {
 				return nil
 			}
-			mixedData := d.mix.Flatten(row.SamplesLen, row.Data, row.MixerVolume, d.sampFmt)
-			d.pa.Output(mixedData)
+			var mixedData []byte
+			if d.dither != nil {
+				mixedData = d.dither.Flatten(surround.Channels(d.surround, row, d.mix.Channels), d.sampFmt)
+			} else if d.surround != nil {
+				mixedData = d.surround.Flatten(row, d.sampFmt)
+			} else {
+				mixedData = d.mix.Flatten(row.SamplesLen, row.Data, row.MixerVolume, d.sampFmt)
+			}
+			if err := d.pa.Output(myCtx, mixedData); err != nil {
+				return err
+			}
 			if d.onRowOutput != nil {
 				d.onRowOutput(deviceCommon.KindSoundCard, row)
 			}
@@ -99,9 +168,65 @@ func (d *pulseaudioDevice) Close() error {
 	return nil
 }
 
+func listPulseAudioSinks() ([]deviceCommon.Sink, error) {
+	sinks, err := pulseaudio.ListSinks(pulseaudio.Config{
+		AppName: pulseaudioDefaultAppName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]deviceCommon.Sink, len(sinks))
+	for i, s := range sinks {
+		list[i] = deviceCommon.Sink{
+			ID:          s.ID,
+			Description: s.Description,
+			Default:     s.Default,
+		}
+	}
+	return list, nil
+}
+
 func init() {
 	Map[pulseaudioName] = deviceDetails{
-		create: newPulseAudioDevice,
-		Kind:   deviceCommon.KindSoundCard,
+		create:    newPulseAudioDevice,
+		listSinks: listPulseAudioSinks,
+		Kind:      deviceCommon.KindSoundCard,
+		Capabilities: deviceCommon.Capabilities{
+			MinSampleRate: 8000,
+			MaxSampleRate: 192000,
+			BitsPerSample: []int{8, 16, pulseaudioFloatBitsPerSample},
+			Channels:      []int{1, 2, 4, 6, 8},
+		},
+		Options: []deviceCommon.OptionSpec{
+			{
+				Name:  pulseaudioOptionSink,
+				Type:  deviceCommon.OptionTypeString,
+				Usage: "name of the sink to play to - see `device list` for the available sinks (default: server default sink)",
+			},
+			{
+				Name:    pulseaudioOptionLatency,
+				Type:    deviceCommon.OptionTypeDuration,
+				Default: "100ms",
+				Usage:   "requested playback latency",
+			},
+			{
+				Name:    pulseaudioOptionAppName,
+				Type:    deviceCommon.OptionTypeString,
+				Default: pulseaudioDefaultAppName,
+				Usage:   "application name reported to the server",
+			},
+			{
+				Name:  pulseaudioOptionServer,
+				Type:  deviceCommon.OptionTypeString,
+				Usage: "server to connect to, e.g.: unix:/run/user/1000/pulse/native or tcp:host:4713 (default: PULSE_SERVER or the local server)",
+			},
+			{
+				Name:    pulseaudioOptionReconnectTimeout,
+				Type:    deviceCommon.OptionTypeDuration,
+				Default: "30s",
+				Usage:   "how long to keep trying to reconnect if the connection to the server is lost (0s = give up immediately)",
+			},
+		},
 	}
 }
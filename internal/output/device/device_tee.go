@@ -0,0 +1,214 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/playback/output"
+)
+
+type teeDevice struct {
+	devices []Device
+	primary int
+}
+
+// NewTeeDevice creates a device that fans the premix stream out to all of the provided devices.
+// The primary device receives the stream directly (and so paces playback), while every other
+// device is fed through an unbounded queue so that a slow device cannot stall the primary one.
+func NewTeeDevice(primary int, devices ...Device) (Device, error) {
+	if len(devices) == 0 {
+		return nil, errors.New("no devices provided to tee")
+	}
+
+	if primary < 0 || primary >= len(devices) {
+		return nil, errors.New("invalid primary device for tee")
+	}
+
+	d := teeDevice{
+		devices: devices,
+		primary: primary,
+	}
+	return &d, nil
+}
+
+// GetKind returns the kind of the primary device
+func (d teeDevice) GetKind() deviceCommon.Kind {
+	return GetKind(d.devices[d.primary])
+}
+
+// Name returns the device name
+func (d teeDevice) Name() string {
+	names := make([]string, len(d.devices))
+	for i, dev := range d.devices {
+		names[i] = dev.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+// SetMetadata passes the metadata along to all of the tee'd devices
+func (d teeDevice) SetMetadata(md deviceCommon.Metadata) error {
+	var errs []error
+	for _, dev := range d.devices {
+		if err := SetMetadata(dev, md); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Play starts the tee device playing
+func (d *teeDevice) Play(in <-chan *output.PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the tee device playing
+func (d *teeDevice) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData) error {
+	myCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+
+	queues := make([]*teeQueue, len(d.devices))
+	for i, dev := range d.devices {
+		var devIn <-chan *output.PremixData
+		if i == d.primary {
+			q := make(chan *output.PremixData)
+			queues[i] = &teeQueue{direct: q}
+			devIn = q
+		} else {
+			q := newTeeQueue(myCtx)
+			queues[i] = q
+			devIn = q.out
+		}
+
+		wg.Add(1)
+		go func(dev Device, devIn <-chan *output.PremixData) {
+			defer wg.Done()
+			if err := dev.PlayWithCtx(myCtx, devIn); err != nil {
+				cancel(err)
+			}
+		}(dev, devIn)
+	}
+
+	err := func() error {
+		defer func() {
+			for _, q := range queues {
+				q.Close()
+			}
+		}()
+
+		for {
+			select {
+			case <-myCtx.Done():
+				return context.Cause(myCtx)
+			case row, ok := <-in:
+				if !ok {
+					return nil
+				}
+				for _, q := range queues {
+					if err := q.Push(myCtx, row); err != nil {
+						return context.Cause(myCtx)
+					}
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	if err == nil {
+		if cause := context.Cause(myCtx); cause != nil && !errors.Is(cause, context.Canceled) {
+			err = cause
+		}
+	}
+	return err
+}
+
+// Close closes all of the tee'd devices
+func (d *teeDevice) Close() error {
+	var errs []error
+	for _, dev := range d.devices {
+		if err := dev.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// teeQueue is either a direct (blocking) channel or an unbounded queue of premix buffers
+type teeQueue struct {
+	direct chan *output.PremixData
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*output.PremixData
+	closed  bool
+	out     chan *output.PremixData
+}
+
+func newTeeQueue(ctx context.Context) *teeQueue {
+	q := teeQueue{
+		out: make(chan *output.PremixData),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.pump(ctx)
+	return &q
+}
+
+func (q *teeQueue) pump(ctx context.Context) {
+	defer close(q.out)
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		row := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case q.out <- row:
+		}
+	}
+}
+
+// Push adds a premix buffer to the queue. Only the direct queue can block.
+func (q *teeQueue) Push(ctx context.Context, row *output.PremixData) error {
+	if q.direct != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case q.direct <- row:
+			return nil
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, row)
+	q.cond.Signal()
+	return nil
+}
+
+// Close marks the end of the stream - anything still pending is drained to the device first
+func (q *teeQueue) Close() {
+	if q.direct != nil {
+		close(q.direct)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Signal()
+}
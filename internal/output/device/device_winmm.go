@@ -8,7 +8,9 @@ import (
 	"errors"
 	"time"
 
+	"github.com/gotracker/gotracker/internal/mixdown"
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
 	"github.com/gotracker/playback/mixing"
 	"github.com/gotracker/playback/mixing/sampling"
 	"github.com/gotracker/playback/output"
@@ -21,6 +23,7 @@ type winmmDevice struct {
 	device
 	mix     mixing.Mixer
 	sampFmt sampling.Format
+	dither  *dither.Quantizer // nil if the mix is truncated
 	waveout *winmm.WaveOut
 }
 
@@ -50,7 +53,12 @@ func newWinMMDevice(settings deviceCommon.Settings) (Device, error) {
 		d.sampFmt = sampling.Format16BitLESigned
 	}
 
-	var err error
+	mode, err := dither.ParseMode(settings.Dither)
+	if err != nil {
+		return nil, err
+	}
+	d.dither = dither.NewQuantizer(mode, settings.BitsPerSample)
+
 	d.waveout, err = winmm.New(settings.Channels, settings.SamplesPerSecond, settings.BitsPerSample)
 	if err != nil {
 		return nil, err
@@ -93,7 +101,12 @@ func (d *winmmDevice) PlayWithCtx(ctx context.Context, in <-chan *output.PremixD
 				if !ok {
 					return
 				}
-				mixedData := d.mix.Flatten(row.SamplesLen, row.Data, row.MixerVolume, d.sampFmt)
+				var mixedData []byte
+				if d.dither != nil {
+					mixedData = d.dither.Flatten(mixdown.Channels(row, d.mix.Channels), d.sampFmt)
+				} else {
+					mixedData = d.mix.Flatten(row.SamplesLen, row.Data, row.MixerVolume, d.sampFmt)
+				}
 				rowWave := RowWave{
 					Wave: d.waveout.Write(mixedData),
 					Row:  row,
@@ -134,5 +147,11 @@ func init() {
 	Map[winmmName] = deviceDetails{
 		create: newWinMMDevice,
 		Kind:   deviceCommon.KindSoundCard,
+		Capabilities: deviceCommon.Capabilities{
+			MinSampleRate: 8000,
+			MaxSampleRate: 192000,
+			BitsPerSample: []int{8, 16},
+			Channels:      []int{1, 2, 4},
+		},
 	}
 }
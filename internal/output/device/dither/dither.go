@@ -0,0 +1,163 @@
+// Package dither reduces the mix to 8 or 16 bits per sample with dither, so quiet passages and
+// fades don't pick up the distortion that truncating them to so few bits causes.
+package dither
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/gotracker/playback/mixing/sampling"
+	"github.com/gotracker/playback/mixing/volume"
+)
+
+// Mode is an enumeration of the ways the mix can be dithered
+type Mode int
+
+const (
+	// ModeNone truncates the mix, as the mixer does
+	ModeNone = Mode(iota)
+	// ModeTPDF adds triangular noise of ±1 step, which leaves the error of the reduction as a
+	// steady hiss that doesn't follow the music
+	ModeTPDF
+	// ModeShaped adds the same noise as ModeTPDF, then filters the error so most of it lies in the
+	// frequencies that are hardest to hear
+	ModeShaped
+)
+
+// ModeNames are the names of the dither modes, as accepted by ParseMode
+var ModeNames = []string{"none", "tpdf", "shaped"}
+
+func (m Mode) String() string {
+	if int(m) < 0 || int(m) >= len(ModeNames) {
+		return "unknown"
+	}
+	return ModeNames[m]
+}
+
+// ParseMode returns the dither mode with the provided name. No name is no dither.
+func ParseMode(name string) (Mode, error) {
+	if name == "" {
+		return ModeNone, nil
+	}
+	if i := slices.Index(ModeNames, strings.ToLower(name)); i >= 0 {
+		return Mode(i), nil
+	}
+	return ModeNone, fmt.Errorf("unknown dither %q - must be one of {%s}", name, strings.Join(ModeNames, ", "))
+}
+
+// seed is what the noise is generated from, so that renders of the same song are identical
+const seed = 0x9e3779b97f4a7c15
+
+// shapingFilter is the filter the error is fed back through by ModeShaped - the 5-tap E-weighted
+// filter of Lipshitz, Vanderkooy & Wannamaker, designed for 44.1kHz and close enough at 48kHz
+var shapingFilter = [...]float64{2.033, -2.165, 1.959, -1.590, 0.6149}
+
+// maxError is the largest error of a single sample that's fed back. The error of a sample that's
+// dithered and rounded is never more than 1.5 steps, unless the sample clips - and the error of
+// clipping is left out, so a loud passage doesn't set the filter ringing.
+const maxError = 1.5
+
+// Quantizer converts the mix to integer samples of 8 or 16 bits, dithering it as it goes. It's
+// meant for a single stream of audio, as the noise shaping carries over from one row to the next.
+type Quantizer struct {
+	mode  Mode
+	bits  int
+	scale float64 // steps from silence to full scale
+	rng   *rand.Rand
+	errs  [][len(shapingFilter)]float64 // the latest errors of each channel, most recent first
+}
+
+// NewQuantizer creates a quantizer for the mode, or returns nil if the mix is better off being
+// converted by the mixer - when there's no dither, or the samples have bits enough not to need it
+func NewQuantizer(mode Mode, bitsPerSample int) *Quantizer {
+	if mode == ModeNone || bitsPerSample > 16 {
+		return nil
+	}
+	return &Quantizer{
+		mode:  mode,
+		bits:  bitsPerSample,
+		scale: float64(int(1) << (bitsPerSample - 1)),
+		rng:   rand.New(rand.NewPCG(seed, uint64(bitsPerSample))),
+	}
+}
+
+// ToInts quantizes the samples of each channel
+func (q *Quantizer) ToInts(data [][]volume.Volume) [][]int32 {
+	ints := make([][]int32, len(data))
+	for c := range ints {
+		ints[c] = make([]int32, len(data[c]))
+	}
+	q.each(data, func(c, i int, v int32) {
+		ints[c][i] = v
+	})
+	return ints
+}
+
+// Flatten quantizes the samples of each channel into an interleaved byte stream of the specified
+// sample format, which must be an 8- or 16-bit integer format
+func (q *Quantizer) Flatten(data [][]volume.Volume, sampleFormat sampling.Format) []byte {
+	var (
+		size = (q.bits + 7) / 8
+		n    int
+	)
+	if len(data) > 0 {
+		n = len(data[0])
+	}
+	out := make([]byte, n*len(data)*size)
+	q.each(data, func(c, i int, v int32) {
+		pos := (i*len(data) + c) * size
+		switch sampleFormat {
+		case sampling.Format8BitUnsigned:
+			out[pos] = uint8(v) ^ 0x80
+		case sampling.Format8BitSigned:
+			out[pos] = uint8(v)
+		case sampling.Format16BitLEUnsigned:
+			binary.LittleEndian.PutUint16(out[pos:], uint16(v)^0x8000)
+		case sampling.Format16BitLESigned:
+			binary.LittleEndian.PutUint16(out[pos:], uint16(v))
+		case sampling.Format16BitBEUnsigned:
+			binary.BigEndian.PutUint16(out[pos:], uint16(v)^0x8000)
+		case sampling.Format16BitBESigned:
+			binary.BigEndian.PutUint16(out[pos:], uint16(v))
+		}
+	})
+	return out
+}
+
+// each quantizes the samples in the order they're played, so the noise is the same however they
+// end up being stored
+func (q *Quantizer) each(data [][]volume.Volume, store func(c, i int, v int32)) {
+	if len(data) == 0 {
+		return
+	}
+	for len(q.errs) < len(data) {
+		q.errs = append(q.errs, [len(shapingFilter)]float64{})
+	}
+
+	lo, hi := -q.scale, q.scale-1
+	for i := range data[0] {
+		for c := range data {
+			x := data[c][i].WithOverflowProtection() * q.scale
+
+			e := &q.errs[c]
+			if q.mode == ModeShaped {
+				for k, h := range shapingFilter {
+					x -= h * e[k]
+				}
+			}
+
+			y := math.Round(x + q.rng.Float64() - q.rng.Float64())
+			y = min(max(y, lo), hi)
+
+			if q.mode == ModeShaped {
+				copy(e[1:], e[:len(e)-1])
+				e[0] = min(max(y-x, -maxError), maxError)
+			}
+			store(c, i, int32(y))
+		}
+	}
+}
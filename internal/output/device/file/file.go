@@ -2,17 +2,29 @@ package file
 
 import (
 	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
 
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
 	"github.com/gotracker/playback/output"
 )
 
 var (
-	fileDeviceMap = make(map[string]FileFactory)
+	fileDeviceMap = make(map[string]FileFormat)
 )
 
 type FileFactory func(settings deviceCommon.Settings) (File, error)
 
+// FileFormat is the registration details for a file format, keyed by file extension
+type FileFormat struct {
+	Create       FileFactory
+	Options      []deviceCommon.OptionSpec
+	Capabilities deviceCommon.Capabilities
+}
+
 type WrittenCallback func(data *output.PremixData)
 
 type File interface {
@@ -22,6 +34,41 @@ type File interface {
 }
 
 func GetFileDevice(extension string) (FileFactory, bool) {
-	factory, ok := fileDeviceMap[extension]
-	return factory, ok
+	format, ok := fileDeviceMap[extension]
+	return format.Create, ok
+}
+
+// GetFileFormat returns the registration details for the file format with the provided extension
+func GetFileFormat(extension string) (FileFormat, bool) {
+	format, ok := fileDeviceMap[extension]
+	return format, ok
+}
+
+// GetFileFormats returns the names of the supported file formats (the extensions, without the leading dot)
+func GetFileFormats() []string {
+	var names []string
+	for ext := range fileDeviceMap {
+		names = append(names, strings.TrimPrefix(ext, "."))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// openOutput returns the destination of the file data - the writer provided in the settings, or
+// the file created at the filepath in the settings. The file is only returned if it was created here.
+func openOutput(settings deviceCommon.Settings) (io.Writer, *os.File, error) {
+	if settings.Writer != nil {
+		return settings.Writer, nil, nil
+	}
+
+	f, err := os.OpenFile(settings.Filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if f == nil {
+		return nil, nil, errors.New("unexpected file error")
+	}
+
+	return f, f, nil
 }
@@ -7,6 +7,7 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"io"
 	"os"
 
 	"github.com/mewkiz/flac"
@@ -14,17 +15,27 @@ import (
 	"github.com/mewkiz/flac/meta"
 
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
 	"github.com/gotracker/playback/mixing"
 	"github.com/gotracker/playback/output"
 )
 
+const (
+	flacOptionPrediction = "prediction"
+)
+
 type fileFlac struct {
 	mix              mixing.Mixer
+	surround         *surround.Mixer
 	samplesPerSecond int
 	bitsPerSample    int
+	prediction       bool
+	dither           *dither.Quantizer // nil if the mix is truncated
 
-	f *os.File
-	w *bufio.Writer
+	out io.Writer
+	f   *os.File // only set if the file was created by the device
+	w   *bufio.Writer
 }
 
 func newFileFlacDevice(settings deviceCommon.Settings) (File, error) {
@@ -34,16 +45,31 @@ func newFileFlacDevice(settings deviceCommon.Settings) (File, error) {
 		},
 		samplesPerSecond: settings.SamplesPerSecond,
 		bitsPerSample:    settings.BitsPerSample,
+		prediction:       settings.Options.GetBool(flacOptionPrediction),
 	}
-	f, err := os.OpenFile(settings.Filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+
+	mode, err := dither.ParseMode(settings.Dither)
 	if err != nil {
 		return nil, err
 	}
+	fd.dither = dither.NewQuantizer(mode, settings.BitsPerSample)
+
+	if surround.IsSurround(settings.Channels) {
+		strategy, err := surround.ParseStrategy(settings.Upmix)
+		if err != nil {
+			return nil, err
+		}
+		if fd.surround, err = surround.NewMixer(settings.Channels, settings.SamplesPerSecond, strategy); err != nil {
+			return nil, err
+		}
+	}
 
-	if f == nil {
-		return nil, errors.New("unexpected file error")
+	out, f, err := openOutput(settings)
+	if err != nil {
+		return nil, err
 	}
 
+	fd.out = out
 	fd.f = f
 
 	return &fd, nil
@@ -56,7 +82,7 @@ func (d *fileFlac) Play(in <-chan *output.PremixData, onWrittenCallback WrittenC
 
 // PlayWithCtx starts the wave output device playing
 func (d *fileFlac) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData, onWrittenCallback WrittenCallback) error {
-	w := bufio.NewWriter(d.f)
+	w := bufio.NewWriter(d.out)
 	d.w = w
 	// Encode FLAC stream.
 	si := &meta.StreamInfo{
@@ -71,10 +97,16 @@ func (d *fileFlac) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData
 		return err
 	}
 	defer enc.Close()
-
-	panmixer := mixing.GetPanMixer(d.mix.Channels)
-	if panmixer == nil {
-		return errors.New("invalid pan mixer - check channel count")
+	// the encoder only supports choosing between verbatim and fixed-predictor subframes (and it
+	// chooses, unless it's told not to)
+	enc.EnablePredictionAnalysis(d.prediction)
+
+	var panmixer mixing.PanMixer
+	if d.surround == nil {
+		panmixer = mixing.GetPanMixer(d.mix.Channels)
+		if panmixer == nil {
+			return errors.New("invalid pan mixer - check channel count")
+		}
 	}
 
 	var channels frame.Channels
@@ -85,6 +117,12 @@ func (d *fileFlac) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData
 		channels = frame.ChannelsLR
 	case 4:
 		channels = frame.ChannelsLRLsRs
+	case 6:
+		channels = frame.ChannelsLRCLfeLsRs
+	case 8:
+		channels = frame.ChannelsLRCLfeLsRsSlSr
+	default:
+		return errors.New("invalid channel count")
 	}
 
 	myCtx, cancel := context.WithCancel(ctx)
@@ -98,7 +136,14 @@ func (d *fileFlac) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData
 			if !ok {
 				return nil
 			}
-			mixedData := d.mix.FlattenToInts(panmixer.NumChannels(), row.SamplesLen, d.bitsPerSample, row.Data, row.MixerVolume)
+			var mixedData [][]int32
+			if d.dither != nil {
+				mixedData = d.dither.ToInts(surround.Channels(d.surround, row, d.mix.Channels))
+			} else if d.surround != nil {
+				mixedData = d.surround.FlattenToInts(row, d.bitsPerSample)
+			} else {
+				mixedData = d.mix.FlattenToInts(panmixer.NumChannels(), row.SamplesLen, d.bitsPerSample, row.Data, row.MixerVolume)
+			}
 			subframes := make([]*frame.Subframe, d.mix.Channels)
 			for i := range subframes {
 				subframe := &frame.Subframe{
@@ -149,9 +194,28 @@ func (d *fileFlac) Close() error {
 		return err
 	}
 	d.w = nil
-	return d.f.Close()
+	if d.f != nil {
+		return d.f.Close()
+	}
+	return nil
 }
 
 func init() {
-	fileDeviceMap[".flac"] = newFileFlacDevice
+	fileDeviceMap[".flac"] = FileFormat{
+		Create: newFileFlacDevice,
+		Capabilities: deviceCommon.Capabilities{
+			MinSampleRate: 8000,
+			MaxSampleRate: 192000,
+			BitsPerSample: []int{8, 16, 24},
+			Channels:      []int{1, 2, 4, 6, 8},
+		},
+		Options: []deviceCommon.OptionSpec{
+			{
+				Name:    flacOptionPrediction,
+				Type:    deviceCommon.OptionTypeBool,
+				Default: "true",
+				Usage:   "encode with fixed-predictor subframes where they're smaller than verbatim ones - turning it off writes larger files faster",
+			},
+		},
+	}
 }
@@ -5,33 +5,76 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"io"
 	"os"
 
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
 	"github.com/gotracker/playback/mixing"
 	"github.com/gotracker/playback/mixing/sampling"
 	"github.com/gotracker/playback/output"
 )
 
 type fileWav struct {
-	mix     mixing.Mixer
-	sampFmt sampling.Format
+	mix      mixing.Mixer
+	surround *surround.Mixer
+	sampFmt  sampling.Format
+	dither   *dither.Quantizer // nil if the mix is truncated
 
-	f  *os.File
-	w  *bufio.Writer
-	sz uint32
+	f                *os.File // only set if the file was created by the device
+	ws               io.WriteSeeker
+	w                *bufio.Writer
+	sz               uint32
+	subchunk2SizePos int64
 }
 
 const (
 	wavFileChunkSizePos     = 4
 	wavFileSubchunk2SizePos = 40
+
+	wavFormatPCM        = 0x0001 // = win32.WAVE_FORMAT_PCM
+	wavFormatExtensible = 0xFFFE // = win32.WAVE_FORMAT_EXTENSIBLE
 )
 
+// wavSubFormatPCM is the KSDATAFORMAT_SUBTYPE_PCM GUID, as stored in a WAVEFORMATEXTENSIBLE
+var wavSubFormatPCM = [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// wavChannelMask returns the WAVEFORMATEXTENSIBLE speaker assignment for the channel count
+func wavChannelMask(channels int) uint32 {
+	const (
+		speakerFrontLeft    = 0x1
+		speakerFrontRight   = 0x2
+		speakerFrontCenter  = 0x4
+		speakerLowFrequency = 0x8
+		speakerBackLeft     = 0x10
+		speakerBackRight    = 0x20
+		speakerSideLeft     = 0x200
+		speakerSideRight    = 0x400
+	)
+
+	switch channels {
+	case 1:
+		return speakerFrontCenter
+	case 2:
+		return speakerFrontLeft | speakerFrontRight
+	case 4:
+		return speakerFrontLeft | speakerFrontRight | speakerBackLeft | speakerBackRight
+	case 6:
+		return speakerFrontLeft | speakerFrontRight | speakerFrontCenter | speakerLowFrequency | speakerBackLeft | speakerBackRight
+	case 8:
+		return speakerFrontLeft | speakerFrontRight | speakerFrontCenter | speakerLowFrequency | speakerBackLeft | speakerBackRight | speakerSideLeft | speakerSideRight
+	default:
+		return 0
+	}
+}
+
 func newFileWavDevice(settings deviceCommon.Settings) (File, error) {
 	fd := fileWav{
 		mix: mixing.Mixer{
 			Channels: settings.Channels,
 		},
+		subchunk2SizePos: wavFileSubchunk2SizePos,
 	}
 	switch settings.BitsPerSample {
 	case 8:
@@ -40,24 +83,50 @@ func newFileWavDevice(settings deviceCommon.Settings) (File, error) {
 		fd.sampFmt = sampling.Format16BitLESigned
 	}
 
-	f, err := os.OpenFile(settings.Filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	mode, err := dither.ParseMode(settings.Dither)
+	if err != nil {
+		return nil, err
+	}
+	fd.dither = dither.NewQuantizer(mode, settings.BitsPerSample)
+
+	if surround.IsSurround(settings.Channels) {
+		strategy, err := surround.ParseStrategy(settings.Upmix)
+		if err != nil {
+			return nil, err
+		}
+		if fd.surround, err = surround.NewMixer(settings.Channels, settings.SamplesPerSecond, strategy); err != nil {
+			return nil, err
+		}
+	}
+
+	// more than 2 channels requires the extensible format, so the speaker assignment can be specified
+	extensible := settings.Channels > 2
+	if extensible {
+		fd.subchunk2SizePos += 24
+	}
+
+	out, f, err := openOutput(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	if f == nil {
-		return nil, errors.New("unexpected file error")
+	// if the sizes can't be filled in once everything has been written, they're set to their
+	// maximum, which is what players expect of a stream of unknown length
+	ws, _ := out.(io.WriteSeeker)
+	unknownSize := uint32(0)
+	if ws == nil {
+		unknownSize = 0xFFFFFFFF
 	}
 
 	byteRate := settings.SamplesPerSecond * settings.Channels * settings.BitsPerSample / 8
 	blockAlign := settings.Channels * settings.BitsPerSample / 8
 
-	w := bufio.NewWriter(f)
+	w := bufio.NewWriter(out)
 	// RIFF header
 	if _, err := w.Write([]byte{'R', 'I', 'F', 'F'}); err != nil { // ChunkID
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(0)); err != nil { // ChunkSize
+	if err := binary.Write(w, binary.LittleEndian, unknownSize); err != nil { // ChunkSize
 		return nil, err
 	}
 	if _, err := w.Write([]byte{'W', 'A', 'V', 'E'}); err != nil { // Format
@@ -68,11 +137,15 @@ func newFileWavDevice(settings deviceCommon.Settings) (File, error) {
 	if _, err := w.Write([]byte{'f', 'm', 't', ' '}); err != nil { // Subchunk1ID
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(16)); err != nil { // Subchunk1Size
+	subchunk1Size, audioFormat := uint32(16), uint16(wavFormatPCM)
+	if extensible {
+		subchunk1Size, audioFormat = 40, wavFormatExtensible
+	}
+	if err := binary.Write(w, binary.LittleEndian, subchunk1Size); err != nil { // Subchunk1Size
 		return nil, err
 	}
 	// = win32.WAVEFORMATEX (before the CbSize)
-	if err := binary.Write(w, binary.LittleEndian, uint16(0x001)); err != nil { // AudioFormat // = win32.WAVE_FORMAT_PCM
+	if err := binary.Write(w, binary.LittleEndian, audioFormat); err != nil { // AudioFormat
 		return nil, err
 	}
 	if err := binary.Write(w, binary.LittleEndian, uint16(settings.Channels)); err != nil { // NumChannels
@@ -90,16 +163,32 @@ func newFileWavDevice(settings deviceCommon.Settings) (File, error) {
 	if err := binary.Write(w, binary.LittleEndian, uint16(settings.BitsPerSample)); err != nil { // BitsPerSample
 		return nil, err
 	}
+	if extensible {
+		// = win32.WAVEFORMATEXTENSIBLE (from the CbSize)
+		if err := binary.Write(w, binary.LittleEndian, uint16(22)); err != nil { // CbSize
+			return nil, err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint16(settings.BitsPerSample)); err != nil { // ValidBitsPerSample
+			return nil, err
+		}
+		if err := binary.Write(w, binary.LittleEndian, wavChannelMask(settings.Channels)); err != nil { // ChannelMask
+			return nil, err
+		}
+		if _, err := w.Write(wavSubFormatPCM[:]); err != nil { // SubFormat
+			return nil, err
+		}
+	}
 
 	// data header
 	if _, err := w.Write([]byte{'d', 'a', 't', 'a'}); err != nil { // Subchunk2ID
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(0)); err != nil { // Subchunk2Size
+	if err := binary.Write(w, binary.LittleEndian, unknownSize); err != nil { // Subchunk2Size
 		return nil, err
 	}
 
 	fd.f = f
+	fd.ws = ws
 	fd.w = w
 
 	return &fd, nil
@@ -112,9 +201,11 @@ func (d *fileWav) Play(in <-chan *output.PremixData, onWrittenCallback WrittenCa
 
 // PlayWithCtx starts the wave output device playing
 func (d *fileWav) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData, onWrittenCallback WrittenCallback) error {
-	panmixer := mixing.GetPanMixer(d.mix.Channels)
-	if panmixer == nil {
-		return errors.New("invalid pan mixer - check channel count")
+	if d.surround == nil {
+		panmixer := mixing.GetPanMixer(d.mix.Channels)
+		if panmixer == nil {
+			return errors.New("invalid pan mixer - check channel count")
+		}
 	}
 
 	myCtx, cancel := context.WithCancel(ctx)
@@ -128,7 +219,14 @@ func (d *fileWav) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData,
 			if !ok {
 				return nil
 			}
-			mixedData := d.mix.Flatten(row.SamplesLen, row.Data, row.MixerVolume, d.sampFmt)
+			var mixedData []byte
+			if d.dither != nil {
+				mixedData = d.dither.Flatten(surround.Channels(d.surround, row, d.mix.Channels), d.sampFmt)
+			} else if d.surround != nil {
+				mixedData = d.surround.Flatten(row, d.sampFmt)
+			} else {
+				mixedData = d.mix.Flatten(row.SamplesLen, row.Data, row.MixerVolume, d.sampFmt)
+			}
 			sz, err := d.w.Write(mixedData)
 			if err != nil {
 				return err
@@ -143,27 +241,42 @@ func (d *fileWav) PlayWithCtx(ctx context.Context, in <-chan *output.PremixData,
 
 // Close closes the wave output device
 func (d *fileWav) Close() error {
-	d.w.Flush()
-	chunkSize := 36 + d.sz
-	if _, err := d.f.Seek(wavFileChunkSizePos, 0); err != nil {
-		return err
-	}
-	if err := binary.Write(d.w, binary.LittleEndian, uint32(chunkSize)); err != nil { // ChunkSize
-		return err
-	}
-	if _, err := d.f.Seek(wavFileSubchunk2SizePos, 0); err != nil {
-		return err
-	}
-	if err := binary.Write(d.w, binary.LittleEndian, uint32(d.sz)); err != nil { // Subchunk2Size
-		return err
-	}
 	if err := d.w.Flush(); err != nil {
 		return err
 	}
 	d.w = nil
-	return d.f.Close()
+
+	if d.ws != nil {
+		// the sizes are written straight to the output, as each one goes to a different position
+		chunkSize := uint32(d.subchunk2SizePos) - 4 + d.sz
+		if _, err := d.ws.Seek(wavFileChunkSizePos, 0); err != nil {
+			return err
+		}
+		if err := binary.Write(d.ws, binary.LittleEndian, uint32(chunkSize)); err != nil { // ChunkSize
+			return err
+		}
+		if _, err := d.ws.Seek(d.subchunk2SizePos, 0); err != nil {
+			return err
+		}
+		if err := binary.Write(d.ws, binary.LittleEndian, uint32(d.sz)); err != nil { // Subchunk2Size
+			return err
+		}
+	}
+
+	if d.f != nil {
+		return d.f.Close()
+	}
+	return nil
 }
 
 func init() {
-	fileDeviceMap[".wav"] = newFileWavDevice
+	fileDeviceMap[".wav"] = FileFormat{
+		Create: newFileWavDevice,
+		Capabilities: deviceCommon.Capabilities{
+			MinSampleRate: 8000,
+			MaxSampleRate: 192000,
+			BitsPerSample: []int{8, 16},
+			Channels:      []int{1, 2, 4, 6, 8},
+		},
+	}
 }
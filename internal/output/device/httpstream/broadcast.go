@@ -0,0 +1,96 @@
+package httpstream
+
+import (
+	"sync"
+)
+
+// Chunk is a block of rendered audio, separated by channel, with samples
+// scaled to the bits per sample of the stream
+type Chunk struct {
+	Samples [][]int32
+	Len     int
+}
+
+// listenerQueueSize is how many chunks a listener may fall behind before it is dropped
+const listenerQueueSize = 256
+
+type listener struct {
+	ch chan Chunk
+}
+
+// broadcaster fans chunks out to any number of listeners. Listeners only receive
+// chunks published after they subscribe, so late joiners start at the live position.
+type broadcaster struct {
+	mu        sync.Mutex
+	listeners map[*listener]struct{}
+	closed    bool
+}
+
+func newBroadcaster() *broadcaster {
+	b := broadcaster{
+		listeners: make(map[*listener]struct{}),
+	}
+	return &b
+}
+
+// Subscribe adds a listener. The returned channel is closed when the listener is
+// dropped for falling too far behind, or when the broadcaster is closed.
+func (b *broadcaster) Subscribe() (*listener, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, false
+	}
+
+	l := listener{
+		ch: make(chan Chunk, listenerQueueSize),
+	}
+	b.listeners[&l] = struct{}{}
+	return &l, true
+}
+
+// Unsubscribe removes a listener
+func (b *broadcaster) Unsubscribe(l *listener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.listeners[l]; ok {
+		delete(b.listeners, l)
+		close(l.ch)
+	}
+}
+
+// Publish sends the chunk to every listener, dropping any that can't keep up
+func (b *broadcaster) Publish(c Chunk) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for l := range b.listeners {
+		select {
+		case l.ch <- c:
+		default:
+			delete(b.listeners, l)
+			close(l.ch)
+		}
+	}
+}
+
+// Len returns the number of listeners
+func (b *broadcaster) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.listeners)
+}
+
+// Close drops all of the listeners and stops new ones from subscribing
+func (b *broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for l := range b.listeners {
+		delete(b.listeners, l)
+		close(l.ch)
+	}
+}
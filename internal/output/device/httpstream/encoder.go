@@ -0,0 +1,109 @@
+package httpstream
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// Format is the format of the audio in a stream
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// Encoder writes chunks of audio to a listener in a specific container format
+type Encoder interface {
+	WriteChunk(c Chunk) error
+	Close() error
+}
+
+// EncoderFactory creates an encoder that writes to w. The encoder is expected to
+// write any header it needs before returning.
+type EncoderFactory func(w io.Writer, f Format) (Encoder, error)
+
+// StreamFormat is the registration details for a container format that can be streamed
+type StreamFormat struct {
+	ContentType string
+	Create      EncoderFactory
+}
+
+var streamFormatMap = make(map[string]StreamFormat)
+
+// GetStreamFormats returns the names of the formats that can be streamed (e.g.: wav)
+func GetStreamFormats() []string {
+	var names []string
+	for name := range streamFormatMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wavEncoder writes an endless WAVE stream - the sizes in the header are set to
+// their maximum, which is what players expect for a stream of unknown length
+type wavEncoder struct {
+	w   io.Writer
+	f   Format
+	buf []byte
+}
+
+func newWavEncoder(w io.Writer, f Format) (Encoder, error) {
+	e := wavEncoder{
+		w: w,
+		f: f,
+	}
+
+	byteRate := f.SampleRate * f.Channels * f.BitsPerSample / 8
+	blockAlign := f.Channels * f.BitsPerSample / 8
+
+	hdr := make([]byte, 0, 44)
+	hdr = append(hdr, 'R', 'I', 'F', 'F')
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0xFFFFFFFF) // ChunkSize
+	hdr = append(hdr, 'W', 'A', 'V', 'E')
+	hdr = append(hdr, 'f', 'm', 't', ' ')
+	hdr = binary.LittleEndian.AppendUint32(hdr, 16)     // Subchunk1Size
+	hdr = binary.LittleEndian.AppendUint16(hdr, 0x0001) // AudioFormat // = win32.WAVE_FORMAT_PCM
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(f.Channels))
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(f.SampleRate))
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(byteRate))
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(blockAlign))
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(f.BitsPerSample))
+	hdr = append(hdr, 'd', 'a', 't', 'a')
+	hdr = binary.LittleEndian.AppendUint32(hdr, 0xFFFFFFFF) // Subchunk2Size
+
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (e *wavEncoder) WriteChunk(c Chunk) error {
+	e.buf = e.buf[:0]
+	for i := 0; i < c.Len; i++ {
+		for ch := 0; ch < e.f.Channels; ch++ {
+			v := c.Samples[ch][i]
+			switch e.f.BitsPerSample {
+			case 8:
+				// 8-bit WAVE data is unsigned
+				e.buf = append(e.buf, byte(v+128))
+			case 16:
+				e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(int16(v)))
+			}
+		}
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+func (e *wavEncoder) Close() error {
+	return nil
+}
+
+func init() {
+	streamFormatMap["wav"] = StreamFormat{
+		ContentType: "audio/wav",
+		Create:      newWavEncoder,
+	}
+}
@@ -0,0 +1,98 @@
+//go:build flac
+// +build flac
+
+package httpstream
+
+import (
+	"errors"
+	"io"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// flacEncoder writes a FLAC stream - as the writer can't seek, the stream info
+// is left without the totals that a file would normally have
+type flacEncoder struct {
+	enc      *flac.Encoder
+	f        Format
+	channels frame.Channels
+}
+
+func newFlacEncoder(w io.Writer, f Format) (Encoder, error) {
+	e := flacEncoder{
+		f: f,
+	}
+
+	switch f.Channels {
+	case 1:
+		e.channels = frame.ChannelsMono
+	case 2:
+		e.channels = frame.ChannelsLR
+	case 4:
+		e.channels = frame.ChannelsLRLsRs
+	case 6:
+		e.channels = frame.ChannelsLRCLfeLsRs
+	case 8:
+		e.channels = frame.ChannelsLRCLfeLsRsSlSr
+	default:
+		return nil, errors.New("invalid channel count")
+	}
+
+	si := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  65535,
+		SampleRate:    uint32(f.SampleRate),
+		NChannels:     uint8(f.Channels),
+		BitsPerSample: uint8(f.BitsPerSample),
+	}
+	enc, err := flac.NewEncoder(w, si)
+	if err != nil {
+		return nil, err
+	}
+	enc.EnablePredictionAnalysis(true)
+	e.enc = enc
+	return &e, nil
+}
+
+func (e *flacEncoder) WriteChunk(c Chunk) error {
+	if c.Len < 16 {
+		// FLAC frames have a minimum block size - anything smaller is dropped
+		return nil
+	}
+
+	subframes := make([]*frame.Subframe, e.f.Channels)
+	for i := range subframes {
+		subframes[i] = &frame.Subframe{
+			SubHeader: frame.SubHeader{
+				Pred: frame.PredVerbatim,
+			},
+			Samples:  c.Samples[i][:c.Len],
+			NSamples: c.Len,
+		}
+	}
+
+	fr := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: false,
+			BlockSize:         uint16(c.Len),
+			SampleRate:        uint32(e.f.SampleRate),
+			Channels:          e.channels,
+			BitsPerSample:     uint8(e.f.BitsPerSample),
+		},
+		Subframes: subframes,
+	}
+	return e.enc.WriteFrame(fr)
+}
+
+func (e *flacEncoder) Close() error {
+	return e.enc.Close()
+}
+
+func init() {
+	streamFormatMap["flac"] = StreamFormat{
+		ContentType: "audio/flac",
+		Create:      newFlacEncoder,
+	}
+}
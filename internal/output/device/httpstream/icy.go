@@ -0,0 +1,76 @@
+package httpstream
+
+import (
+	"io"
+	"strings"
+)
+
+// icyMetaInt is the number of audio bytes between each ICY metadata block
+const icyMetaInt = 16000
+
+// icyWriter interleaves ICY (SHOUTcast-style) metadata blocks into an audio stream.
+// A block is sent every icyMetaInt bytes of audio - it's empty unless the title
+// has changed since the last one that was sent.
+type icyWriter struct {
+	w         io.Writer
+	title     func() string
+	remaining int
+	lastTitle string
+	sentTitle bool
+}
+
+func newIcyWriter(w io.Writer, title func() string) *icyWriter {
+	iw := icyWriter{
+		w:         w,
+		title:     title,
+		remaining: icyMetaInt,
+	}
+	return &iw
+}
+
+func (iw *icyWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), iw.remaining)
+		if _, err := iw.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+		iw.remaining -= n
+
+		if iw.remaining == 0 {
+			if err := iw.writeMetadata(); err != nil {
+				return written, err
+			}
+			iw.remaining = icyMetaInt
+		}
+	}
+	return written, nil
+}
+
+func (iw *icyWriter) writeMetadata() error {
+	title := iw.title()
+	if iw.sentTitle && title == iw.lastTitle {
+		_, err := iw.w.Write([]byte{0})
+		return err
+	}
+
+	// the metadata block length is stored in 16-byte units, so the title is limited in length
+	meta := "StreamTitle='" + strings.ReplaceAll(title, "'", "’") + "';"
+	if len(meta) > 255*16 {
+		meta = meta[:255*16]
+	}
+	blocks := (len(meta) + 15) / 16
+
+	buf := make([]byte, 1+blocks*16)
+	buf[0] = byte(blocks)
+	copy(buf[1:], meta)
+	if _, err := iw.w.Write(buf); err != nil {
+		return err
+	}
+
+	iw.lastTitle = title
+	iw.sentTitle = true
+	return nil
+}
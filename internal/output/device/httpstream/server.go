@@ -0,0 +1,254 @@
+package httpstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/logging"
+)
+
+// Config is the configuration of an HTTP stream server
+type Config struct {
+	Listen string // address to listen on (e.g.: :8000)
+	Name   string // name of the stream, reported to listeners
+	Format Format
+}
+
+// Server serves the published audio to any number of HTTP listeners
+type Server struct {
+	cfg     Config
+	srv     *http.Server
+	ln      net.Listener
+	b       *broadcaster
+	logger  logging.Log
+	started time.Time
+
+	mu     sync.RWMutex
+	title  string
+	artist string
+	order  int
+	row    int
+}
+
+// New creates the server and starts listening for connections
+func New(cfg Config, logger logging.Log) (*Server, error) {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{
+		cfg:     cfg,
+		ln:      ln,
+		b:       newBroadcaster(),
+		logger:  logger,
+		started: time.Now(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		s.handleStream(w, r, "wav")
+	})
+	for _, name := range GetStreamFormats() {
+		mux.HandleFunc("/stream."+name, func(w http.ResponseWriter, r *http.Request) {
+			s.handleStream(w, r, name)
+		})
+	}
+
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Println(err)
+		}
+	}()
+
+	return &s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Listeners returns the number of connected listeners
+func (s *Server) Listeners() int {
+	return s.b.Len()
+}
+
+// Publish sends the chunk of audio to all of the connected listeners
+func (s *Server) Publish(c Chunk) {
+	s.b.Publish(c)
+}
+
+// SetMetadata updates the description of what's currently playing
+func (s *Server) SetMetadata(title, artist string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.title, s.artist = title, artist
+}
+
+// SetPosition updates the current playback position
+func (s *Server) SetPosition(order, row int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.order, s.row = order, row
+}
+
+// Close disconnects all listeners and stops the server
+func (s *Server) Close() error {
+	s.b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) streamTitle() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.artist != "" {
+		return s.artist + " - " + s.title
+	}
+	return s.title
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, name string) {
+	sf, ok := streamFormatMap[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	l, ok := s.b.Subscribe()
+	if !ok {
+		http.Error(w, "stream has ended", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.b.Unsubscribe(l)
+
+	w.Header().Set("Content-Type", sf.ContentType)
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.Header().Set("icy-name", s.cfg.Name)
+
+	var out io.Writer = w
+	if r.Header.Get("Icy-MetaData") == "1" {
+		w.Header().Set("icy-metaint", strconv.Itoa(icyMetaInt))
+		out = newIcyWriter(w, s.streamTitle)
+	}
+
+	enc, err := sf.Create(out, s.cfg.Format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer enc.Close()
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case c, ok := <-l.ch:
+			if !ok {
+				return
+			}
+			if err := enc.WriteChunk(c); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	status := map[string]any{
+		"name":      s.cfg.Name,
+		"title":     s.title,
+		"artist":    s.artist,
+		"listeners": s.b.Len(),
+		"position": map[string]any{
+			"order": s.order,
+			"row":   s.row,
+		},
+		"format": map[string]any{
+			"sample_rate":     s.cfg.Format.SampleRate,
+			"channels":        s.cfg.Format.Channels,
+			"bits_per_sample": s.cfg.Format.BitsPerSample,
+		},
+		"streams":        s.streamPaths(),
+		"uptime_seconds": int(time.Since(s.started).Seconds()),
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	_ = json.NewEncoder(w).Encode(status) // lint
+}
+
+func (s *Server) streamPaths() []string {
+	var paths []string
+	for _, name := range GetStreamFormats() {
+		paths = append(paths, "/stream."+name)
+	}
+	return paths
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var links []string
+	for _, p := range s.streamPaths() {
+		links = append(links, fmt.Sprintf(`<a href="%[1]s">%[1]s</a>`, p))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, indexPage, html.EscapeString(s.cfg.Name), strings.Join(links, " "))
+}
+
+const indexPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%[1]s</title></head>
+<body>
+<h1>%[1]s</h1>
+<p>Now playing: <span id="title"></span></p>
+<audio controls autoplay src="/stream"></audio>
+<p>Streams: %[2]s - status: <a href="/status">/status</a></p>
+<script>
+async function update() {
+	try {
+		const s = await (await fetch("/status")).json();
+		document.getElementById("title").textContent = s.artist ? s.artist + " - " + s.title : s.title;
+	} catch (e) {}
+}
+update();
+setInterval(update, 5000);
+</script>
+</body>
+</html>
+`
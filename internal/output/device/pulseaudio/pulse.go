@@ -5,91 +5,378 @@ package pulseaudio
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/jfreymuth/pulse"
 	"github.com/jfreymuth/pulse/proto"
 )
 
 type Client struct {
-	pc    *pulse.Client
-	chmap proto.ChannelMap
-	strm  *pulse.PlaybackStream
-	ch    chan []byte
-	r     bytes.Buffer
+	cfg       Config
+	chmap     proto.ChannelMap
+	format    byte
+	ch        chan []byte   // never closed, as Output may be sending on it
+	closed    chan struct{} // closed when the client is closed
+	closeOnce sync.Once
+
+	connMu sync.Mutex // protects the connection state below
+	pc     *pulse.Client
+	strm   *pulse.PlaybackStream
+	done   chan struct{} // closed when the current stream is torn down
+	title  string
+	artist string
+
+	mu sync.Mutex // protects r
+	r  bytes.Buffer
+}
+
+// SampleFormat is the format of the samples sent to the server
+type SampleFormat int
+
+const (
+	// SampleFormatInt16 is signed, little-endian 16-bit samples
+	SampleFormatInt16 = SampleFormat(iota)
+	// SampleFormatUint8 is unsigned 8-bit samples
+	SampleFormatUint8
+	// SampleFormatFloat32 is little-endian, 32-bit floating-point samples
+	SampleFormatFloat32
+)
+
+// Config is the configuration of a PulseAudio client
+type Config struct {
+	AppName    string
+	SampleRate int
+	Channels   int
+	Format     SampleFormat
+	Sink       string        // blank = server default
+	Latency    time.Duration // 0 = client default
+	Server     string        // blank = default server (see PULSE_SERVER)
+
+	ReconnectTimeout time.Duration // how long to keep trying to reconnect after losing the server (0 = don't reconnect)
+}
+
+// Sink describes an output device on the server
+type Sink struct {
+	ID          string
+	Description string
+	Default     bool
+}
+
+const (
+	// updateModeReplace replaces the provided properties, leaving any others in place (PA_UPDATE_REPLACE)
+	updateModeReplace = 2
+
+	// streamCheckInterval is how often a blocked Output checks whether the stream is still alive
+	streamCheckInterval = 250 * time.Millisecond
+
+	reconnectBackoffMin = 100 * time.Millisecond
+	reconnectBackoffMax = 5 * time.Second
+)
+
+func newClient(cfg Config) (*pulse.Client, error) {
+	opts := []pulse.ClientOption{
+		pulse.ClientApplicationName(cfg.AppName),
+	}
+	server := cfg.Server
+	if server == "" {
+		server = os.Getenv("PULSE_SERVER")
+	}
+	if server != "" {
+		opts = append(opts, pulse.ClientServerString(server))
+	}
+	return pulse.NewClient(opts...)
 }
 
-func New(appName string, sampleRate int, channels int, bitsPerSample int) (*Client, error) {
-	pa := Client{}
+// ListSinks returns the output devices available on the server
+func ListSinks(cfg Config) ([]Sink, error) {
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
 
-	switch channels {
+	sinks, err := c.ListSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultID string
+	if def, err := c.DefaultSink(); err == nil {
+		defaultID = def.ID()
+	}
+
+	list := make([]Sink, len(sinks))
+	for i, sink := range sinks {
+		list[i] = Sink{
+			ID:          sink.ID(),
+			Description: sink.Name(),
+			Default:     sink.ID() == defaultID,
+		}
+	}
+	return list, nil
+}
+
+func New(cfg Config) (*Client, error) {
+	pa := Client{
+		cfg: cfg,
+	}
+
+	switch cfg.Channels {
 	case 1:
 		pa.chmap = append(pa.chmap, proto.ChannelMono)
 	case 2:
 		pa.chmap = append(pa.chmap, proto.ChannelLeft, proto.ChannelRight)
 	case 4:
 		pa.chmap = append(pa.chmap, proto.ChannelFrontLeft, proto.ChannelFrontRight, proto.ChannelRearLeft, proto.ChannelRearRight)
+	case 6:
+		pa.chmap = append(pa.chmap, proto.ChannelFrontLeft, proto.ChannelFrontRight, proto.ChannelFrontCenter, proto.ChannelLFE, proto.ChannelRearLeft, proto.ChannelRearRight)
+	case 8:
+		pa.chmap = append(pa.chmap, proto.ChannelFrontLeft, proto.ChannelFrontRight, proto.ChannelFrontCenter, proto.ChannelLFE, proto.ChannelRearLeft, proto.ChannelRearRight, proto.ChannelLeftSide, proto.ChannelRightSide)
+	default:
+		return nil, fmt.Errorf("unsupported number of channels: %d", cfg.Channels)
 	}
 
-	var r pulse.Reader
-	switch bitsPerSample {
-	case 8:
-		r = pulse.NewReader(&pa, proto.FormatUint8)
-	case 16:
-		r = pulse.NewReader(&pa, proto.FormatInt16LE)
+	switch cfg.Format {
+	case SampleFormatUint8:
+		pa.format = proto.FormatUint8
+	case SampleFormatInt16:
+		pa.format = proto.FormatInt16LE
+	case SampleFormatFloat32:
+		pa.format = proto.FormatFloat32LE
+	default:
+		return nil, fmt.Errorf("unsupported sample format: %d", cfg.Format)
 	}
 
-	c, err := pulse.NewClient(pulse.ClientApplicationName(appName))
-	if err != nil {
+	pa.ch = make(chan []byte)
+	pa.closed = make(chan struct{})
+
+	if err := pa.connect(); err != nil {
 		return nil, err
 	}
-	pa.pc = c
 
-	pa.ch = make(chan []byte)
+	return &pa, nil
+}
 
-	strm, err := c.NewPlayback(r,
-		pulse.PlaybackSampleRate(sampleRate),
-		pulse.PlaybackLatency(0.1),
-		pulse.PlaybackChannels(pa.chmap))
+// connect opens the connection to the server and starts a new playback stream
+func (pa *Client) connect() error {
+	c, err := newClient(pa.cfg)
+	if err != nil {
+		return err
+	}
+
+	latency := 0.1
+	if pa.cfg.Latency > 0 {
+		latency = pa.cfg.Latency.Seconds()
+	}
+
+	opts := []pulse.PlaybackOption{
+		pulse.PlaybackSampleRate(pa.cfg.SampleRate),
+		pulse.PlaybackLatency(latency),
+		pulse.PlaybackChannels(pa.chmap),
+	}
+
+	if pa.cfg.Sink != "" {
+		sink, err := c.SinkByID(pa.cfg.Sink)
+		if err != nil {
+			c.Close()
+			return fmt.Errorf("could not find sink %q: %w", pa.cfg.Sink, err)
+		}
+		opts = append(opts, pulse.PlaybackSink(sink))
+	}
+
+	done := make(chan struct{})
+	strm, err := c.NewPlayback(pulse.NewReader(&streamReader{pa: pa, done: done}, pa.format), opts...)
 	if err != nil {
 		c.Close()
-		close(pa.ch)
-		return nil, err
+		return err
 	}
+	pa.pc = c
 	pa.strm = strm
-	// we need to prime the buffer with empty data, otherwise it'll stall out
-	pa.r.Write(make([]byte, pa.strm.BufferSizeBytes()))
+	pa.done = done
+
+	// we need to prime the buffer with empty data, otherwise it'll stall out.
+	// anything still buffered from a previous stream is kept, so no audio is dropped
+	pa.mu.Lock()
+	pending := pa.r.Bytes()
+	pa.r = *bytes.NewBuffer(make([]byte, pa.strm.BufferSizeBytes(), pa.strm.BufferSizeBytes()+len(pending)))
+	pa.r.Write(pending)
+	pa.mu.Unlock()
+
 	pa.strm.Start()
+	return nil
+}
 
-	return &pa, nil
+// disconnect tears down the playback stream and the connection to the server
+func (pa *Client) disconnect() {
+	if pa.done != nil {
+		close(pa.done)
+		pa.done = nil
+	}
+	if pa.strm != nil {
+		pa.strm.Close()
+		pa.strm = nil
+	}
+	if pa.pc != nil {
+		pa.pc.Close()
+		pa.pc = nil
+	}
+}
+
+// reconnect replaces a lost connection, retrying with an increasing delay until the reconnect timeout expires
+func (pa *Client) reconnect(ctx context.Context, cause error) error {
+	pa.disconnect()
+
+	if pa.cfg.ReconnectTimeout <= 0 {
+		return fmt.Errorf("lost connection to the PulseAudio server: %w", cause)
+	}
+
+	deadline := time.Now().Add(pa.cfg.ReconnectTimeout)
+	backoff := reconnectBackoffMin
+	for {
+		err := pa.connect()
+		if err == nil {
+			if pa.title != "" || pa.artist != "" {
+				// best effort - the audio matters more than the description of it
+				_ = pa.setMetadata()
+			}
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("lost connection to the PulseAudio server and could not reconnect within %v: %w", pa.cfg.ReconnectTimeout, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-pa.closed:
+			return io.ErrClosedPipe
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectBackoffMax)
+	}
 }
 
-func (pa *Client) Output(data []byte) {
-	pa.ch <- data
+// SetMetadata updates the media properties of the playback stream, which are shown by desktop mixers
+func (pa *Client) SetMetadata(title, artist string) error {
+	pa.connMu.Lock()
+	defer pa.connMu.Unlock()
+
+	pa.title, pa.artist = title, artist
+	if pa.strm == nil || pa.strm.Closed() {
+		// it'll be applied when the stream is reconnected
+		return nil
+	}
+	return pa.setMetadata()
 }
 
-func (pa *Client) Read(p []byte) (int, error) {
-	needed := len(p)
+func (pa *Client) setMetadata() error {
+	name := pa.title
+	if pa.artist != "" {
+		name = pa.artist + " - " + pa.title
+	}
+
+	// the artist is always replaced, so one from a previous entry doesn't linger
+	props := proto.PropList{
+		"media.name":   proto.PropListString(name),
+		"media.title":  proto.PropListString(pa.title),
+		"media.artist": proto.PropListString(pa.artist),
+	}
+
+	return pa.pc.RawRequest(&proto.UpdatePlaybackStreamProplist{
+		StreamIndex: pa.strm.StreamIndex(),
+		Mode:        updateModeReplace,
+		Properties:  props,
+	}, nil)
+}
+
+// Output queues the data for playback, reconnecting to the server if the stream was lost
+func (pa *Client) Output(ctx context.Context, data []byte) error {
 	for {
-		if pa.r.Len() >= needed {
-			return pa.r.Read(p)
+		if err := pa.checkConnection(ctx); err != nil {
+			return err
 		}
-		buf, ok := <-pa.ch
-		if !ok {
-			return 0, io.ErrClosedPipe
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-pa.closed:
+			return io.ErrClosedPipe
+		case pa.ch <- data:
+			return nil
+		case <-time.After(streamCheckInterval):
 		}
-		pa.r = *bytes.NewBuffer(pa.r.Bytes())
-		pa.r.Write(buf)
 	}
 }
 
-func (pa *Client) Close() error {
-	if pa.strm != nil {
-		pa.strm.Close()
+// checkConnection reconnects to the server if the playback stream was lost
+func (pa *Client) checkConnection(ctx context.Context) error {
+	pa.connMu.Lock()
+	defer pa.connMu.Unlock()
+
+	select {
+	case <-pa.closed:
+		return io.ErrClosedPipe
+	default:
 	}
-	if pa.pc != nil {
-		pa.pc.Close()
+	if pa.strm != nil && !pa.strm.Closed() {
+		return nil
 	}
-	close(pa.ch)
+
+	var cause error = pulse.ErrConnectionClosed
+	if pa.strm != nil {
+		if err := pa.strm.Error(); err != nil {
+			cause = err
+		}
+	}
+	return pa.reconnect(ctx, cause)
+}
+
+// Close stops playback and closes the connection to the server. Output calls that are waiting,
+// or made afterwards, fail.
+func (pa *Client) Close() error {
+	pa.closeOnce.Do(func() {
+		close(pa.closed)
+	})
+
+	pa.connMu.Lock()
+	defer pa.connMu.Unlock()
+
+	pa.disconnect()
 	return nil
 }
+
+// streamReader feeds a single playback stream from the client's buffer
+type streamReader struct {
+	pa   *Client
+	done chan struct{}
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	pa := sr.pa
+	needed := len(p)
+	for {
+		pa.mu.Lock()
+		if pa.r.Len() >= needed {
+			n, err := pa.r.Read(p)
+			pa.mu.Unlock()
+			return n, err
+		}
+		pa.mu.Unlock()
+
+		select {
+		case <-sr.done:
+			return 0, io.ErrClosedPipe
+		case buf := <-pa.ch:
+			pa.mu.Lock()
+			pa.r = *bytes.NewBuffer(pa.r.Bytes())
+			pa.r.Write(buf)
+			pa.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,734 @@
+//go:build linux || pulseaudio
+// +build linux pulseaudio
+
+package pulseaudio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// fakeProtocolVersion is the protocol version the fake server speaks - the lowest that has
+// stream properties, which keeps the messages it has to understand short
+const fakeProtocolVersion = 13
+
+// fakeRequestSize is how much audio the fake server asks for at a time
+const fakeRequestSize = 1024
+
+type fakeSink struct {
+	name        string
+	description string
+}
+
+type fakeStream struct {
+	spec      proto.SampleSpec
+	sinkIndex uint32
+	target    uint32 // buffer length the client asked for
+	data      []byte // played
+}
+
+// fakeServer is a stand-in PulseAudio server. It speaks just enough of the native protocol for
+// the client: it has a fixed list of sinks (the last is the default), accepts playback streams
+// and records what's sent to them.
+type fakeServer struct {
+	t     *testing.T
+	ln    net.Listener
+	sinks []fakeSink
+
+	mu        sync.Mutex
+	changed   chan struct{} // signalled whenever the recorded state changes
+	conns     []net.Conn    // open client connections
+	refuse    int           // connections still to be refused, as a server that's down does
+	refused   int
+	streams   []*fakeStream
+	proplists []map[string]string // of the stream property updates, in order
+}
+
+func newFakeServer(t *testing.T, sinks ...fakeSink) *fakeServer {
+	t.Helper()
+
+	// the client would otherwise read the user's cookie, if there is one
+	t.Setenv("PULSE_COOKIE", filepath.Join(t.TempDir(), "cookie"))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		t:       t,
+		ln:      ln,
+		sinks:   sinks,
+		changed: make(chan struct{}, 1),
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			refuse := s.refuse > 0
+			if refuse {
+				s.refuse--
+				s.refused++
+			}
+			s.mu.Unlock()
+			if refuse {
+				conn.Close()
+				continue
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// Server returns the server string that connects to the fake server
+func (s *fakeServer) Server() string {
+	return "tcp:" + s.ln.Addr().String()
+}
+
+func (s *fakeServer) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// waitFor waits until cond is true of the server's state
+func (s *fakeServer) waitFor(what string, cond func() bool) {
+	s.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		s.mu.Lock()
+		ok := cond()
+		s.mu.Unlock()
+		if ok {
+			return
+		}
+		select {
+		case <-s.changed:
+		case <-timeout:
+			s.t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// drop closes the connections of the clients, as a server that's restarted does
+func (s *fakeServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+
+	var writeMu sync.Mutex
+	send := func(channel uint32, body []byte) {
+		var hdr [20]byte
+		binary.BigEndian.PutUint32(hdr[0:], uint32(len(body)))
+		binary.BigEndian.PutUint32(hdr[4:], channel)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.Write(hdr[:])
+		conn.Write(body)
+	}
+	command := func(op, tag uint32, args *tagWriter) {
+		var w tagWriter
+		w.u32(op)
+		w.u32(tag)
+		if args != nil {
+			w.Write(args.Bytes())
+		}
+		send(proto.Undefined, w.Bytes())
+	}
+	reply := func(tag uint32, args *tagWriter) {
+		command(proto.OpReply, tag, args)
+	}
+	fail := func(tag uint32, err proto.Error) {
+		var w tagWriter
+		w.u32(uint32(err))
+		command(proto.OpError, tag, &w)
+	}
+
+	for {
+		var hdr [20]byte
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(hdr[0:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		if channel := binary.BigEndian.Uint32(hdr[4:]); channel != proto.Undefined {
+			// audio for a playback stream - ask for more, as a server playing it would
+			s.mu.Lock()
+			if int(channel) < len(s.streams) {
+				s.streams[channel].data = append(s.streams[channel].data, body...)
+			}
+			s.mu.Unlock()
+			s.notify()
+
+			var w tagWriter
+			w.u32(channel)
+			w.u32(fakeRequestSize)
+			command(proto.OpRequest, proto.Undefined, &w)
+			continue
+		}
+
+		r := tagReader{b: body}
+		op, _ := r.next().(uint32)
+		tag, _ := r.next().(uint32)
+		args := r.all()
+		if r.err != nil {
+			s.t.Errorf("could not decode command %d: %v", op, r.err)
+			return
+		}
+
+		switch op {
+		case proto.OpAuth:
+			var w tagWriter
+			w.u32(fakeProtocolVersion)
+			reply(tag, &w)
+
+		case proto.OpSetClientName:
+			var w tagWriter
+			w.u32(1) // client index
+			reply(tag, &w)
+
+		case proto.OpGetSinkInfoList:
+			var w tagWriter
+			for i := range s.sinks {
+				s.writeSinkInfo(&w, i)
+			}
+			reply(tag, &w)
+
+		case proto.OpGetSinkInfo:
+			// by index, or by name, or the default sink if neither is given
+			idx := len(s.sinks) - 1
+			if i := args[0].(uint32); i != proto.Undefined {
+				idx = int(i)
+			} else if name := args[1].(string); name != "" {
+				idx = -1
+				for i, sink := range s.sinks {
+					if sink.name == name {
+						idx = i
+					}
+				}
+			}
+			if idx < 0 || idx >= len(s.sinks) {
+				fail(tag, proto.ErrNoSuchEntity)
+				continue
+			}
+			var w tagWriter
+			s.writeSinkInfo(&w, idx)
+			reply(tag, &w)
+
+		case proto.OpCreatePlaybackStream:
+			// sample spec, channel map, sink index, sink name, max length, corked, target length
+			stream := &fakeStream{
+				spec:      args[0].(proto.SampleSpec),
+				sinkIndex: args[2].(uint32),
+				target:    args[6].(uint32),
+			}
+			s.mu.Lock()
+			index := uint32(len(s.streams))
+			s.streams = append(s.streams, stream)
+			s.mu.Unlock()
+			s.notify()
+
+			sinkIndex := stream.sinkIndex
+			if sinkIndex == proto.Undefined {
+				sinkIndex = uint32(len(s.sinks) - 1)
+			}
+			var w tagWriter
+			w.u32(index)              // stream index
+			w.u32(index)              // sink input index
+			w.u32(0)                  // missing
+			w.u32(2 * stream.target)  // max length
+			w.u32(stream.target)      // target length
+			w.u32(stream.target)      // prebuffer length
+			w.u32(fakeRequestSize)    // minimum request
+			w.sampleSpec(stream.spec) // sample spec
+			w.channelMap(args[1].([]byte))
+			w.u32(sinkIndex)
+			w.str(s.sinks[sinkIndex].name)
+			w.boolean(false) // suspended
+			w.usec(0)        // sink latency
+			reply(tag, &w)
+
+		case proto.OpCorkPlaybackStream:
+			reply(tag, nil)
+			if corked := args[1].(bool); !corked {
+				var w tagWriter
+				w.u32(args[0].(uint32))
+				command(proto.OpStarted, proto.Undefined, &w)
+			}
+
+		case proto.OpUpdatePlaybackStreamProplist:
+			if mode := args[1].(uint32); mode != updateModeReplace {
+				s.t.Errorf("stream properties updated with mode %d, expected %d", mode, updateModeReplace)
+			}
+			s.mu.Lock()
+			s.proplists = append(s.proplists, args[2].(map[string]string))
+			s.mu.Unlock()
+			s.notify()
+			reply(tag, nil)
+
+		case proto.OpFlushPlaybackStream, proto.OpDeletePlaybackStream:
+			reply(tag, nil)
+
+		default:
+			fail(tag, proto.ErrNotSupported)
+		}
+	}
+}
+
+func (s *fakeServer) writeSinkInfo(w *tagWriter, idx int) {
+	sink := s.sinks[idx]
+	w.u32(uint32(idx))
+	w.str(sink.name)
+	w.str(sink.description)
+	w.sampleSpec(proto.SampleSpec{Format: proto.FormatInt16LE, Channels: 2, Rate: 44100})
+	w.channelMap([]byte{proto.ChannelLeft, proto.ChannelRight})
+	w.u32(0) // module index
+	w.volumes(2)
+	w.boolean(false) // muted
+	w.u32(0)         // monitor source index
+	w.str("")        // monitor source name
+	w.usec(0)        // latency
+	w.str("fake")    // driver
+	w.u32(0)         // flags
+	w.props(nil)     // properties
+	w.usec(0)        // requested latency
+}
+
+// tagWriter writes the tagged values of the native protocol
+type tagWriter struct {
+	bytes.Buffer
+}
+
+func (w *tagWriter) u32(v uint32) {
+	w.WriteByte('L')
+	w.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (w *tagWriter) str(v string) {
+	if v == "" {
+		w.WriteByte('N')
+		return
+	}
+	w.WriteByte('t')
+	w.WriteString(v)
+	w.WriteByte(0)
+}
+
+func (w *tagWriter) boolean(v bool) {
+	if v {
+		w.WriteByte('1')
+	} else {
+		w.WriteByte('0')
+	}
+}
+
+func (w *tagWriter) usec(v uint64) {
+	w.WriteByte('U')
+	w.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (w *tagWriter) sampleSpec(v proto.SampleSpec) {
+	w.WriteByte('a')
+	w.WriteByte(v.Format)
+	w.WriteByte(v.Channels)
+	w.Write(binary.BigEndian.AppendUint32(nil, v.Rate))
+}
+
+func (w *tagWriter) channelMap(v []byte) {
+	w.WriteByte('m')
+	w.WriteByte(byte(len(v)))
+	w.Write(v)
+}
+
+func (w *tagWriter) volumes(channels int) {
+	w.WriteByte('v')
+	w.WriteByte(byte(channels))
+	for range channels {
+		w.Write(binary.BigEndian.AppendUint32(nil, 0x10000))
+	}
+}
+
+func (w *tagWriter) props(v map[string]string) {
+	w.WriteByte('P')
+	for k, v := range v {
+		w.str(k)
+		w.u32(uint32(len(v) + 1))
+		w.WriteByte('x')
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(v)+1)))
+		w.WriteString(v)
+		w.WriteByte(0)
+	}
+	w.WriteByte('N')
+}
+
+// tagReader reads the tagged values of the native protocol
+type tagReader struct {
+	b   []byte
+	err error
+}
+
+var errShortMessage = errors.New("message too short")
+
+func (r *tagReader) take(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errShortMessage
+		return make([]byte, n)
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *tagReader) u32() uint32 {
+	return binary.BigEndian.Uint32(r.take(4))
+}
+
+func (r *tagReader) cstring() string {
+	i := bytes.IndexByte(r.b, 0)
+	if i < 0 {
+		r.err = errShortMessage
+		return ""
+	}
+	return string(r.take(i + 1)[:i])
+}
+
+func (r *tagReader) props() map[string]string {
+	m := make(map[string]string)
+	for r.err == nil {
+		if r.take(1)[0] == 'N' {
+			break
+		}
+		key := r.cstring()
+		r.take(1) // L
+		r.u32()
+		r.take(1) // x
+		value := r.take(int(r.u32()))
+		m[key] = strings.TrimSuffix(string(value), "\x00")
+	}
+	return m
+}
+
+// next reads a value, returning it as the closest Go type
+func (r *tagReader) next() any {
+	switch tag := r.take(1)[0]; tag {
+	case 'L', 'V':
+		return r.u32()
+	case 't':
+		return r.cstring()
+	case 'N':
+		return ""
+	case 'B':
+		return r.take(1)[0]
+	case '1', '0':
+		return tag == '1'
+	case 'R', 'U', 'r':
+		return binary.BigEndian.Uint64(r.take(8))
+	case 'T':
+		return [2]uint32{r.u32(), r.u32()}
+	case 'a':
+		b := r.take(2)
+		return proto.SampleSpec{Format: b[0], Channels: b[1], Rate: r.u32()}
+	case 'x':
+		return r.take(int(r.u32()))
+	case 'm':
+		return r.take(int(r.take(1)[0]))
+	case 'v':
+		v := make([]uint32, r.take(1)[0])
+		for i := range v {
+			v[i] = r.u32()
+		}
+		return v
+	case 'P':
+		return r.props()
+	case 'f':
+		r.take(1) // B
+		enc := r.take(1)[0]
+		r.take(1) // P
+		return proto.FormatInfo{Encoding: enc, Properties: nil}
+	default:
+		if r.err == nil {
+			r.err = errors.New("unknown tag " + string(tag))
+		}
+		return nil
+	}
+}
+
+// all reads the rest of the values
+func (r *tagReader) all() []any {
+	var values []any
+	for r.err == nil && len(r.b) > 0 {
+		values = append(values, r.next())
+	}
+	return values
+}
+
+func TestListSinks(t *testing.T) {
+	s := newFakeServer(t,
+		fakeSink{name: "alsa_output.analog", description: "Built-in Audio"},
+		fakeSink{name: "bluez_sink.headphones", description: "Headphones"},
+	)
+
+	sinks, err := ListSinks(Config{AppName: "test", Server: s.Server()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Sink{
+		{ID: "alsa_output.analog", Description: "Built-in Audio"},
+		{ID: "bluez_sink.headphones", Description: "Headphones", Default: true},
+	}
+	if len(sinks) != len(expected) {
+		t.Fatalf("got %d sinks, expected %d: %+v", len(sinks), len(expected), sinks)
+	}
+	for i := range expected {
+		if sinks[i] != expected[i] {
+			t.Errorf("sink %d: got %+v, expected %+v", i, sinks[i], expected[i])
+		}
+	}
+}
+
+func TestUnknownSink(t *testing.T) {
+	s := newFakeServer(t, fakeSink{name: "only", description: "Only"})
+
+	_, err := New(Config{
+		AppName:    "test",
+		SampleRate: 44100,
+		Channels:   2,
+		Sink:       "missing",
+		Server:     s.Server(),
+	})
+	if err == nil || !strings.Contains(err.Error(), `"missing"`) {
+		t.Fatalf("expected an error about the missing sink, got %v", err)
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	s := newFakeServer(t, fakeSink{name: "default", description: "Default"})
+
+	pa, err := New(Config{
+		AppName:    "test",
+		SampleRate: 44100,
+		Channels:   2,
+		Latency:    10 * time.Millisecond,
+		Server:     s.Server(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pa.Close()
+
+	if err := pa.SetMetadata("Ode to ProTracker", "Firefox"); err != nil {
+		t.Fatal(err)
+	}
+	// the artist of the previous song mustn't linger
+	if err := pa.SetMetadata("1942", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]string{
+		{"media.name": "Firefox - Ode to ProTracker", "media.title": "Ode to ProTracker", "media.artist": "Firefox"},
+		{"media.name": "1942", "media.title": "1942", "media.artist": ""},
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.proplists) != len(expected) {
+		t.Fatalf("got %d property updates, expected %d", len(s.proplists), len(expected))
+	}
+	for i, props := range expected {
+		for k, v := range props {
+			if got := s.proplists[i][k]; got != v {
+				t.Errorf("update %d: %s = %q, expected %q", i, k, got, v)
+			}
+		}
+	}
+}
+
+func TestFloatPlayback(t *testing.T) {
+	s := newFakeServer(t,
+		fakeSink{name: "first", description: "First"},
+		fakeSink{name: "second", description: "Second"},
+	)
+
+	pa, err := New(Config{
+		AppName:    "test",
+		SampleRate: 48000,
+		Channels:   2,
+		Format:     SampleFormatFloat32,
+		Sink:       "first",
+		Latency:    10 * time.Millisecond,
+		Server:     s.Server(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pa.Close()
+
+	s.mu.Lock()
+	stream := s.streams[0]
+	s.mu.Unlock()
+	if expected := (proto.SampleSpec{Format: proto.FormatFloat32LE, Channels: 2, Rate: 48000}); stream.spec != expected {
+		t.Errorf("stream created as %+v, expected %+v", stream.spec, expected)
+	}
+	if stream.sinkIndex != 0 {
+		t.Errorf("stream created on sink %d, expected 0", stream.sinkIndex)
+	}
+
+	audio := make([]byte, 0, 4*fakeRequestSize)
+	for i := range cap(audio) / 4 {
+		audio = binary.LittleEndian.AppendUint32(audio, math.Float32bits(float32(math.Sin(float64(i)/10))))
+	}
+	if err := pa.Output(context.Background(), audio); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stream is primed with silence, then plays the audio
+	prime := int(stream.target)
+	s.waitFor("the audio to be played", func() bool {
+		return len(stream.data) >= prime+len(audio)
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !bytes.Equal(stream.data[:prime], make([]byte, prime)) {
+		t.Error("the stream didn't start with silence")
+	}
+	if !bytes.Equal(stream.data[prime:prime+len(audio)], audio) {
+		t.Error("the stream didn't play the audio as it was given")
+	}
+}
+
+// sineAudio returns samples of a sine wave, in the 16-bit format streams are created with by default
+func sineAudio(samples int) []byte {
+	audio := make([]byte, 0, 2*samples)
+	for i := range samples {
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(int16(math.Sin(float64(i)/10)*math.MaxInt16)))
+	}
+	return audio
+}
+
+func TestReconnect(t *testing.T) {
+	s := newFakeServer(t, fakeSink{name: "default", description: "Default"})
+
+	pa, err := New(Config{
+		AppName:          "test",
+		SampleRate:       44100,
+		Channels:         2,
+		Latency:          10 * time.Millisecond,
+		Server:           s.Server(),
+		ReconnectTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pa.Close()
+
+	if err := pa.SetMetadata("1942", ""); err != nil {
+		t.Fatal(err)
+	}
+	// the server is down for the first couple of attempts to reconnect
+	s.mu.Lock()
+	s.refuse = 2
+	s.mu.Unlock()
+	s.drop()
+
+	// audio carries on being given, as it is while a song plays, until it's heard on a new stream
+	audio := sineAudio(2 * fakeRequestSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	outputErr := make(chan error, 1)
+	go func() {
+		for {
+			if err := pa.Output(ctx, audio); err != nil {
+				outputErr <- err
+				return
+			}
+		}
+	}()
+	s.waitFor("a new stream to play the audio", func() bool {
+		return len(s.streams) == 2 && bytes.Contains(s.streams[1].data, audio)
+	})
+	cancel()
+	if err := <-outputErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("playback stopped with %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refused != 2 {
+		t.Errorf("reconnected after %d refused attempts, expected 2", s.refused)
+	}
+	if n := len(s.proplists); n != 2 || s.proplists[1]["media.title"] != "1942" {
+		t.Errorf("the new stream wasn't given the metadata again: %v", s.proplists)
+	}
+}
+
+func TestCloseDuringOutput(t *testing.T) {
+	s := newFakeServer(t, fakeSink{name: "default", description: "Default"})
+
+	pa, err := New(Config{
+		AppName:    "test",
+		SampleRate: 44100,
+		Channels:   2,
+		Latency:    10 * time.Millisecond,
+		Server:     s.Server(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		audio := sineAudio(fakeRequestSize)
+		for {
+			if err := pa.Output(context.Background(), audio); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	s.waitFor("audio to be played", func() bool {
+		return len(s.streams) == 1 && len(s.streams[0].data) > 0
+	})
+	if err := pa.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("got %v from Output once closed, expected %v", err, io.ErrClosedPipe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Output didn't return once closed")
+	}
+}
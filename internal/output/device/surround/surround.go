@@ -0,0 +1,192 @@
+package surround
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/gotracker/playback/mixing"
+	"github.com/gotracker/playback/mixing/sampling"
+	"github.com/gotracker/playback/mixing/volume"
+	"github.com/gotracker/playback/output"
+
+	"github.com/gotracker/gotracker/internal/mixdown"
+)
+
+// Strategy is an enumeration of the ways the surround channels can be derived from the stereo mix
+type Strategy int
+
+const (
+	// StrategyMatrix derives the center from the sum of the stereo pair (what's panned to the middle)
+	// and the surrounds from the difference (what's panned wide)
+	StrategyMatrix = Strategy(iota)
+	// StrategyMirror derives the center from the sum of the stereo pair and copies the
+	// front left and right channels to the surrounds, slightly attenuated
+	StrategyMirror
+	// StrategyFront plays the stereo pair through the front left and right speakers only
+	StrategyFront
+)
+
+// StrategyNames are the names of the upmix strategies, as accepted by ParseStrategy
+var StrategyNames = []string{"matrix", "mirror", "front"}
+
+func (s Strategy) String() string {
+	if int(s) < 0 || int(s) >= len(StrategyNames) {
+		return "unknown"
+	}
+	return StrategyNames[s]
+}
+
+// ParseStrategy returns the upmix strategy with the provided name
+func ParseStrategy(name string) (Strategy, error) {
+	if i := slices.Index(StrategyNames, strings.ToLower(name)); i >= 0 {
+		return Strategy(i), nil
+	}
+	return StrategyMatrix, fmt.Errorf("unknown upmix strategy %q - must be one of {%s}", name, strings.Join(StrategyNames, ", "))
+}
+
+const (
+	// lfeCutoff is the frequency (in Hz) above which content is filtered out of the LFE channel
+	lfeCutoff = 120.0
+	// attenuation is -3dB, used to keep the total power of a derived feed the same as its source
+	attenuation = float32(math.Sqrt2 / 2)
+)
+
+// IsSurround returns true if the channel count is a surround layout that's built by upmixing stereo
+func IsSurround(channels int) bool {
+	return channels == 6 || channels == 8
+}
+
+// RenderChannels returns the number of channels to render for the requested output channel count.
+// Surround layouts are rendered in stereo, then upmixed.
+func RenderChannels(channels int) int {
+	if IsSurround(channels) {
+		return 2
+	}
+	return channels
+}
+
+// Mixer flattens premix data to stereo, then upmixes it to a surround layout.
+// The channels are in WAVE/FLAC order:
+//
+//	6 channels (5.1): front left, front right, center, LFE, rear left, rear right
+//	8 channels (7.1): front left, front right, center, LFE, rear left, rear right, side left, side right
+type Mixer struct {
+	channels int
+	strategy Strategy
+	stereo   mixing.Mixer
+	lfeAlpha float32
+	lfe      float32
+}
+
+// NewMixer creates a surround mixer for the specified layout
+func NewMixer(channels int, sampleRate int, strategy Strategy) (*Mixer, error) {
+	if !IsSurround(channels) {
+		return nil, fmt.Errorf("unsupported surround channel count: %d", channels)
+	}
+
+	m := Mixer{
+		channels: channels,
+		strategy: strategy,
+		stereo: mixing.Mixer{
+			Channels: 2,
+		},
+		lfeAlpha: float32(1 - math.Exp(-2*math.Pi*lfeCutoff/float64(sampleRate))),
+	}
+	return &m, nil
+}
+
+// Channels returns the number of channels the mixer produces
+func (m *Mixer) Channels() int {
+	return m.channels
+}
+
+// Upmix flattens the row to stereo and upmixes it, returning the samples separated by channel
+func (m *Mixer) Upmix(row *output.PremixData) [][]volume.Volume {
+	stereo := m.stereo.Flatten(row.SamplesLen, row.Data, row.MixerVolume, sampling.Format32BitLEFloat)
+
+	data := make([][]volume.Volume, m.channels)
+	for c := range data {
+		data[c] = make([]volume.Volume, row.SamplesLen)
+	}
+
+	for i := 0; i < row.SamplesLen && (i*8+8) <= len(stereo); i++ {
+		l := math.Float32frombits(binary.LittleEndian.Uint32(stereo[i*8:]))
+		r := math.Float32frombits(binary.LittleEndian.Uint32(stereo[i*8+4:]))
+
+		mid := (l + r) / 2
+		m.lfe += m.lfeAlpha * (mid - m.lfe)
+
+		var center, lfe, rearL, rearR, sideL, sideR float32
+		switch m.strategy {
+		case StrategyMatrix:
+			ambience := (l - r) / 2
+			center = mid * attenuation
+			lfe = m.lfe
+			rearL, rearR = ambience, -ambience
+			if m.channels == 8 {
+				// the sides take the wide content, the rears get a softer copy of it
+				sideL, sideR = ambience, -ambience
+				rearL, rearR = ambience*attenuation, -ambience*attenuation
+			}
+		case StrategyMirror:
+			center = mid * attenuation
+			lfe = m.lfe
+			rearL, rearR = l*attenuation, r*attenuation
+			sideL, sideR = l*attenuation, r*attenuation
+		case StrategyFront:
+		}
+
+		data[0][i] = volume.Volume(l)
+		data[1][i] = volume.Volume(r)
+		data[2][i] = volume.Volume(center)
+		data[3][i] = volume.Volume(lfe)
+		data[4][i] = volume.Volume(rearL)
+		data[5][i] = volume.Volume(rearR)
+		if m.channels == 8 {
+			data[6][i] = volume.Volume(sideL)
+			data[7][i] = volume.Volume(sideR)
+		}
+	}
+	return data
+}
+
+// Channels returns the row mixed down to the output channels, separated by channel - upmixed by
+// the mixer, if there is one, or else mixed straight down to the channels
+func Channels(m *Mixer, row *output.PremixData, channels int) [][]volume.Volume {
+	if m != nil {
+		return m.Upmix(row)
+	}
+	return mixdown.Channels(row, channels)
+}
+
+// Flatten upmixes the row into an interleaved byte stream of the specified sample format
+func (m *Mixer) Flatten(row *output.PremixData, sampleFormat sampling.Format) []byte {
+	data := m.Upmix(row)
+	formatter := sampling.GetFormatter(sampleFormat)
+
+	writer := &bytes.Buffer{}
+	writer.Grow(row.SamplesLen * 4 * m.channels)
+	for i := 0; i < row.SamplesLen; i++ {
+		for c := range data {
+			_ = formatter.Write(writer, data[c][i]) // lint
+		}
+	}
+	return writer.Bytes()
+}
+
+// FlattenToInts upmixes the row into separate channels of integer samples of the specified size
+func (m *Mixer) FlattenToInts(row *output.PremixData, bitsPerSample int) [][]int32 {
+	data := m.Upmix(row)
+	ints := make([][]int32, len(data))
+	for c, samples := range data {
+		ints[c] = make([]int32, len(samples))
+		for i, v := range samples {
+			ints[c][i] = v.ToIntSample(bitsPerSample)
+		}
+	}
+	return ints
+}
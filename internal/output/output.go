@@ -2,10 +2,17 @@ package output
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 
 	playerFeature "github.com/gotracker/gotracker/internal/feature"
+	"github.com/gotracker/gotracker/internal/logging"
 	"github.com/gotracker/gotracker/internal/output/device"
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	deviceFile "github.com/gotracker/gotracker/internal/output/device/file"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
 	"github.com/gotracker/playback/player/feature"
 )
 
@@ -14,6 +21,7 @@ type devicePriority int
 // the further down the list, the higher the priority
 const (
 	devicePriorityNone = devicePriority(iota)
+	devicePriorityHTTP
 	devicePriorityFile
 	devicePriorityPulseAudio
 	devicePriorityWinmm
@@ -27,10 +35,33 @@ var (
 	devicePriorityMap = make(map[string]devicePriority)
 )
 
+// getAutomaticDeviceNames returns the names of the devices to try when no output device is
+// specified, in descending priority order. Only sound-card devices are tried, so audio is never
+// quietly written to a file or a stream instead.
+func getAutomaticDeviceNames() []string {
+	var names []string
+	for name, details := range device.Map {
+		if details.Kind != deviceCommon.KindSoundCard {
+			continue
+		}
+		if _, ok := devicePriorityMap[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return devicePriorityMap[names[i]] > devicePriorityMap[names[j]]
+	})
+	return names
+}
+
 func calculateOptimalDefaultOutputDeviceName() string {
 	preferredPriority := devicePriority(0)
 	preferredName := "none"
-	for name := range device.Map {
+	for name, details := range device.Map {
+		if details.Kind != deviceCommon.KindSoundCard {
+			continue
+		}
 		if priority, ok := devicePriorityMap[name]; ok && priority > preferredPriority {
 			preferredName = name
 			preferredPriority = priority
@@ -40,29 +71,369 @@ func calculateOptimalDefaultOutputDeviceName() string {
 	return preferredName
 }
 
-// CreateOutputDevice creates an output device based on the provided settings
-func CreateOutputDevice(settings deviceCommon.Settings) (device.Device, []feature.Feature, error) {
-	d, err := device.CreateOutputDevice(settings)
+// deviceSpec is a parsed output device specifier
+type deviceSpec struct {
+	Name        string
+	Filepath    string
+	HasFilepath bool
+	Options     url.Values
+}
+
+// parseDeviceSpec parses an output device specifier of the form `name[:filepath][?option=value&...]`
+func parseDeviceSpec(spec string) (deviceSpec, error) {
+	var ds deviceSpec
+	spec, query, hasQuery := strings.Cut(spec, "?")
+	ds.Name, ds.Filepath, ds.HasFilepath = strings.Cut(spec, ":")
+	if hasQuery {
+		var err error
+		if ds.Options, err = url.ParseQuery(query); err != nil {
+			return ds, fmt.Errorf("could not parse options for output device %q: %w", ds.Name, err)
+		}
+	}
+	return ds, nil
+}
+
+// applyDeviceOptions validates the device options and applies the common overrides to the settings
+func applyDeviceOptions(cfg *deviceCommon.Settings, values url.Values) error {
+	opts, err := deviceCommon.ParseOptions(device.GetOptionSpecs(cfg.Name), values)
 	if err != nil {
-		return nil, nil, err
+		return fmt.Errorf("output device %q: %w", cfg.Name, err)
 	}
+	cfg.Options = opts
 
-	if d == nil {
-		return nil, nil, errors.New("could not create output device")
+	if opts.IsSet("channels") {
+		cfg.Channels = opts.GetInt("channels")
+	}
+	if opts.IsSet("bits") {
+		cfg.BitsPerSample = opts.GetInt("bits")
+	}
+	if opts.IsSet("upmix") {
+		cfg.Upmix = opts.GetString("upmix")
+	}
+	if opts.IsSet("dither") {
+		cfg.Dither = opts.GetString("dither")
+	}
+	return nil
+}
+
+// negotiateDeviceFormat adjusts the format in the device settings to the closest one the device supports
+func negotiateDeviceFormat(cfg *deviceCommon.Settings, logger logging.Log) error {
+	caps, err := device.GetCapabilities(*cfg)
+	if err != nil {
+		return err
+	}
+
+	adjustments, err := caps.Negotiate(cfg)
+	if err != nil {
+		return fmt.Errorf("output device %q: %w", cfg.Name, err)
+	}
+
+	if logger != nil {
+		for _, adj := range adjustments {
+			logger.Printf("Output device %q: adjusted %s\n", cfg.Name, adj)
+		}
+	}
+	return nil
+}
+
+// isAutomatic returns true if no output device was specified, meaning that one should be chosen automatically
+func isAutomatic(settings deviceCommon.Settings) bool {
+	return len(settings.Outputs) == 0 && settings.Name == ""
+}
+
+// getAutomaticDeviceConfigs returns the settings for each device to try, in descending priority order
+func getAutomaticDeviceConfigs(settings deviceCommon.Settings) ([]deviceCommon.Settings, error) {
+	names := getAutomaticDeviceNames()
+	if len(names) == 0 {
+		return nil, errors.New("no sound-card output device is available in this build (use --output to select a device explicitly, e.g.: -O file:output.wav)")
+	}
+
+	var devsConfig []deviceCommon.Settings
+	for _, name := range names {
+		cfg := settings
+		cfg.Name = name
+		if err := applyDeviceOptions(&cfg, nil); err != nil {
+			return nil, err
+		}
+		devsConfig = append(devsConfig, cfg)
+	}
+	return devsConfig, nil
+}
+
+// getDeviceConfigs resolves the output device specifiers into the settings for each individual device
+func getDeviceConfigs(settings deviceCommon.Settings) ([]deviceCommon.Settings, error) {
+	if isAutomatic(settings) {
+		// the automatic device selection will only ever open one of the candidates, so
+		// the first is representative of what would be created
+		devsConfig, err := getAutomaticDeviceConfigs(settings)
+		if err != nil {
+			return nil, err
+		}
+		return devsConfig[:1], nil
+	}
+
+	if len(settings.Outputs) == 0 {
+		if err := applyDeviceOptions(&settings, nil); err != nil {
+			return nil, err
+		}
+		return []deviceCommon.Settings{settings}, nil
+	}
+
+	var (
+		devsConfig []deviceCommon.Settings
+		filepaths  = make(map[string]struct{})
+	)
+
+	for _, spec := range settings.Outputs {
+		ds, err := parseDeviceSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := settings
+		cfg.Outputs = nil
+		cfg.Name = ds.Name
+		if ds.HasFilepath {
+			cfg.Filepath = ds.Filepath
+		}
+
+		details, ok := device.Map[ds.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", device.ErrDeviceNotSupported, ds.Name)
+		}
+
+		if err := applyDeviceOptions(&cfg, ds.Options); err != nil {
+			return nil, err
+		}
+
+		if details.Kind == deviceCommon.KindFile {
+			if _, found := filepaths[cfg.Filepath]; found {
+				return nil, fmt.Errorf("output file %q is used by more than one output device", cfg.Filepath)
+			}
+			filepaths[cfg.Filepath] = struct{}{}
+		}
+
+		devsConfig = append(devsConfig, cfg)
+	}
+
+	return devsConfig, nil
+}
+
+// negotiateDeviceConfigs adjusts the format of each of the device settings to one that the device supports
+func negotiateDeviceConfigs(devsConfig []deviceCommon.Settings, logger logging.Log) error {
+	for i := range devsConfig {
+		if err := negotiateDeviceFormat(&devsConfig[i], logger); err != nil {
+			return err
+		}
+	}
+
+	// every device is fed by the same renderer, so they have to agree on the sample rate
+	for _, cfg := range devsConfig[1:] {
+		if cfg.SamplesPerSecond != devsConfig[0].SamplesPerSecond {
+			return fmt.Errorf("output devices %q and %q do not support a common sample rate (%dHz vs %dHz)", devsConfig[0].Name, cfg.Name, devsConfig[0].SamplesPerSecond, cfg.SamplesPerSecond)
+		}
+	}
+	return nil
+}
+
+// getPrimaryDevice returns the index of the device that drives the row output:
+// the first sound card, then the first network stream, or the first device if there's neither.
+// Real-time devices pace playback, so they're preferred over file writers.
+func getPrimaryDevice(devsConfig []deviceCommon.Settings) int {
+	for _, kind := range []deviceCommon.Kind{deviceCommon.KindSoundCard, deviceCommon.KindNetwork} {
+		for i, cfg := range devsConfig {
+			if details, ok := device.Map[cfg.Name]; ok && details.Kind == kind {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func createTeeDevice(devsConfig []deviceCommon.Settings) (device.Device, error) {
+	primary := getPrimaryDevice(devsConfig)
+
+	devs := make([]device.Device, len(devsConfig))
+	defer func() {
+		// only clean up if we didn't make it to the tee
+		for _, d := range devs {
+			if d != nil {
+				d.Close()
+			}
+		}
+	}()
+
+	for i, cfg := range devsConfig {
+		if i != primary {
+			cfg.OnRowOutput = nil
+		}
+		d, err := device.CreateOutputDevice(cfg)
+		if err != nil {
+			return nil, err
+		}
+		devs[i] = d
+	}
+
+	tee, err := device.NewTeeDevice(primary, devs...)
+	if err != nil {
+		return nil, err
+	}
+	devs = nil
+	return tee, nil
+}
+
+// GetOutputKind returns the kind of device that would be created from the provided settings
+func GetOutputKind(settings deviceCommon.Settings) (deviceCommon.Kind, error) {
+	devsConfig, err := getDeviceConfigs(settings)
+	if err != nil {
+		return deviceCommon.KindNone, err
+	}
+
+	details, ok := device.Map[devsConfig[getPrimaryDevice(devsConfig)].Name]
+	if !ok {
+		return deviceCommon.KindNone, nil
+	}
+	return details.Kind, nil
+}
+
+// GetOutputFilepaths returns the filepaths of all the file devices that would be created from the provided settings
+func GetOutputFilepaths(settings deviceCommon.Settings) ([]string, error) {
+	devsConfig, err := getDeviceConfigs(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var filepaths []string
+	for _, cfg := range devsConfig {
+		if details, ok := device.Map[cfg.Name]; ok && details.Kind == deviceCommon.KindFile {
+			filepaths = append(filepaths, cfg.Filepath)
+		}
+	}
+	return filepaths, nil
+}
+
+// NegotiateFormat adjusts the format in the settings to the closest one that is supported by the
+// output device(s), logging each adjustment made. If the settings ask for a strict format, an
+// error describing the unsupported part of the format is returned instead.
+func NegotiateFormat(settings *deviceCommon.Settings, logger logging.Log) error {
+	devsConfig, err := getDeviceConfigs(*settings)
+	if err != nil {
+		return err
+	}
+
+	if err := negotiateDeviceConfigs(devsConfig, logger); err != nil {
+		return err
+	}
+
+	settings.SamplesPerSecond = devsConfig[0].SamplesPerSecond
+	if len(devsConfig) == 1 {
+		settings.Channels = devsConfig[0].Channels
+		settings.BitsPerSample = devsConfig[0].BitsPerSample
+		return nil
 	}
 
-	var featureDisable []feature.Feature
+	// the renderer has to produce enough channels for the widest device - the rest mix it down
+	channels := 0
+	for _, cfg := range devsConfig {
+		channels = max(channels, cfg.Channels)
+	}
+	settings.Channels = channels
+	return nil
+}
+
+// GetRenderChannels returns the number of channels to render for the requested output channel count
+func GetRenderChannels(channels int) int {
+	return surround.RenderChannels(channels)
+}
 
-	kind := device.GetKind(d)
+// GetFeaturesForKind returns the playback features required by a device of the specified kind
+func GetFeaturesForKind(kind deviceCommon.Kind) []feature.Feature {
 	switch kind {
 	case deviceCommon.KindFile:
-		featureDisable = []feature.Feature{
+		return []feature.Feature{
 			feature.SongLoop{Count: 0},
 			playerFeature.PlayerSleepInterval{Enabled: false},
 		}
+	case deviceCommon.KindNetwork:
+		// the stream paces itself
+		return []feature.Feature{
+			playerFeature.PlayerSleepInterval{Enabled: false},
+		}
+	default:
+		return nil
+	}
+}
+
+// createAutomaticDevice tries each of the automatic device candidates in turn, returning the first one that opens
+func createAutomaticDevice(settings deviceCommon.Settings, logger logging.Log) (device.Device, error) {
+	devsConfig, err := getAutomaticDeviceConfigs(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, cfg := range devsConfig {
+		d, err := func() (device.Device, error) {
+			if err := negotiateDeviceFormat(&cfg, nil); err != nil {
+				return nil, err
+			}
+			return device.CreateOutputDevice(cfg)
+		}()
+		if err == nil {
+			return d, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", cfg.Name, err))
+		if logger != nil {
+			logger.Printf("Output device %q could not be opened, skipping: %v\n", cfg.Name, err)
+		}
+	}
+
+	return nil, fmt.Errorf("no sound-card output device could be opened (use --output to select a device explicitly, e.g.: -O file:output.wav):\n%w", errors.Join(errs...))
+}
+
+// createSpecifiedDevice creates the device(s) from the output device specifiers
+func createSpecifiedDevice(settings deviceCommon.Settings) (device.Device, error) {
+	devsConfig, err := getDeviceConfigs(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// any adjustments were already reported by NegotiateFormat
+	if err := negotiateDeviceConfigs(devsConfig, nil); err != nil {
+		return nil, err
+	}
+
+	if len(devsConfig) == 1 {
+		return device.CreateOutputDevice(devsConfig[0])
+	}
+	return createTeeDevice(devsConfig)
+}
+
+// CreateOutputDevice creates an output device based on the provided settings.
+// If no output device is specified, the available sound-card devices are tried in
+// descending priority order and the reason each unusable one was skipped is logged.
+func CreateOutputDevice(settings deviceCommon.Settings, logger logging.Log) (device.Device, []feature.Feature, error) {
+	settings.Logger = logger
+
+	var (
+		d   device.Device
+		err error
+	)
+	if isAutomatic(settings) {
+		d, err = createAutomaticDevice(settings, logger)
+	} else {
+		d, err = createSpecifiedDevice(settings)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if d == nil {
+		return nil, nil, errors.New("could not create output device")
 	}
 
-	return d, featureDisable, nil
+	return d, GetFeaturesForKind(device.GetKind(d)), nil
 }
 
 // Setup finalizes the output device preference system
@@ -72,8 +443,20 @@ func Setup() {
 
 // DeviceInfo returns information about a device
 type DeviceInfo struct {
-	Priority int
-	Kind     deviceCommon.Kind
+	Priority     int
+	Kind         deviceCommon.Kind
+	Options      []deviceCommon.OptionSpec
+	Capabilities deviceCommon.Capabilities
+}
+
+// GetFileFormats returns the names of the formats that the file device can write
+func GetFileFormats() []string {
+	return deviceFile.GetFileFormats()
+}
+
+// ListDeviceSinks returns the sinks that the named device can play to
+func ListDeviceSinks(name string) ([]deviceCommon.Sink, error) {
+	return device.ListSinks(name)
 }
 
 func GetOutputDevices() map[string]DeviceInfo {
@@ -81,8 +464,10 @@ func GetOutputDevices() map[string]DeviceInfo {
 	for k, v := range devicePriorityMap {
 		if d, ok := device.Map[k]; ok {
 			m[k] = DeviceInfo{
-				Priority: int(v),
-				Kind:     d.Kind,
+				Priority:     int(v),
+				Kind:         d.Kind,
+				Options:      device.GetOptionSpecs(k),
+				Capabilities: d.Capabilities,
 			}
 		}
 	}
@@ -91,6 +476,7 @@ func GetOutputDevices() map[string]DeviceInfo {
 
 func init() {
 	_ = devicePriorityNone // lint
+	devicePriorityMap["http"] = devicePriorityHTTP
 	devicePriorityMap["file"] = devicePriorityFile
 	devicePriorityMap["pulseaudio"] = devicePriorityPulseAudio
 	devicePriorityMap["winmm"] = devicePriorityWinmm
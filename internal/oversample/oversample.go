@@ -0,0 +1,140 @@
+// Package oversample brings audio that was rendered at a multiple of the output sample rate back
+// down to it. The player's sampler interpolates linearly between the samples of an instrument, so
+// an instrument played high above the pitch it was sampled at has more in it than the output rate
+// can hold, and the excess folds back down as aliasing. Rendering at a higher rate and filtering
+// the excess out before it's brought down leaves much less of it.
+package oversample
+
+import (
+	"fmt"
+	"math"
+
+	playbackOutput "github.com/gotracker/playback/output"
+
+	"github.com/gotracker/gotracker/internal/mixdown"
+)
+
+// MaxFactor is the most the rendering can be oversampled by
+const MaxFactor = 8
+
+const (
+	// tapsPerFactor is the length of the filter for each step of the factor, which sets how
+	// sharply it cuts off
+	tapsPerFactor = 48
+	// cutoff is where the filter cuts off, relative to the output sample rate - high enough to keep
+	// the audible range of a 44.1kHz render, low enough that nothing above the Nyquist frequency of
+	// the output gets through
+	cutoff = 0.45
+	// kaiserBeta shapes the window of the filter, for about 80dB of rejection
+	kaiserBeta = 8
+)
+
+// Validate returns an error if the rendering can't be oversampled by the factor. A factor of 0 is
+// the same as 1, which isn't oversampled.
+func Validate(factor int) error {
+	if factor < 0 || factor > MaxFactor {
+		return fmt.Errorf("oversampling factor %d out of range (1 to %d)", factor, MaxFactor)
+	}
+	return nil
+}
+
+// Decimator brings a stream of premixes rendered at a multiple of the output sample rate down to
+// it. It's meant for a single stream of audio, as the filter carries over from one premix to the
+// next. A nil decimator leaves the audio alone.
+type Decimator struct {
+	factor   int
+	channels int
+	filter   []float32
+	hist     []float32 // the interleaved frames the filter still needs, followed by the latest premix
+	phase    int       // frames of the latest premix to skip before the next one that's kept
+	buf      []float32
+	out      []float32
+}
+
+// New creates a decimator for audio of the channels, rendered at the factor times the output
+// sample rate, or returns nil if it isn't oversampled
+func New(factor, channels int) (*Decimator, error) {
+	if err := Validate(factor); err != nil {
+		return nil, err
+	}
+	if factor <= 1 {
+		return nil, nil
+	}
+
+	// a windowed sinc, scaled so that it passes the lowest frequencies at unity gain
+	taps := tapsPerFactor*factor + 1
+	fc := cutoff / float64(factor)
+	h := make([]float64, taps)
+	var sum float64
+	for i := range h {
+		x := float64(i - taps/2)
+		sinc := 2 * fc
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		r := 2*float64(i)/float64(taps-1) - 1
+		h[i] = sinc * besselI0(kaiserBeta*math.Sqrt(1-r*r)) / besselI0(kaiserBeta)
+		sum += h[i]
+	}
+	filter := make([]float32, taps)
+	for i := range h {
+		filter[i] = float32(h[i] / sum)
+	}
+
+	return &Decimator{
+		factor:   factor,
+		channels: channels,
+		filter:   filter,
+		hist:     make([]float32, (taps-1)*channels),
+	}, nil
+}
+
+// Factor returns how many times the output sample rate the audio is rendered at
+func (d *Decimator) Factor() int {
+	if d == nil {
+		return 1
+	}
+	return d.factor
+}
+
+// Process mixes the premix down, as the output device would, then filters it and keeps every
+// factor'th frame of it. The premix is left holding the decimated mix, which is a little behind
+// the one it was given, by half the length of the filter.
+func (d *Decimator) Process(premix *playbackOutput.PremixData) {
+	if d == nil || premix.SamplesLen <= 0 {
+		return
+	}
+
+	held := len(d.hist) / d.channels
+	d.buf = mixdown.Interleaved(d.buf, premix, d.channels)
+	d.hist = append(d.hist, d.buf...)
+
+	taps := len(d.filter)
+	d.out = d.out[:0]
+	i := d.phase
+	for ; i < premix.SamplesLen; i += d.factor {
+		end := held + i + 1 // just past the frame being kept
+		for c := 0; c < d.channels; c++ {
+			var y float32
+			for k, h := range d.filter {
+				y += h * d.hist[(end-taps+k)*d.channels+c]
+			}
+			d.out = append(d.out, y)
+		}
+	}
+	d.phase = i - premix.SamplesLen
+
+	d.hist = append(d.hist[:0], d.hist[len(d.hist)-(taps-1)*d.channels:]...)
+	mixdown.Replace(premix, d.out, d.channels)
+}
+
+// besselI0 is the modified Bessel function of the first kind, of order 0, which the Kaiser window
+// is made of
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
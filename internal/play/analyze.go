@@ -0,0 +1,228 @@
+package play
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/loudness"
+	"github.com/gotracker/gotracker/internal/mixdown"
+	"github.com/gotracker/gotracker/internal/playlist"
+	playbackOutput "github.com/gotracker/playback/output"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+	"github.com/gotracker/playback/player/machine/settings"
+	"github.com/gotracker/playback/player/render"
+)
+
+// silenceThreshold is how far the audio can stray from where it started, relative to full scale,
+// and still be silent. Audio that holds still is silent, even if it's held away from zero.
+const silenceThreshold = 0.001 // -60dB
+
+// AnalyzeSettings are the settings songs are rendered with to analyze them
+type AnalyzeSettings struct {
+	SampleRate       int
+	Channels         int
+	StereoSeparation int
+}
+
+// Analysis is the result of analyzing a render of a song. Levels are relative to full scale (1).
+type Analysis struct {
+	Entry           *playlist.Song
+	Title           string
+	Gain            float64 // the gain the song was rendered at, in decibels
+	Duration        time.Duration
+	Peak            float64   // highest sample
+	TruePeak        float64   // highest level between the samples, once converted back to analog
+	RMS             float64   // RMS level of all the channels
+	Loudness        float64   // integrated loudness, in LUFS (-Inf = silent)
+	LoudnessRange   float64   // in LU
+	DCOffset        []float64 // average level of each channel
+	Clipped         int64     // samples at or past full scale
+	Clips           []Clip    // where the clipped samples are, in the order they're played
+	LeadingSilence  time.Duration
+	TrailingSilence time.Duration
+}
+
+// Clip is a row of the song that clips
+type Clip struct {
+	Order   int
+	Row     int
+	Samples int64 // samples at or past full scale, across all the channels
+}
+
+// Analyze renders each song of the playlist through once, as fast as it can - with its channel
+// mix, speed, effects and gain, ignoring its loop settings - and analyzes the audio
+func Analyze(pl *playlist.Playlist, features []playbackFeature.Feature, renderSettings *Settings, cfg AnalyzeSettings, logger logging.Log) ([]Analysis, error) {
+	features = append(features, playbackFeature.IgnoreUnknownEffect{Enabled: true})
+
+	norm, err := newLoudnessNormalizer(renderSettings.Normalize, features, renderSettings, cfg.StereoSeparation, logger)
+	if err != nil {
+		return nil, err
+	}
+	entries := getPlaylistEntries(pl)
+	gains := norm.gains(entries)
+
+	var results []Analysis
+	for _, entry := range entries {
+		a, err := AnalyzeSong(entry, features, renderSettings, cfg, getEntryGain(entry, gains))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Filepath, err)
+		}
+		results = append(results, *a)
+	}
+	return results, nil
+}
+
+// AnalyzeSong renders a single play through the song at the gain, in decibels, and analyzes the
+// audio
+func AnalyzeSong(entry *playlist.Song, features []playbackFeature.Feature, renderSettings *Settings, cfg AnalyzeSettings, gain float64) (*Analysis, error) {
+	var us settings.UserSettings
+	m, songData, err := newEntryMachine(entry, features, false, renderSettings, &us)
+	if err != nil {
+		return nil, err
+	}
+
+	a := analyzer{
+		channels: cfg.Channels,
+		meter:    loudness.New(cfg.SampleRate, cfg.Channels),
+		sum:      make([]float64, cfg.Channels),
+		ref:      make([]float32, cfg.Channels),
+	}
+	var (
+		chain   renderChain
+		buf     []float32
+		samples int64
+	)
+	out, err := chain.newSampler(renderSettings, cfg.SampleRate, cfg.Channels, cfg.StereoSeparation, func(premix *playbackOutput.PremixData) {
+		buf = mixdown.Interleaved(buf, premix, cfg.Channels)
+		row, _ := premix.Userdata.(*render.RowRender)
+		a.write(buf, row)
+		samples += int64(premix.SamplesLen)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.startEntry(entry, gain, m, songData, renderSettings, out); err != nil {
+		return nil, err
+	}
+
+	if err := renderOffline(m, out, &samples, cfg.SampleRate); err != nil {
+		return nil, err
+	}
+
+	result := a.result(cfg.SampleRate)
+	result.Entry = entry
+	result.Title = getEntryMetadata(entry, m).Title
+	result.Gain = gain
+	return &result, nil
+}
+
+// analyzer gathers the statistics of the audio as it's rendered
+type analyzer struct {
+	channels int
+	meter    *loudness.Meter
+	frames   int64
+	peak     float64
+	sumSq    float64
+	sum      []float64 // of each channel, for the DC offset
+	clipped  int64
+	clips    []Clip
+
+	ref       []float32 // the frame the current run of silence started with
+	runStart  int64     // the frame the current run of silence started at
+	leadingTo int64     // the frame the leading silence ended at (-1 = it hasn't yet)
+}
+
+func (a *analyzer) write(buf []float32, row *render.RowRender) {
+	a.meter.Write(buf)
+
+	if a.frames == 0 {
+		a.leadingTo = -1
+		copy(a.ref, buf)
+	}
+
+	for f := 0; f+a.channels <= len(buf); f += a.channels {
+		frame := buf[f : f+a.channels]
+		silent := true
+		for c, x := range frame {
+			v := math.Abs(float64(x))
+			a.peak = max(a.peak, v)
+			a.sumSq += v * v
+			a.sum[c] += float64(x)
+			if v >= 1 {
+				a.clip(row)
+			}
+			if math.Abs(float64(x-a.ref[c])) > silenceThreshold {
+				silent = false
+			}
+		}
+
+		if !silent {
+			if a.leadingTo < 0 {
+				a.leadingTo = a.frames
+			}
+			copy(a.ref, frame)
+			a.runStart = a.frames
+		}
+		a.frames++
+	}
+}
+
+// clip counts a clipped sample of the row, which is usually the row the last one was clipped in
+func (a *analyzer) clip(row *render.RowRender) {
+	a.clipped++
+
+	var order, rowNum int
+	if row != nil {
+		order, rowNum = row.Order, row.Row
+	}
+	if n := len(a.clips); n > 0 && a.clips[n-1].Order == order && a.clips[n-1].Row == rowNum {
+		a.clips[n-1].Samples++
+		return
+	}
+	a.clips = append(a.clips, Clip{
+		Order:   order,
+		Row:     rowNum,
+		Samples: 1,
+	})
+}
+
+func (a *analyzer) result(sampleRate int) Analysis {
+	toDuration := func(frames int64) time.Duration {
+		return time.Duration(frames) * time.Second / time.Duration(sampleRate)
+	}
+
+	lr := a.meter.Result()
+	r := Analysis{
+		Duration:      toDuration(a.frames),
+		Peak:          a.peak,
+		TruePeak:      lr.Peak,
+		Loudness:      math.Inf(-1),
+		LoudnessRange: a.meter.Range(),
+		DCOffset:      make([]float64, a.channels),
+		Clipped:       a.clipped,
+		Clips:         a.clips,
+	}
+	if !lr.Silent() {
+		r.Loudness = lr.Loudness
+	}
+	if a.frames == 0 {
+		return r
+	}
+
+	r.RMS = math.Sqrt(a.sumSq / float64(a.frames*int64(a.channels)))
+	for c := range r.DCOffset {
+		r.DCOffset[c] = a.sum[c] / float64(a.frames)
+	}
+
+	if a.leadingTo < 0 {
+		// silent throughout
+		r.LeadingSilence = r.Duration
+		r.TrailingSilence = r.Duration
+	} else {
+		r.LeadingSilence = toDuration(a.leadingTo)
+		r.TrailingSilence = toDuration(a.frames - a.runStart - 1)
+	}
+	return r
+}
@@ -0,0 +1,102 @@
+package play
+
+import (
+	"errors"
+
+	"github.com/gotracker/gotracker/internal/dsp"
+	"github.com/gotracker/gotracker/internal/oversample"
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/playback/mixing/volume"
+	playbackOutput "github.com/gotracker/playback/output"
+	"github.com/gotracker/playback/player/machine"
+	"github.com/gotracker/playback/player/sampler"
+	"github.com/gotracker/playback/song"
+)
+
+// renderChain is what the audio of a song goes through on its way from the sampler: the song is
+// played at its speed, its gain, panning and channel mix are applied, then the mix is decimated
+// to the output rate and processed by its effects. Songs are played, rendered, analyzed and
+// measured through it, so they all sound the same.
+type renderChain struct {
+	mixer     channelMixer
+	speed     varispeed
+	panner    *amigaPanner  // of the song being rendered, nil if it's panned as it says
+	effects   *dsp.Chain    // of the song being rendered
+	gain      volume.Volume // of the song being rendered
+	decimator *oversample.Decimator
+
+	sampleRate       int // of the output
+	channels         int // rendered
+	stereoSeparation int // unless the profile of the song has its own
+
+	// level, if set, is the volume everything is played at, on top of the gain of the song
+	level func() volume.Volume
+	// rendered, if set, is given each premix while it still has the channels of the song
+	rendered func(premix *playbackOutput.PremixData)
+}
+
+// newSampler sets the chain up to render in the channels for an output at the sample rate,
+// returning the sampler that renders through it to write
+func (c *renderChain) newSampler(renderSettings *Settings, sampleRate, channels, stereoSeparation int, write func(premix *playbackOutput.PremixData)) (*sampler.Sampler, error) {
+	decimator, err := oversample.New(renderSettings.Oversample, channels)
+	if err != nil {
+		return nil, err
+	}
+	c.decimator = decimator
+	c.sampleRate = sampleRate
+	c.channels = channels
+	c.stereoSeparation = stereoSeparation
+
+	var out *sampler.Sampler
+	out = sampler.NewSampler(sampleRate*decimator.Factor(), channels, float32(stereoSeparation)/100.0, func(premix *playbackOutput.PremixData) {
+		// changes of speed take effect from the next tick
+		c.speed.apply(out)
+		premix.MixerVolume *= c.gain
+		if c.level != nil {
+			premix.MixerVolume *= c.level()
+		}
+		c.panner.apply(premix)
+		c.mixer.apply(premix)
+		if c.rendered != nil {
+			// before decimation and the effects mix the channels down
+			c.rendered(premix)
+		}
+		c.decimator.Process(premix)
+		c.effects.Process(premix)
+		write(premix)
+	})
+	if out == nil {
+		return nil, errors.New("could not setup playback sampler")
+	}
+	c.speed.rate = out.SampleRate
+	return out, nil
+}
+
+// startEntry sets the chain and its sampler up to render the song of the playlist entry at the
+// gain, in decibels, as the entry's profile, channel mix and speed say to
+func (c *renderChain) startEntry(entry *playlist.Song, gain float64, m machine.MachineInfo, songData song.Data, renderSettings *Settings, out *sampler.Sampler) error {
+	profile, err := getEntryProfile(entry, renderSettings, c.stereoSeparation)
+	if err != nil {
+		return err
+	}
+	speed, err := getEntrySpeed(entry, renderSettings)
+	if err != nil {
+		return err
+	}
+	mix, err := getEntryChannelMix(entry)
+	if err != nil {
+		return err
+	}
+	effects, err := getEntryEffects(entry, profile, c.sampleRate, c.channels)
+	if err != nil {
+		return err
+	}
+
+	c.mixer.reset(mix, getNumChannels(m))
+	c.panner = profile.panner(c.channels)
+	c.effects = effects
+	out.StereoSeparation = float32(profile.stereoSeparation) / 100.0
+	c.speed.start(songData, speed, out)
+	c.gain = volume.Volume(dbToGain(gain))
+	return nil
+}
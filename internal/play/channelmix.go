@@ -0,0 +1,306 @@
+package play
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/playback/mixing/volume"
+	playbackOutput "github.com/gotracker/playback/output"
+)
+
+// ChannelMix is how the channels of a song are mixed. Channels are numbered from 1, as they are in
+// the trackers.
+type ChannelMix struct {
+	Mute []int           // channels that are silenced
+	Solo []int           // if there are any, the only channels that are heard
+	Gain map[int]float64 // decibels added to (or taken from) the channels
+}
+
+// ParseChannelMix parses the mix of channels from a list of channels to mute (e.g.: "1,4-6"), a
+// list of channels to solo and a list of channel gains (e.g.: "2=-6dB")
+func ParseChannelMix(mute, solo string, gains []string) (ChannelMix, error) {
+	var (
+		mix ChannelMix
+		err error
+	)
+	if mix.Mute, err = ParseChannelList(mute); err != nil {
+		return mix, fmt.Errorf("invalid mute: %w", err)
+	}
+	if mix.Solo, err = ParseChannelList(solo); err != nil {
+		return mix, fmt.Errorf("invalid solo: %w", err)
+	}
+	if mix.Gain, err = ParseChannelGains(gains); err != nil {
+		return mix, fmt.Errorf("invalid channel gain: %w", err)
+	}
+	return mix, nil
+}
+
+// ParseChannelList parses a comma-separated list of channels and ranges of channels, such as
+// "1,4-6". An empty list has no channels.
+func ParseChannelList(s string) ([]int, error) {
+	var channels []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := parseChannel(first)
+		if err != nil {
+			return nil, err
+		}
+		hi := lo
+		if isRange {
+			if hi, err = parseChannel(last); err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("channel range %q is backwards", part)
+			}
+		}
+
+		for ch := lo; ch <= hi; ch++ {
+			if !slices.Contains(channels, ch) {
+				channels = append(channels, ch)
+			}
+		}
+	}
+	slices.Sort(channels)
+	return channels, nil
+}
+
+func parseChannel(s string) (int, error) {
+	ch, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid channel %q", s)
+	}
+	if ch < 1 {
+		return 0, fmt.Errorf("channel %d out of range (channels are numbered from 1)", ch)
+	}
+	return ch, nil
+}
+
+// ParseChannelGains parses gains of channels, each of the form channel=gain, such as "2=-6dB" or
+// "3-4=+3". Several may be given in one string, separated by commas.
+func ParseChannelGains(specs []string) (map[int]float64, error) {
+	var gains map[int]float64
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			channelText, gainText, ok := strings.Cut(part, "=")
+			if !ok {
+				return nil, fmt.Errorf("%q must be of the form channel=gain", part)
+			}
+			channels, err := ParseChannelList(channelText)
+			if err != nil {
+				return nil, err
+			}
+			gain, err := ParseGain(gainText)
+			if err != nil {
+				return nil, err
+			}
+
+			if gains == nil {
+				gains = make(map[int]float64)
+			}
+			for _, ch := range channels {
+				gains[ch] = gain
+			}
+		}
+	}
+	return gains, nil
+}
+
+// ParseGain parses a gain in decibels, such as "-6dB" or "+3"
+func ParseGain(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(strings.ToLower(s), "db") {
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+	gain, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(gain) || math.IsInf(gain, 0) {
+		return 0, fmt.Errorf("invalid gain %q", s)
+	}
+	return gain, nil
+}
+
+// getEntryChannelMix returns the mix of the channels of the playlist entry
+func getEntryChannelMix(entry *playlist.Song) (ChannelMix, error) {
+	return ParseChannelMix(entry.Mute, entry.Solo, entry.ChannelGain)
+}
+
+// channelMixer applies the mix of the channels of the song being played to its premixes as
+// they're rendered, so that everything it's written to hears the same thing. The mix can be
+// changed while the song plays.
+//
+// Notes that have been carried past their channel (by new note actions) can't be told apart, so
+// they're left alone by mutes and gains, but silenced while any channel is soloed.
+type channelMixer struct {
+	mu       sync.Mutex
+	channels int
+	mute     map[int]bool
+	solo     map[int]bool
+	gain     map[int]float64
+}
+
+// reset starts the mix of a song with the channels. Channels in the mix past the last one of the
+// song are ignored.
+func (m *channelMixer) reset(mix ChannelMix, channels int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.channels = channels
+	m.mute = make(map[int]bool)
+	m.solo = make(map[int]bool)
+	m.gain = make(map[int]float64)
+	for _, ch := range mix.Mute {
+		if ch <= channels {
+			m.mute[ch] = true
+		}
+	}
+	for _, ch := range mix.Solo {
+		if ch <= channels {
+			m.solo[ch] = true
+		}
+	}
+	for ch, gain := range mix.Gain {
+		if ch <= channels {
+			m.gain[ch] = gain
+		}
+	}
+}
+
+// Mix returns the current mix of the channels
+func (m *channelMixer) Mix() ChannelMix {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mix := ChannelMix{
+		Mute: slices.Sorted(maps.Keys(m.mute)),
+		Solo: slices.Sorted(maps.Keys(m.solo)),
+	}
+	if len(m.gain) > 0 {
+		mix.Gain = maps.Clone(m.gain)
+	}
+	return mix
+}
+
+// Channels returns the number of channels of the song being mixed
+func (m *channelMixer) Channels() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.channels
+}
+
+// SetMute mutes or unmutes the channels
+func (m *channelMixer) SetMute(channels []int, muted bool) error {
+	return m.update(channels, func(ch int) {
+		if muted {
+			m.mute[ch] = true
+		} else {
+			delete(m.mute, ch)
+		}
+	})
+}
+
+// ToggleMute mutes the channel if it's heard, or unmutes it if it's muted
+func (m *channelMixer) ToggleMute(ch int) error {
+	return m.update([]int{ch}, func(ch int) {
+		if m.mute[ch] {
+			delete(m.mute, ch)
+		} else {
+			m.mute[ch] = true
+		}
+	})
+}
+
+// SetSolo solos the channels, or takes them out of the solo
+func (m *channelMixer) SetSolo(channels []int, soloed bool) error {
+	return m.update(channels, func(ch int) {
+		if soloed {
+			m.solo[ch] = true
+		} else {
+			delete(m.solo, ch)
+		}
+	})
+}
+
+// SetGain sets the gain of the channels, in decibels
+func (m *channelMixer) SetGain(channels []int, gain float64) error {
+	return m.update(channels, func(ch int) {
+		if gain == 0 {
+			delete(m.gain, ch)
+		} else {
+			m.gain[ch] = gain
+		}
+	})
+}
+
+// update makes the change to each of the channels, once they're all known to exist
+func (m *channelMixer) update(channels []int, change func(ch int)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mute == nil {
+		return ErrNothingPlaying
+	}
+	if len(channels) == 0 {
+		return errors.New("no channels given")
+	}
+	for _, ch := range channels {
+		if ch < 1 || ch > m.channels {
+			return fmt.Errorf("channel %d out of range (the song has %d channels)", ch, m.channels)
+		}
+	}
+	for _, ch := range channels {
+		change(ch)
+	}
+	return nil
+}
+
+// apply mixes the channels of the premix
+func (m *channelMixer) apply(premix *playbackOutput.PremixData) {
+	if len(premix.Data) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.mute) == 0 && len(m.solo) == 0 && len(m.gain) == 0 {
+		return
+	}
+
+	outputs := premix.Data[0]
+	for i := range outputs {
+		ch := i + 1
+		if ch > m.channels {
+			// a note carried past its channel
+			if len(m.solo) > 0 {
+				outputs[i].Volume = 0
+			}
+			continue
+		}
+
+		switch {
+		case m.mute[ch], len(m.solo) > 0 && !m.solo[ch]:
+			outputs[i].Volume = 0
+		default:
+			if gain, ok := m.gain[ch]; ok {
+				outputs[i].Volume *= volume.Volume(dbToGain(gain))
+			}
+		}
+	}
+}
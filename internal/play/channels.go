@@ -0,0 +1,28 @@
+package play
+
+import (
+	"github.com/gotracker/playback/index"
+	"github.com/gotracker/playback/player/machine"
+)
+
+// channelMuter is implemented by the playback machines of every format
+type channelMuter interface {
+	IsChannelMuted(ch index.Channel) (bool, error)
+}
+
+// getNumChannels returns the number of channels of the machine's song. The machines don't report
+// it directly, but refuse to look at channels past the last one.
+func getNumChannels(m machine.MachineInfo) int {
+	cm, ok := m.(channelMuter)
+	if !ok {
+		return 0
+	}
+
+	n := 0
+	for {
+		if _, err := cm.IsChannelMuted(index.Channel(n)); err != nil {
+			return n
+		}
+		n++
+	}
+}
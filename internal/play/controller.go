@@ -0,0 +1,732 @@
+package play
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/events"
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/output"
+	"github.com/gotracker/gotracker/internal/output/device"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/playback/mixing/volume"
+	playbackOutput "github.com/gotracker/playback/output"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+	"github.com/gotracker/playback/player/machine/settings"
+	"github.com/gotracker/playback/player/render"
+)
+
+// ControllerState is the playback state of a Controller
+type ControllerState int
+
+const (
+	// ControllerStateStopped is when nothing is playing
+	ControllerStateStopped = ControllerState(iota)
+	// ControllerStatePlaying is when the current song is playing
+	ControllerStatePlaying
+	// ControllerStatePaused is when the current song is paused
+	ControllerStatePaused
+)
+
+var controllerStateNames = []string{"stopped", "playing", "paused"}
+
+func (s ControllerState) String() string {
+	if int(s) < 0 || int(s) >= len(controllerStateNames) {
+		return "unknown"
+	}
+	return controllerStateNames[s]
+}
+
+var (
+	// ErrNothingPlaying is returned when a command needs a song to be playing
+	ErrNothingPlaying = errors.New("nothing is playing")
+)
+
+// SongStatus describes the current song of a Controller
+type SongStatus struct {
+	Filepath string  `json:"file"`
+	Title    string  `json:"title"`
+	Artist   string  `json:"artist,omitempty"`
+	Orders   int     `json:"orders"`
+	Order    int     `json:"order"`
+	Row      int     `json:"row"`
+	Elapsed  float64 `json:"elapsed"` // seconds of the song that have been heard
+	Channels int     `json:"channels"`
+	// the mix of the channels, which are numbered from 1
+	Muted  []int           `json:"muted,omitempty"`
+	Soloed []int           `json:"soloed,omitempty"`
+	Gain   map[int]float64 `json:"gain,omitempty"` // decibels
+	// how fast, and at what pitch, the song is played
+	Speed     float64 `json:"speed"` // relative to the song's own tempo
+	Transpose float64 `json:"transpose"`
+	SpeedMode string  `json:"speed_mode"`
+}
+
+// Status is a snapshot of the state of a Controller
+type Status struct {
+	State  string `json:"state"`
+	Index  int    `json:"index"` // index of the current song in the playlist (-1 = none)
+	Length int    `json:"length"`
+	// PlaylistVersion changes whenever songs are added to or removed from the playlist
+	PlaylistVersion int         `json:"playlist_version"`
+	Looping         bool        `json:"looping"` // the playlist starts over once it's finished
+	Volume          int         `json:"volume"`  // 0-100
+	Song            *SongStatus `json:"song,omitempty"`
+}
+
+// Controller plays a playlist under the direction of commands issued from other goroutines
+type Controller struct {
+	features []playbackFeature.Feature
+	settings *Settings
+	outCfg   deviceCommon.Settings
+	logger   logging.Log
+	volume   atomic.Uint32 // float32 bits
+	renderChain
+
+	mu         sync.Mutex
+	pl         *playlist.Playlist
+	state      ControllerState
+	index      int // index of the current song in the playlist (-1 = none)
+	player     *Player
+	inFlight   bool // set from when a song is picked to play until it has finished
+	changed    bool // set when a command changes the current song, so it isn't advanced past when the player stops
+	wake       chan struct{}
+	sampleRate int
+	plVersion  int
+	subs       map[*Subscription]struct{}
+
+	// the song each rendered row belongs to, so that the rows still queued for the output
+	// device when the song changes aren't counted against the new one
+	serial     int
+	rowSongs   []int
+	song       *SongStatus
+	songSerial int
+	elapsed    int64 // samples
+}
+
+// NewController creates a controller for the playlist. Nothing is played until Run is called.
+func NewController(pl *playlist.Playlist, features []playbackFeature.Feature, settings *Settings, outCfg deviceCommon.Settings, logger logging.Log) *Controller {
+	c := Controller{
+		features: features,
+		settings: settings,
+		outCfg:   outCfg,
+		logger:   logger,
+		pl:       pl,
+		index:    -1,
+		wake:     make(chan struct{}, 1),
+	}
+	if pl.Len() > 0 {
+		c.index = 0
+	}
+	c.volume.Store(math.Float32bits(1))
+	return &c
+}
+
+// Run opens the output device and plays songs as directed until the context is done
+func (c *Controller) Run(ctx context.Context) error {
+	var pub *events.Publisher
+
+	outCfg := c.outCfg
+	outCfg.OnRowOutput = func(kind deviceCommon.Kind, premix *playbackOutput.PremixData) {
+		if pub != nil {
+			pub.Written(premix)
+		}
+		c.onRowOutput(kind, premix)
+	}
+	if err := negotiateOutputFormat(&outCfg, c.logger); err != nil {
+		return err
+	}
+
+	pub, err := startEvents(c.settings, outCfg.SamplesPerSecond, c.logger)
+	if err != nil {
+		return err
+	}
+	if pub != nil {
+		defer pub.Close()
+	}
+
+	c.mu.Lock()
+	c.sampleRate = outCfg.SamplesPerSecond
+	c.mu.Unlock()
+
+	if err := ValidateProfile(c.settings.Profile); err != nil {
+		return err
+	}
+	if _, err := getEntrySpeed(&playlist.Song{}, c.settings); err != nil {
+		return err
+	}
+
+	norm, err := newLoudnessNormalizer(c.settings.Normalize, c.features, c.settings, outCfg.StereoSeparation, c.logger)
+	if err != nil {
+		return err
+	}
+	if c.settings.Normalize == NormalizeAlbum {
+		c.logger.Println("The playlist can change while it plays, so each song is normalized on its own")
+	}
+
+	var r renderer
+	defer r.Close()
+
+	waveOut, devFeatures, err := startOutput(&r, outCfg, c.logger)
+	if err != nil {
+		return err
+	}
+	defer waveOut.Close()
+
+	c.logger.Printf("Output device: %s\n", waveOut.dev.Name())
+
+	features := append(slices.Clone(c.features), devFeatures...)
+	features = append(features, playbackFeature.IgnoreUnknownEffect{Enabled: true})
+	tickInterval := getTickInterval(features)
+
+	c.level = func() volume.Volume {
+		return volume.Volume(math.Float32frombits(c.volume.Load()))
+	}
+	if pub != nil {
+		c.rendered = pub.Rendered
+	}
+	out, err := c.newSampler(c.settings, outCfg.SamplesPerSecond, output.GetRenderChannels(outCfg.Channels), outCfg.StereoSeparation, func(premix *playbackOutput.PremixData) {
+		c.mu.Lock()
+		c.rowSongs = append(c.rowSongs, c.serial)
+		c.mu.Unlock()
+		r.outBufs <- premix
+	})
+	if err != nil {
+		return err
+	}
+
+	var us settings.UserSettings
+	defer us.CloseTracing()
+
+	for {
+		entry, index, ok := c.waitForSong(ctx)
+		if !ok {
+			break
+		}
+
+		m, songData, err := newEntryMachine(entry, features, true, c.settings, &us)
+		if err != nil {
+			c.logger.Printf("Could not play %q: %v\n", entry.Filepath, err)
+			c.finishSong(index)
+			continue
+		}
+
+		gain := getEntryGain(entry, norm.gains([]*playlist.Song{entry}))
+		if err := c.startEntry(entry, gain, m, songData, c.settings, out); err != nil {
+			c.logger.Printf("Could not play %q: %v\n", entry.Filepath, err)
+			c.finishSong(index)
+			continue
+		}
+		channels := getNumChannels(m)
+
+		p, err := NewPlayer(ctx, tickInterval, nil)
+		if err != nil {
+			return err
+		}
+
+		md := getEntryMetadata(entry, m)
+		if err := device.SetMetadata(waveOut.dev, md); err != nil {
+			c.logger.Printf("Could not update the output device metadata: %v\n", err)
+		}
+		c.logger.Printf("Playing [%d/%d]: %s\n", index+1, c.Len(), md.Title)
+		if gain != 0 {
+			c.logger.Printf("Gain: %+.1f dB\n", gain)
+		}
+
+		paused, skip := c.startSong(p, &SongStatus{
+			Filepath: entry.Filepath,
+			Title:    md.Title,
+			Artist:   md.Artist,
+			Orders:   m.GetNumOrders(),
+			Channels: channels,
+		})
+
+		if pub != nil && !skip {
+			pub.SongStart(events.Song{
+				Index:    index,
+				Filepath: entry.Filepath,
+				Title:    md.Title,
+				Artist:   md.Artist,
+				Orders:   m.GetNumOrders(),
+				Channels: channels,
+			})
+		}
+
+		if skip {
+			_ = p.Stop() // lint
+		} else if err := p.Play(m, out, us.Tracer); err != nil {
+			c.logger.Printf("Could not play %q: %v\n", entry.Filepath, err)
+		} else {
+			if paused {
+				_ = p.Pause() // lint
+			}
+			if err := p.WaitUntilDone(); err != nil && !errors.Is(err, context.Canceled) {
+				c.logger.Printf("Playback of %q stopped: %v\n", entry.Filepath, err)
+			}
+		}
+
+		if pub != nil {
+			pub.SongEnd()
+		}
+		if c.finishSong(index) {
+			c.dropQueuedRows(&r)
+		}
+	}
+
+	return waveOut.Finish(&r)
+}
+
+// waitForSong waits until there's a song to play, returning it along with its playlist index
+func (c *Controller) waitForSong(ctx context.Context) (*playlist.Song, int, bool) {
+	for {
+		c.mu.Lock()
+		if c.state == ControllerStatePlaying && c.index >= 0 && c.index < c.pl.Len() {
+			entry, index := c.pl.GetSong(c.index), c.index
+			c.inFlight = true
+			c.mu.Unlock()
+			return entry, index, true
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, -1, false
+		case <-c.wake:
+		}
+	}
+}
+
+// startSong records the player of the song that's starting, returning whether it should start
+// paused and whether it should be skipped, as a command has changed the song in the meantime
+func (c *Controller) startSong(p *Player, song *SongStatus) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.changed {
+		return false, true
+	}
+
+	c.player = p
+	c.serial++
+	c.song = song
+	c.songSerial = c.serial
+	c.elapsed = 0
+	c.notify(ChangePlayer)
+	return c.state == ControllerStatePaused, false
+}
+
+// finishSong moves on to the next song, unless a command has already chosen what plays next.
+// It returns true if the song was interrupted by a command.
+func (c *Controller) finishSong(index int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.player = nil
+	c.inFlight = false
+	if c.changed {
+		c.changed = false
+		return true
+	}
+
+	defer c.notify(ChangePlayer)
+	c.index = index + 1
+	if c.index >= c.pl.Len() {
+		if c.pl.IsLooping() && c.pl.Len() > 0 {
+			c.index = 0
+		} else {
+			c.index = -1
+			c.state = ControllerStateStopped
+			c.song = nil
+		}
+	}
+	return false
+}
+
+// dropQueuedRows discards the rows of an interrupted song that haven't reached the output
+// device yet, so that the change is heard straight away
+func (c *Controller) dropQueuedRows(r *renderer) {
+	for {
+		select {
+		case <-r.outBufs:
+			c.mu.Lock()
+			if len(c.rowSongs) > 0 {
+				c.rowSongs = c.rowSongs[1:]
+			}
+			c.mu.Unlock()
+		default:
+			return
+		}
+	}
+}
+
+func (c *Controller) onRowOutput(kind deviceCommon.Kind, premix *playbackOutput.PremixData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.rowSongs) == 0 {
+		return
+	}
+	serial := c.rowSongs[0]
+	c.rowSongs = c.rowSongs[1:]
+
+	if c.song == nil || serial != c.songSerial {
+		return
+	}
+	c.elapsed += int64(premix.SamplesLen)
+	if row, ok := premix.Userdata.(*render.RowRender); ok {
+		c.song.Order = row.Order
+		c.song.Row = row.Row
+	}
+}
+
+// signal wakes up the playback loop
+func (c *Controller) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// restart stops the current song (if there is one) so that the song at the current index
+// plays next. It must be called with the lock held, and the returned player stopped after
+// the lock is released.
+func (c *Controller) restart() *Player {
+	if c.inFlight {
+		c.changed = true
+	}
+	p := c.player
+	c.song = nil
+	c.signal()
+	c.notify(ChangePlayer)
+	return p
+}
+
+func stopPlayer(p *Player) error {
+	if p == nil {
+		return nil
+	}
+	return p.Stop()
+}
+
+// Len returns the number of songs in the playlist
+func (c *Controller) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pl.Len()
+}
+
+// Songs returns the songs in the playlist
+func (c *Controller) Songs() []playlist.Song {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	songs := make([]playlist.Song, c.pl.Len())
+	for i := range songs {
+		songs[i] = *c.pl.GetSong(i)
+	}
+	return songs
+}
+
+// Enqueue adds the songs to the end of the playlist, returning the new length of the playlist
+func (c *Controller) Enqueue(songs ...playlist.Song) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range songs {
+		c.pl.Add(s)
+	}
+	c.plVersion++
+	c.notify(ChangePlaylist)
+	if c.index < 0 && c.state == ControllerStateStopped && c.pl.Len() > 0 {
+		c.index = 0
+	}
+	return c.pl.Len()
+}
+
+// Play starts playing the song at the playlist index. If the index is negative, a paused song is
+// resumed, or the current song is played from the start if nothing is playing.
+func (c *Controller) Play(index int) error {
+	c.mu.Lock()
+	if index < 0 {
+		switch c.state {
+		case ControllerStatePaused:
+			c.mu.Unlock()
+			return c.Resume()
+		case ControllerStatePlaying:
+			c.mu.Unlock()
+			return nil
+		}
+		index = max(c.index, 0)
+	}
+
+	if index >= c.pl.Len() {
+		c.mu.Unlock()
+		return fmt.Errorf("song index out of range: %d (the playlist has %d songs)", index, c.pl.Len())
+	}
+
+	c.index = index
+	c.state = ControllerStatePlaying
+	p := c.restart()
+	c.mu.Unlock()
+
+	return stopPlayer(p)
+}
+
+// Pause pauses the current song
+func (c *Controller) Pause() error {
+	c.mu.Lock()
+	if c.state != ControllerStatePlaying {
+		c.mu.Unlock()
+		return nil
+	}
+	c.state = ControllerStatePaused
+	p := c.player
+	c.notify(ChangePlayer)
+	c.mu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.Pause()
+}
+
+// Resume resumes the current song, or starts playing if nothing is playing
+func (c *Controller) Resume() error {
+	c.mu.Lock()
+	switch c.state {
+	case ControllerStatePlaying:
+		c.mu.Unlock()
+		return nil
+	case ControllerStateStopped:
+		c.mu.Unlock()
+		return c.Play(-1)
+	}
+	c.state = ControllerStatePlaying
+	p := c.player
+	c.signal()
+	c.notify(ChangePlayer)
+	c.mu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.Resume()
+}
+
+// Stop stops playback. The current song is played from the start the next time Play is called.
+func (c *Controller) Stop() error {
+	c.mu.Lock()
+	c.state = ControllerStateStopped
+	p := c.restart()
+	c.mu.Unlock()
+
+	return stopPlayer(p)
+}
+
+// Next moves on to the next song in the playlist
+func (c *Controller) Next() error {
+	c.mu.Lock()
+	index := c.index + 1
+	if index >= c.pl.Len() {
+		if !c.pl.IsLooping() || c.pl.Len() == 0 {
+			c.mu.Unlock()
+			return errors.New("there is no next song")
+		}
+		index = 0
+	}
+	c.index = index
+	p := c.restart()
+	c.mu.Unlock()
+
+	return stopPlayer(p)
+}
+
+// Previous moves back to the previous song in the playlist, or restarts the first one
+func (c *Controller) Previous() error {
+	c.mu.Lock()
+	if c.pl.Len() == 0 {
+		c.mu.Unlock()
+		return errors.New("there is no previous song")
+	}
+	c.index = max(c.index-1, 0)
+	p := c.restart()
+	c.mu.Unlock()
+
+	return stopPlayer(p)
+}
+
+// Seek moves playback of the current song to the order and row
+func (c *Controller) Seek(order, row int) error {
+	c.mu.Lock()
+	p := c.player
+	c.mu.Unlock()
+
+	if p == nil {
+		return ErrNothingPlaying
+	}
+	if err := p.Seek(order, row); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.notify(ChangePlayer)
+	c.mu.Unlock()
+	return nil
+}
+
+// SeekTime moves playback of the current song to the row that plays at the time, according to
+// the song's timing. The elapsed time of the song becomes the start of that row.
+func (c *Controller) SeekTime(d time.Duration, timing *SongTiming) error {
+	row, ok := timing.RowAt(d)
+	if !ok {
+		return fmt.Errorf("seek time out of range: %v (the song is %v long)", d, timing.Duration)
+	}
+
+	c.mu.Lock()
+	p := c.player
+	c.mu.Unlock()
+
+	if p == nil {
+		return ErrNothingPlaying
+	}
+	if err := p.Seek(row.Order, row.Row); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.player == p && c.song != nil {
+		// the rows rendered before the seek are still on their way to the output device - they
+		// mustn't count towards the new position
+		c.serial++
+		c.songSerial = c.serial
+		c.elapsed = int64(row.Start.Seconds() * float64(c.sampleRate))
+		c.song.Order = row.Order
+		c.song.Row = row.Row
+	}
+	c.notify(ChangePlayer)
+	return nil
+}
+
+// SetVolume sets the playback volume (0-100)
+func (c *Controller) SetVolume(v int) error {
+	if v < 0 || v > 100 {
+		return fmt.Errorf("volume out of range: %d (0-100)", v)
+	}
+	c.volume.Store(math.Float32bits(float32(v) / 100))
+
+	c.mu.Lock()
+	c.notify(ChangeMixer)
+	c.mu.Unlock()
+	return nil
+}
+
+// SetChannelMute mutes or unmutes channels of the current song. Changes to the mix of the
+// channels last until the song ends.
+func (c *Controller) SetChannelMute(channels []int, muted bool) error {
+	return c.changeMix(func() error {
+		return c.mixer.SetMute(channels, muted)
+	})
+}
+
+// SetChannelSolo solos channels of the current song, or takes them out of the solo
+func (c *Controller) SetChannelSolo(channels []int, soloed bool) error {
+	return c.changeMix(func() error {
+		return c.mixer.SetSolo(channels, soloed)
+	})
+}
+
+// SetChannelGain sets the gain of channels of the current song, in decibels
+func (c *Controller) SetChannelGain(channels []int, gain float64) error {
+	return c.changeMix(func() error {
+		return c.mixer.SetGain(channels, gain)
+	})
+}
+
+// SetSpeed sets the speed the current song is played at, relative to its own tempo, and how the
+// speed changes it (no mode = as it was). Changes to the speed last until the song ends.
+func (c *Controller) SetSpeed(factor float64, mode string) error {
+	return c.changeMix(func() error {
+		s := c.speed.get()
+		s.factor = factor
+		if mode != "" {
+			s.mode = mode
+		}
+		return c.speed.set(s)
+	})
+}
+
+// SetTranspose sets the semitones the pitch of the current song is shifted by
+func (c *Controller) SetTranspose(semitones float64) error {
+	return c.changeMix(func() error {
+		s := c.speed.get()
+		s.transpose = semitones
+		return c.speed.set(s)
+	})
+}
+
+func (c *Controller) changeMix(change func() error) error {
+	c.mu.Lock()
+	p := c.player
+	c.mu.Unlock()
+
+	if p == nil {
+		return ErrNothingPlaying
+	}
+	if err := change(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.notify(ChangeMixer)
+	c.mu.Unlock()
+	return nil
+}
+
+// Clear stops playback and removes all of the songs from the playlist
+func (c *Controller) Clear() error {
+	c.mu.Lock()
+	c.pl.Clear()
+	c.plVersion++
+	c.notify(ChangePlaylist)
+	c.index = -1
+	c.state = ControllerStateStopped
+	p := c.restart()
+	c.mu.Unlock()
+
+	return stopPlayer(p)
+}
+
+// Status returns a snapshot of the controller's state
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Status{
+		State:           c.state.String(),
+		Index:           c.index,
+		Length:          c.pl.Len(),
+		PlaylistVersion: c.plVersion,
+		Looping:         c.pl.IsLooping(),
+		Volume:          int(math.Round(float64(math.Float32frombits(c.volume.Load())) * 100)),
+	}
+	if c.song != nil {
+		song := *c.song
+		if c.sampleRate > 0 {
+			song.Elapsed = float64(c.elapsed) / float64(c.sampleRate)
+		}
+		mix := c.mixer.Mix()
+		song.Muted, song.Soloed, song.Gain = mix.Mute, mix.Solo, mix.Gain
+		speed := c.speed.get()
+		song.Speed, song.Transpose, song.SpeedMode = speed.factor, speed.transpose, speed.mode
+		s.Song = &song
+	}
+	return s
+}
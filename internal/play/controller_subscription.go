@@ -0,0 +1,69 @@
+package play
+
+// Change is a set of the parts of a Controller's state that have changed
+type Change int
+
+const (
+	// ChangePlayer is a change of the playback state, the current song or its position
+	ChangePlayer = Change(1 << iota)
+	// ChangeMixer is a change of the volume
+	ChangeMixer
+	// ChangePlaylist is a change of the songs in the playlist
+	ChangePlaylist
+)
+
+// Subscription collects the changes made to a Controller's state
+type Subscription struct {
+	c       *Controller
+	ch      chan struct{}
+	pending Change
+}
+
+// Subscribe returns a subscription to the changes made to the controller's state from now on
+func (c *Controller) Subscribe() *Subscription {
+	s := Subscription{
+		c:  c,
+		ch: make(chan struct{}, 1),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[*Subscription]struct{})
+	}
+	c.subs[&s] = struct{}{}
+	return &s
+}
+
+// Changed signals when there are changes to take
+func (s *Subscription) Changed() <-chan struct{} {
+	return s.ch
+}
+
+// Take returns the changes made since the last time it was called
+func (s *Subscription) Take() Change {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	change := s.pending
+	s.pending = 0
+	return change
+}
+
+// Close stops collecting changes
+func (s *Subscription) Close() {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	delete(s.c.subs, s)
+}
+
+// notify records the change for all subscribers. It must be called with the lock held.
+func (c *Controller) notify(change Change) {
+	for s := range c.subs {
+		s.pending |= change
+		select {
+		case s.ch <- struct{}{}:
+		default:
+		}
+	}
+}
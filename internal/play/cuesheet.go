@@ -0,0 +1,70 @@
+package play
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cueTrack is a single track entry within a cue sheet
+type cueTrack struct {
+	Title       string
+	StartSample int64
+}
+
+// cueSheet is a description of the tracks rendered into a single combined file
+type cueSheet struct {
+	SampleRate int
+	Tracks     []cueTrack
+}
+
+// AddTrack appends a track that starts at the provided sample position
+func (c *cueSheet) AddTrack(title string, startSample int64) {
+	c.Tracks = append(c.Tracks, cueTrack{
+		Title:       title,
+		StartSample: startSample,
+	})
+}
+
+// cueSheetFilepath returns the path of the cue sheet that accompanies the audio file
+func cueSheetFilepath(audioFilepath string) string {
+	return strings.TrimSuffix(audioFilepath, filepath.Ext(audioFilepath)) + ".cue"
+}
+
+// WriteFile writes the cue sheet for the audio file to a .cue file alongside it
+func (c cueSheet) WriteFile(audioFilepath string) error {
+	f, err := os.Create(cueSheetFilepath(audioFilepath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "FILE %s WAVE\n", cueQuote(filepath.Base(audioFilepath)))
+	for i, t := range c.Tracks {
+		fmt.Fprintf(w, "  TRACK %0.2d AUDIO\n", i+1)
+		if t.Title != "" {
+			fmt.Fprintf(w, "    TITLE %s\n", cueQuote(t.Title))
+		}
+		fmt.Fprintf(w, "    INDEX 01 %s\n", c.timestamp(t.StartSample))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// timestamp converts a sample position to a cue sheet timestamp (mm:ss:ff, at 75 frames per second)
+func (c cueSheet) timestamp(sample int64) string {
+	if c.SampleRate <= 0 {
+		return "00:00:00"
+	}
+	frames := sample * 75 / int64(c.SampleRate)
+	return fmt.Sprintf("%0.2d:%0.2d:%0.2d", frames/(75*60), (frames/75)%60, frames%75)
+}
+
+func cueQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `'`) + `"`
+}
@@ -0,0 +1,43 @@
+package play
+
+import (
+	"time"
+
+	"github.com/gotracker/gotracker/internal/events"
+	"github.com/gotracker/gotracker/internal/logging"
+)
+
+// startEvents starts the sinks of playback events that are enabled by the settings, returning a
+// publisher that feeds them (along with any other sinks given), or nil if there are none
+func startEvents(settings *Settings, sampleRate int, logger logging.Log, sinks ...events.Sink) (*events.Publisher, error) {
+
+	if settings.EventsListen != "" {
+		ws, err := events.NewWebSocketServer(settings.EventsListen, settings.EventsAnyOrigin, logger)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("Event feed: ws://%s/events\n", ws.Addr())
+		sinks = append(sinks, ws)
+	}
+
+	if settings.OSCTarget != "" {
+		osc, err := events.NewOSCSender(settings.OSCTarget, time.Duration(settings.OSCLatency)*time.Millisecond)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		logger.Printf("OSC messages: udp://%s\n", settings.OSCTarget)
+		sinks = append(sinks, osc)
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return events.NewPublisher(sampleRate, sinks...), nil
+}
+
+func closeSinks(sinks []events.Sink) {
+	for _, s := range sinks {
+		_ = s.Close() // lint
+	}
+}
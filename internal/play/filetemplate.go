@@ -0,0 +1,128 @@
+package play
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fileTemplateValues are the values that can be substituted into an output filepath template
+type fileTemplateValues struct {
+	Index      int    // {index} - 1-based position of the entry in the render order
+	Path       string // {path} - directory of the source module
+	Name       string // {name} - filename of the source module, without extension
+	Title      string // {title} - title of the module (falls back to {name} when blank)
+	StartOrder int    // {start} - starting order of the entry
+	EndOrder   int    // {end} - ending order of the entry (or the last order of the song)
+	Ext        string // {ext} - extension of the output file format
+}
+
+var errUnterminatedTemplateField = errors.New("unterminated field in output filepath template")
+
+// isFileTemplate returns true if the filepath contains template fields
+func isFileTemplate(fp string) bool {
+	return strings.ContainsRune(fp, '{')
+}
+
+// expandFileTemplate fills in the template fields of the filepath template.
+// Fields are formatted as `{name}` or `{name:spec}`, where the spec for integer
+// fields is a width, optionally zero-padded (e.g.: `{index:03}`) and the spec for
+// string fields is a maximum length (e.g.: `{title:32}`).
+func expandFileTemplate(tmpl string, v fileTemplateValues) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.IndexRune(tmpl, '{')
+		if start < 0 {
+			sb.WriteString(tmpl)
+			break
+		}
+		sb.WriteString(tmpl[:start])
+		tmpl = tmpl[start+1:]
+
+		end := strings.IndexRune(tmpl, '}')
+		if end < 0 {
+			return "", errUnterminatedTemplateField
+		}
+		field := tmpl[:end]
+		tmpl = tmpl[end+1:]
+
+		name, spec, _ := strings.Cut(field, ":")
+
+		var (
+			value string
+			err   error
+		)
+		switch name {
+		case "index":
+			value, err = formatTemplateInt(v.Index, spec)
+		case "start":
+			value, err = formatTemplateInt(v.StartOrder, spec)
+		case "end":
+			value, err = formatTemplateInt(v.EndOrder, spec)
+		case "path":
+			value, err = formatTemplateString(v.Path, spec)
+		case "name":
+			value, err = formatTemplateString(sanitizeFilename(v.Name), spec)
+		case "title":
+			title := sanitizeFilename(v.Title)
+			if title == "" {
+				title = sanitizeFilename(v.Name)
+			}
+			value, err = formatTemplateString(title, spec)
+		case "ext":
+			value, err = formatTemplateString(v.Ext, spec)
+		default:
+			err = fmt.Errorf("unknown field %q in output filepath template", name)
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+	}
+
+	return filepath.Clean(sb.String()), nil
+}
+
+func formatTemplateInt(value int, spec string) (string, error) {
+	if spec == "" {
+		return strconv.Itoa(value), nil
+	}
+
+	if _, err := strconv.ParseUint(spec, 10, 8); err != nil {
+		return "", fmt.Errorf("invalid integer format %q in output filepath template", spec)
+	}
+	return fmt.Sprintf("%"+spec+"d", value), nil
+}
+
+func formatTemplateString(value string, spec string) (string, error) {
+	if spec == "" {
+		return value, nil
+	}
+
+	maxLen, err := strconv.ParseUint(spec, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid string format %q in output filepath template", spec)
+	}
+
+	if runes := []rune(value); len(runes) > int(maxLen) {
+		value = strings.TrimSpace(string(runes[:maxLen]))
+	}
+	return value, nil
+}
+
+// sanitizeFilename replaces characters that are not safe to use in a filename on common filesystems
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ':
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+	return strings.Trim(name, " .")
+}
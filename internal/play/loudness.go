@@ -0,0 +1,270 @@
+package play
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/heucuva/optional"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/loudness"
+	"github.com/gotracker/gotracker/internal/mixdown"
+	"github.com/gotracker/gotracker/internal/playlist"
+	playbackOutput "github.com/gotracker/playback/output"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+	"github.com/gotracker/playback/player/machine/settings"
+)
+
+const (
+	// NormalizeOff plays each song at its own level
+	NormalizeOff = "off"
+	// NormalizeTrack brings each song to the same loudness
+	NormalizeTrack = "track"
+	// NormalizeAlbum brings the songs of the playlist to the same loudness as a whole, keeping their
+	// levels relative to each other
+	NormalizeAlbum = "album"
+)
+
+const (
+	// normalizeTarget is the loudness songs are brought to, in LUFS, as ReplayGain 2.0 does
+	normalizeTarget = -18
+	// loudnessSampleRate is the rate songs are rendered at to measure their loudness
+	loudnessSampleRate = 48000
+	// loudnessChannels is the number of channels songs are rendered in to measure their loudness
+	loudnessChannels = 2
+)
+
+// loudnessKey is what the measurement of a song depends on, other than the file itself
+type loudnessKey struct {
+	Start            playlist.Position
+	End              playlist.Position
+	Tempo            optional.Value[int]
+	BPM              optional.Value[int]
+	Mute             string
+	Solo             string
+	ChannelGain      []string
+	DSP              string
+	Profile          string
+	ITEnableNNA      bool
+	StereoSeparation int
+	Speed            float64
+	Transpose        float64
+	SpeedMode        string
+	Oversample       int
+}
+
+// MeasureLoudness measures a single play through the song as it would be heard - with its channel
+// mix, speed and effects - ignoring its loop settings
+func MeasureLoudness(entry *playlist.Song, features []playbackFeature.Feature, renderSettings *Settings, stereoSeparation int) (loudness.Result, error) {
+	var us settings.UserSettings
+	m, songData, err := newEntryMachine(entry, features, false, renderSettings, &us)
+	if err != nil {
+		return loudness.Result{}, err
+	}
+
+	var (
+		chain   renderChain
+		meter   = loudness.New(loudnessSampleRate, loudnessChannels)
+		buf     []float32
+		samples int64
+	)
+	out, err := chain.newSampler(renderSettings, loudnessSampleRate, loudnessChannels, stereoSeparation, func(premix *playbackOutput.PremixData) {
+		buf = mixdown.Interleaved(buf, premix, loudnessChannels)
+		meter.Write(buf)
+		samples += int64(premix.SamplesLen)
+	})
+	if err != nil {
+		return loudness.Result{}, err
+	}
+	if err := chain.startEntry(entry, 0, m, songData, renderSettings, out); err != nil {
+		return loudness.Result{}, err
+	}
+
+	if err := renderOffline(m, out, &samples, loudnessSampleRate); err != nil {
+		return loudness.Result{}, err
+	}
+	return meter.Result(), nil
+}
+
+// loudnessNormalizer works out the gains songs are played at, to bring them to the same loudness
+type loudnessNormalizer struct {
+	mode             string
+	features         []playbackFeature.Feature
+	settings         *Settings
+	stereoSeparation int
+	logger           logging.Log
+	cache            *loudness.Cache // nil if it couldn't be opened
+}
+
+// newLoudnessNormalizer returns the normalizer of the mode, or nil if songs aren't normalized
+func newLoudnessNormalizer(mode string, features []playbackFeature.Feature, settings *Settings, stereoSeparation int, logger logging.Log) (*loudnessNormalizer, error) {
+	switch mode {
+	case NormalizeOff:
+		return nil, nil
+	case NormalizeTrack, NormalizeAlbum:
+	default:
+		return nil, fmt.Errorf("unknown loudness normalization: %q", mode)
+	}
+
+	n := loudnessNormalizer{
+		mode:             mode,
+		features:         append(slices.Clone(features), playbackFeature.IgnoreUnknownEffect{Enabled: true}),
+		settings:         settings,
+		stereoSeparation: stereoSeparation,
+		logger:           logger,
+	}
+
+	path, err := loudness.DefaultCachePath()
+	if err == nil {
+		n.cache, err = loudness.OpenCache(path)
+	}
+	if err != nil {
+		logger.Printf("Could not open the loudness cache, so songs will be measured every time: %v\n", err)
+	}
+	return &n, nil
+}
+
+// gains returns the gain of each of the entries, in decibels. When normalizing an album, the
+// entries are the album. Entries the playlist gives a gain of their own aren't measured.
+func (n *loudnessNormalizer) gains(entries []*playlist.Song) map[*playlist.Song]float64 {
+	if n == nil {
+		return nil
+	}
+
+	var measured []*playlist.Song
+	for _, entry := range entries {
+		if !entry.Gain.IsSet() {
+			measured = append(measured, entry)
+		}
+	}
+	results := n.measure(measured)
+
+	gains := make(map[*playlist.Song]float64)
+	switch n.mode {
+	case NormalizeTrack:
+		for i, entry := range measured {
+			gains[entry] = loudness.Gain(results[i], normalizeTarget)
+		}
+	case NormalizeAlbum:
+		gain := loudness.Gain(loudness.Combine(results), normalizeTarget)
+		for _, entry := range measured {
+			gains[entry] = gain
+		}
+	}
+	return gains
+}
+
+// measure measures the loudness of the entries, several at a time, unless they've been measured
+// before. An entry that can't be measured is taken to be silent, so it's left at its own level.
+func (n *loudnessNormalizer) measure(entries []*playlist.Song) []loudness.Result {
+	results := make([]loudness.Result, len(entries))
+	keys := make([]string, len(entries))
+	var pending []int
+	for i, entry := range entries {
+		speed, err := getEntrySpeed(entry, n.settings)
+		if err != nil {
+			n.logger.Printf("Could not measure the loudness of %q: %v\n", entry.Filepath, err)
+			continue
+		}
+		key, err := loudness.Key(entry.Filepath, loudnessKey{
+			Start:            entry.Start,
+			End:              entry.End,
+			Tempo:            entry.Tempo,
+			BPM:              entry.BPM,
+			Mute:             entry.Mute,
+			Solo:             entry.Solo,
+			ChannelGain:      entry.ChannelGain,
+			DSP:              entry.DSP,
+			Profile:          getEntryProfileName(entry, n.settings),
+			ITEnableNNA:      n.settings.ITEnableNNA,
+			StereoSeparation: n.stereoSeparation,
+			Speed:            speed.factor,
+			Transpose:        speed.transpose,
+			SpeedMode:        speed.mode,
+			Oversample:       max(n.settings.Oversample, 1),
+		})
+		if err != nil {
+			n.logger.Printf("Could not measure the loudness of %q: %v\n", entry.Filepath, err)
+			continue
+		}
+		keys[i] = key
+		if r, ok := n.cachedResult(key); ok {
+			results[i] = r
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	if len(pending) == 0 {
+		return results
+	}
+	n.logger.Printf("Measuring the loudness of %d song(s)\n", len(pending))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.NumCPU(), len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				entry := entries[i]
+				r, err := MeasureLoudness(entry, n.features, n.settings, n.stereoSeparation)
+				if err != nil {
+					n.logger.Printf("Could not measure the loudness of %q: %v\n", entry.Filepath, err)
+					continue
+				}
+				results[i] = r
+				if n.cache != nil {
+					n.cache.Put(keys[i], r)
+				}
+			}
+		}()
+	}
+	for _, i := range pending {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if n.cache != nil {
+		if err := n.cache.Save(); err != nil {
+			n.logger.Printf("Could not save the loudness cache: %v\n", err)
+		}
+	}
+	return results
+}
+
+func (n *loudnessNormalizer) cachedResult(key string) (loudness.Result, bool) {
+	if n.cache == nil {
+		return loudness.Result{}, false
+	}
+	return n.cache.Get(key)
+}
+
+// getPlaylistEntries returns each of the entries of the playlist
+func getPlaylistEntries(pl *playlist.Playlist) []*playlist.Song {
+	entries := make([]*playlist.Song, 0, pl.Len())
+	for i := 0; i < pl.Len(); i++ {
+		if entry := pl.GetSong(i); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// getEntryGain returns the gain the playlist entry is played at, in decibels - its own, if the
+// playlist gives it one, or else the one normalization worked out for it
+func getEntryGain(entry *playlist.Song, gains map[*playlist.Song]float64) float64 {
+	if gain, ok := entry.Gain.Get(); ok {
+		return gain
+	}
+	return gains[entry]
+}
+
+// dbToGain converts decibels to a multiplier of the level
+func dbToGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
@@ -0,0 +1,127 @@
+package play
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/meter"
+)
+
+// meterInterval is how often the status line of meters is redrawn
+const meterInterval = 100 * time.Millisecond
+
+// meterStatusBands is the number of bands of the spectrum on the status line
+const meterStatusBands = 24
+
+// meterStatus keeps a line of meters at the bottom of the terminal, below whatever is logged.
+// Messages logged through it clear the line first, then it's drawn again beneath them.
+type meterStatus struct {
+	logger logging.Log
+	meter  *meter.Meter
+	fd     int
+	quit   chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	line    string
+	midLine bool // a message has been logged without ending its line
+}
+
+// isTerminal returns whether standard output is a terminal, where a status line can be drawn
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// newMeterStatus starts drawing the meter on the status line of the terminal
+func newMeterStatus(m *meter.Meter, logger logging.Log) *meterStatus {
+	s := meterStatus{
+		logger: logger,
+		meter:  m,
+		fd:     int(os.Stdout.Fd()),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return &s
+}
+
+func (s *meterStatus) run() {
+	defer close(s.done)
+	t := time.NewTicker(meterInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-t.C:
+			s.redraw()
+		}
+	}
+}
+
+func (s *meterStatus) redraw() {
+	barWidth := 20
+	if width, _, err := term.GetSize(s.fd); err == nil {
+		// each channel takes its name, a bar, its level and room for a clip warning
+		channels := s.meter.Channels()
+		barWidth = min(max((width-meterStatusBands-channels*16)/max(channels, 1), 4), 30)
+	}
+	line := meter.ANSIStatus(s.meter.Read(meterStatusBands), barWidth)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.midLine {
+		return
+	}
+	s.line = line
+	fmt.Print("\r\x1b[K" + line)
+}
+
+// Print logs the message above the status line
+func (s *meterStatus) Print(args ...any) {
+	s.log(fmt.Sprint(args...))
+}
+
+// Printf logs the message above the status line
+func (s *meterStatus) Printf(format string, args ...any) {
+	s.log(fmt.Sprintf(format, args...))
+}
+
+// Println logs the message above the status line
+func (s *meterStatus) Println(args ...any) {
+	s.log(fmt.Sprintln(args...))
+}
+
+func (s *meterStatus) log(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.midLine && s.line != "" {
+		fmt.Print("\r\x1b[K")
+	}
+	s.logger.Print(msg)
+	s.midLine = msg != "" && !strings.HasSuffix(msg, "\n")
+	if !s.midLine && s.line != "" {
+		fmt.Print(s.line)
+	}
+}
+
+// Close stops drawing the status line and clears it
+func (s *meterStatus) Close() error {
+	close(s.quit)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.midLine && s.line != "" {
+		fmt.Print("\r\x1b[K")
+	}
+	s.line = ""
+	return nil
+}
@@ -5,17 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	progressBar "github.com/cheggaaa/pb"
-	"github.com/gotracker/playback"
 
+	"github.com/gotracker/gotracker/internal/dsp"
+	"github.com/gotracker/gotracker/internal/events"
 	"github.com/gotracker/gotracker/internal/feature"
 	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/meter"
 	"github.com/gotracker/gotracker/internal/output"
+	"github.com/gotracker/gotracker/internal/output/device"
 	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/oversample"
 	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/gotracker/internal/tui"
 	"github.com/gotracker/playback/format"
 	itFeature "github.com/gotracker/playback/format/it/feature"
 	playbackOutput "github.com/gotracker/playback/output"
@@ -28,21 +38,107 @@ import (
 	"github.com/gotracker/playback/tracing"
 )
 
-func Playlist(pl *playlist.Playlist, features []playbackFeature.Feature, settings *Settings, outCfg *deviceCommon.Settings, debugCfg *DebugSettings, logger logging.Log) (bool, error) {
+func Playlist(pl *playlist.Playlist, features []playbackFeature.Feature, settings *Settings, outCfg *deviceCommon.Settings, debugCfg *DebugSettings, logger logging.Log) (played bool, err error) {
 	var (
-		play      playback.Playback
+		r         renderer
+		play      machine.MachineInfo
 		progress  *progressBar.ProgressBar
 		lastOrder int
+		pub       *events.Publisher
+		report    *jsonProgress
+		outputs   []string // the files written, for the progress summary
+		ui        *tui.UI
+		control   *tuiControl
+		meters    *meter.Meter
+		status    *meterStatus
 	)
 
+	ctx := context.Background()
+	if settings.TUI {
+		if ui, err = tui.New(getQueueNames(pl), logger); err != nil {
+			return false, err
+		}
+		// this also gives the terminal back if playback panics
+		defer ui.Close()
+		// as do the player and output device, which play in goroutines of their own
+		r.onPanic = func() {
+			ui.Close()
+		}
+		logger = ui
+
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		control = &tuiControl{
+			ui:     ui,
+			cancel: cancel,
+			mixer:  &r.mixer,
+			speed:  &r.speed,
+		}
+		go control.run(ctx)
+
+		// a failing device stops playback, rather than the process, so the terminal is given back
+		outputErr := make(chan error, 1)
+		r.outputFailed = func(err error) {
+			select {
+			case outputErr <- err:
+			default:
+			}
+			cancel()
+		}
+		defer func() {
+			select {
+			case err = <-outputErr:
+			default:
+			}
+		}()
+	}
+
+	switch settings.Progress {
+	case ProgressText:
+	case ProgressJSON:
+		if report, err = newJSONProgress(settings.ProgressFD); err != nil {
+			return false, err
+		}
+		defer func() {
+			report.Finish(outputs, err)
+		}()
+	default:
+		return false, fmt.Errorf("unknown progress reporting: %q", settings.Progress)
+	}
+
+	if err := oversample.Validate(settings.Oversample); err != nil {
+		return false, err
+	}
+	if err := ValidateProfile(settings.Profile); err != nil {
+		return false, err
+	}
+	if _, err := getEntrySpeed(&playlist.Song{}, settings); err != nil {
+		return false, err
+	}
+
 	outCfg.OnRowOutput = func(kind deviceCommon.Kind, premix *playbackOutput.PremixData) {
+		if pub != nil {
+			pub.Written(premix)
+		}
+		if meters != nil {
+			meters.Written(premix)
+		}
 		row := premix.Userdata.(*render.RowRender)
 		switch kind {
-		case deviceCommon.KindSoundCard:
-			if row.RowText != nil {
+		case deviceCommon.KindSoundCard, deviceCommon.KindNetwork:
+			if row.RowText != nil && ui == nil {
 				logger.Printf("[%0.3d:%0.3d] %s\n", row.Order, row.Row, row.RowText.String())
 			}
 		case deviceCommon.KindFile:
+			if report != nil || ui != nil || status != nil {
+				// the progress is reported through the events instead
+				break
+			}
 			if progress == nil {
 				progress = progressBar.StartNew(play.GetNumOrders())
 				lastOrder = row.Order
@@ -54,30 +150,90 @@ func Playlist(pl *playlist.Playlist, features []playbackFeature.Feature, setting
 		}
 	}
 
-	waveOut, features, err := output.CreateOutputDevice(*outCfg)
+	if err := negotiateOutputFormat(outCfg, logger); err != nil {
+		return false, err
+	}
+
+	if settings.Meters {
+		meters = meter.New(output.GetRenderChannels(outCfg.Channels), outCfg.SamplesPerSecond)
+		switch {
+		case ui != nil:
+			ui.SetMeter(meters)
+		case isTerminal():
+			status = newMeterStatus(meters, logger)
+			defer status.Close()
+			logger = status
+		default:
+			logger.Println("Meters can only be shown on a terminal")
+			meters = nil
+		}
+	}
+
+	norm, err := newLoudnessNormalizer(settings.Normalize, features, settings, outCfg.StereoSeparation, logger)
+	if err != nil {
+		return false, err
+	}
+	gains := norm.gains(getPlaylistEntries(pl))
+
+	outputFilepaths, err := output.GetOutputFilepaths(*outCfg)
 	if err != nil {
 		return false, err
 	}
-	defer waveOut.Close()
+
+	var sinks []events.Sink
+	if report != nil {
+		sinks = append(sinks, report)
+	}
+	if ui != nil {
+		sinks = append(sinks, ui)
+	}
+	pub, err = startEvents(settings, outCfg.SamplesPerSecond, logger, sinks...)
+	if err != nil {
+		return false, err
+	}
+	if pub != nil {
+		defer pub.Close()
+	}
+
+	templated := false
+	for _, fp := range outputFilepaths {
+		if isFileTemplate(fp) {
+			templated = true
+		}
+	}
 
 	var (
-		r  renderer
-		wg sync.WaitGroup
+		waveOut *activeOutput
+		cue     *cueSheet
 	)
 	defer r.Close()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := waveOut.Play(r.PremixData()); err != nil {
-			switch {
-			case errors.Is(err, song.ErrStopSong):
-			case errors.Is(err, context.Canceled):
+	r.events = pub
 
-			default:
-				log.Fatalln(err)
+	if templated {
+		// each entry gets its own output device, so we only need to know what kind it'll be
+		kind, err := output.GetOutputKind(*outCfg)
+		if err != nil {
+			return false, err
+		}
+		features = append(features, output.GetFeaturesForKind(kind)...)
+	} else {
+		var devFeatures []playbackFeature.Feature
+		waveOut, devFeatures, err = startOutput(&r, *outCfg, logger)
+		if err != nil {
+			return false, err
+		}
+		defer waveOut.Close()
+		features = append(features, devFeatures...)
+
+		logger.Printf("Output device: %s\n", waveOut.dev.Name())
+		outputs = outputFilepaths
+
+		if settings.CueSheet && len(outputFilepaths) > 0 {
+			cue = &cueSheet{
+				SampleRate: outCfg.SamplesPerSecond,
 			}
 		}
-	}()
+	}
 
 	features = append(features, playbackFeature.IgnoreUnknownEffect{Enabled: !debugCfg.PanicOnUnhandledEffect})
 
@@ -87,43 +243,155 @@ func Playlist(pl *playlist.Playlist, features []playbackFeature.Feature, setting
 		})
 	}
 
-	logger.Printf("Output device: %s\n", waveOut.Name())
+	var entryIndex int
+	err = r.renderSongs(ctx, pl, features, settings, outCfg, logger, func(entry *playlist.Song, m machine.MachineTicker, outCfg *deviceCommon.Settings, out *sampler.Sampler, tickInterval time.Duration, tracer tracing.Tracer) (err error) {
+		if report != nil {
+			defer func() {
+				if err != nil {
+					report.Error(entry, err)
+				}
+			}()
+		}
 
-	err = r.renderSongs(pl, features, settings, outCfg, func(m machine.MachineTicker, outCfg *deviceCommon.Settings, out *sampler.Sampler, tickInterval time.Duration, tracer tracing.Tracer) error {
 		defer func() {
 			if progress != nil {
 				progress.Set64(progress.Total)
 				progress.Finish()
+				progress = nil
 			}
 		}()
 
+		entryIndex++
+
+		gain := getEntryGain(entry, gains)
+		if err := r.startEntry(entry, gain, m, r.songData, settings, out); err != nil {
+			return err
+		}
+
+		var entryOut *activeOutput
+		if templated {
+			entryCfg := *outCfg
+			entryCfg.Outputs = slices.Clone(outCfg.Outputs)
+			values := getFileTemplateValues(entryIndex, entry, m, outCfg.FileFormat)
+			for i, spec := range entryCfg.Outputs {
+				expanded, err := expandFileTemplate(spec, values)
+				if err != nil {
+					return err
+				}
+				entryCfg.Outputs[i] = expanded
+			}
+			if entryCfg.Filepath, err = expandFileTemplate(outCfg.Filepath, values); err != nil {
+				return err
+			}
+
+			entryFilepaths, err := output.GetOutputFilepaths(entryCfg)
+			if err != nil {
+				return err
+			}
+			for _, fp := range entryFilepaths {
+				if dir := filepath.Dir(fp); dir != "" {
+					if err := os.MkdirAll(dir, 0755); err != nil {
+						return err
+					}
+				}
+			}
+
+			entryOut, _, err = startOutput(&r, entryCfg, logger)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := entryOut.Finish(&r); err != nil {
+					logger.Println(err)
+				}
+			}()
+
+			logger.Printf("Output device: %s (%s)\n", entryOut.dev.Name(), strings.Join(entryFilepaths, ", "))
+			outputs = append(outputs, entryFilepaths...)
+		}
+
+		md := getEntryMetadata(entry, m)
+		if cue != nil {
+			cue.AddTrack(md.Title, r.samplesRendered)
+		}
+
+		activeDev := entryOut
+		if activeDev == nil {
+			activeDev = waveOut
+		}
+		if err := device.SetMetadata(activeDev.dev, md); err != nil {
+			logger.Printf("Could not update the output device metadata: %v\n", err)
+		}
+
+		plIndex := getPlaylistIndex(pl, entry)
+		if ui != nil {
+			if patterns, err := loadSongPatterns(entry, features, settings); err == nil {
+				ui.SetPatterns(plIndex, patterns)
+			}
+		}
+
+		if pub != nil {
+			pub.SongStart(events.Song{
+				Index:    plIndex,
+				Filepath: entry.Filepath,
+				Title:    md.Title,
+				Artist:   md.Artist,
+				Orders:   m.GetNumOrders(),
+				Channels: getNumChannels(m),
+			})
+			defer pub.SongEnd()
+		}
+
+		play = m
 		logger.Printf("Order Looping Enabled: %v\n", m.CanOrderLoop())
 		logger.Printf("Song: %s\n", m.GetName())
+		if gain != 0 {
+			logger.Printf("Gain: %+.1f dB\n", gain)
+		}
 
-		p, err := NewPlayer(context.TODO(), tickInterval)
+		p, err := NewPlayer(ctx, tickInterval, r.onPanic)
 		if err != nil {
 			return err
 		}
+		if control != nil {
+			control.setPlayer(p)
+			defer control.setPlayer(nil)
+		}
 
 		if err := p.Play(m, out, tracer); err != nil {
 			return err
 		}
 
 		if err := p.WaitUntilDone(); err != nil {
+			// end the line of progress before the error is reported
 			logger.Println()
-			logger.Println(err)
 			return err
 		}
 
 		return nil
 	})
+	if ui != nil && ctx.Err() != nil {
+		// the user quit
+		err = nil
+	}
 	if !r.playedAtLeastOneEntry || err != nil {
 		return r.playedAtLeastOneEntry, err
 	}
-	// force the close
-	r.Close()
 
-	wg.Wait()
+	if waveOut != nil {
+		// force the close
+		if err := waveOut.Finish(&r); err != nil {
+			return true, err
+		}
+	}
+
+	if cue != nil {
+		for _, fp := range outputFilepaths {
+			if err := cue.WriteFile(fp); err != nil {
+				return true, err
+			}
+		}
+	}
 
 	logger.Println()
 	logger.Println("done!")
@@ -131,6 +399,152 @@ func Playlist(pl *playlist.Playlist, features []playbackFeature.Feature, setting
 	return true, nil
 }
 
+// negotiateOutputFormat adjusts the output format to one supported by the output device(s) before
+// anything is opened. Filepath templates are expanded with placeholder values, as only the
+// output file format matters here.
+func negotiateOutputFormat(outCfg *deviceCommon.Settings, logger logging.Log) error {
+	cfg := *outCfg
+	cfg.Outputs = slices.Clone(outCfg.Outputs)
+	values := fileTemplateValues{
+		Ext: outCfg.FileFormat,
+	}
+	for i, spec := range cfg.Outputs {
+		expanded, err := expandFileTemplate(spec, values)
+		if err != nil {
+			return err
+		}
+		cfg.Outputs[i] = expanded
+	}
+	if isFileTemplate(cfg.Filepath) {
+		expanded, err := expandFileTemplate(cfg.Filepath, values)
+		if err != nil {
+			return err
+		}
+		cfg.Filepath = expanded
+	}
+
+	if err := output.NegotiateFormat(&cfg, logger); err != nil {
+		return err
+	}
+
+	outCfg.SamplesPerSecond = cfg.SamplesPerSecond
+	outCfg.Channels = cfg.Channels
+	outCfg.BitsPerSample = cfg.BitsPerSample
+	return nil
+}
+
+// activeOutput is an output device that is actively consuming premix data from a renderer
+type activeOutput struct {
+	dev       device.Device
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func startOutput(r *renderer, outCfg deviceCommon.Settings, logger logging.Log) (*activeOutput, []playbackFeature.Feature, error) {
+	dev, features, err := output.CreateOutputDevice(outCfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := activeOutput{
+		dev: dev,
+	}
+
+	premixData := r.PremixData()
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		defer handlePanic(r.onPanic)
+		if err := dev.Play(premixData); err != nil {
+			switch {
+			case errors.Is(err, song.ErrStopSong):
+			case errors.Is(err, context.Canceled):
+
+			case r.outputFailed != nil:
+				r.outputFailed(err)
+				// keep taking the audio, so the renderer isn't left waiting on the device
+				for range premixData {
+				}
+			default:
+				log.Fatalln(err)
+			}
+		}
+	}()
+
+	return &o, features, nil
+}
+
+// Finish closes the renderer's premix stream, waits for the device to consume it, then closes the device
+func (o *activeOutput) Finish(r *renderer) error {
+	r.Close()
+	o.wg.Wait()
+	return o.Close()
+}
+
+// Close closes the device without waiting for it to consume the remaining premix data
+func (o *activeOutput) Close() error {
+	o.closeOnce.Do(func() {
+		o.closeErr = o.dev.Close()
+	})
+	return o.closeErr
+}
+
+// getPlaylistIndex returns the index of the entry in the playlist
+func getPlaylistIndex(pl *playlist.Playlist, entry *playlist.Song) int {
+	for i := range pl.Len() {
+		if pl.GetSong(i) == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+// getEntryEffects returns the chain of effects the audio of the playlist entry is processed with
+func getEntryEffects(entry *playlist.Song, profile mixProfile, sampleRate, channels int) (*dsp.Chain, error) {
+	chain, err := dsp.Parse(profile.effects(entry), sampleRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsp: %w", err)
+	}
+	return chain, nil
+}
+
+// getEntryMetadata returns the description of the playlist entry, for devices that can show it
+func getEntryMetadata(entry *playlist.Song, m machine.MachineInfo) deviceCommon.Metadata {
+	md := deviceCommon.Metadata{
+		Title:  entry.Title,
+		Artist: entry.Artist,
+	}
+	if md.Title == "" {
+		md.Title = strings.TrimSpace(m.GetName())
+	}
+	if md.Title == "" {
+		md.Title = filepath.Base(entry.Filepath)
+	}
+	return md
+}
+
+func getFileTemplateValues(entryIndex int, entry *playlist.Song, m machine.MachineInfo, ext string) fileTemplateValues {
+	values := fileTemplateValues{
+		Index:    entryIndex,
+		Path:     filepath.Dir(entry.Filepath),
+		Name:     strings.TrimSuffix(filepath.Base(entry.Filepath), filepath.Ext(entry.Filepath)),
+		Title:    entry.Title,
+		EndOrder: m.GetNumOrders() - 1,
+		Ext:      ext,
+	}
+	if values.Title == "" {
+		values.Title = m.GetName()
+	}
+	if o, ok := entry.Start.Order.Get(); ok {
+		values.StartOrder = o
+	}
+	if o, ok := entry.End.Order.Get(); ok {
+		values.EndOrder = o
+	}
+	return values
+}
+
 func getFeatureByType[T playbackFeature.Feature](features []playbackFeature.Feature) (T, bool) {
 	var empty T
 	if len(features) == 0 {
@@ -149,7 +563,17 @@ func getFeatureByType[T playbackFeature.Feature](features []playbackFeature.Feat
 
 type renderer struct {
 	playedAtLeastOneEntry bool
+	samplesRendered       int64
 	outBufs               chan *playbackOutput.PremixData
+	events                *events.Publisher // notified of each premix before it's queued, if set
+	songData              song.Data         // of the song being rendered
+	renderChain
+	// outputFailed is told of an output device that fails as it plays. Failures are fatal if it's
+	// not set.
+	outputFailed func(err error)
+	// onPanic, if set, is called when the output device or the player panics, before the panic
+	// carries on
+	onPanic func()
 }
 
 func (p *renderer) PremixData() <-chan *playbackOutput.PremixData {
@@ -167,9 +591,10 @@ func (p *renderer) Close() error {
 	return nil
 }
 
-type playerCBFunc func(pb machine.MachineTicker, outCfg *deviceCommon.Settings, out *sampler.Sampler, tickInterval time.Duration, tracer tracing.Tracer) error
+type playerCBFunc func(entry *playlist.Song, pb machine.MachineTicker, outCfg *deviceCommon.Settings, out *sampler.Sampler, tickInterval time.Duration, tracer tracing.Tracer) error
 
-func (p *renderer) renderSongs(pl *playlist.Playlist, features []playbackFeature.Feature, renderSettings *Settings, outCfg *deviceCommon.Settings, startPlayingCB playerCBFunc) error {
+// getTickInterval returns how often the player should be updated (0 = as fast as possible)
+func getTickInterval(features []playbackFeature.Feature) time.Duration {
 	tickInterval := time.Duration(5) * time.Millisecond
 	if setting, ok := getFeatureByType[feature.PlayerSleepInterval](features); ok {
 		if setting.Enabled {
@@ -178,17 +603,29 @@ func (p *renderer) renderSongs(pl *playlist.Playlist, features []playbackFeature
 			tickInterval = 0
 		}
 	}
+	return tickInterval
+}
+
+// renderSongs plays each of the playlist's entries through the callback. An entry that fails to
+// load or play is reported to the logger and skipped. A looping playlist is played until a pass
+// through it plays nothing.
+func (p *renderer) renderSongs(ctx context.Context, pl *playlist.Playlist, features []playbackFeature.Feature, renderSettings *Settings, outCfg *deviceCommon.Settings, logger logging.Log, startPlayingCB playerCBFunc) error {
+	tickInterval := getTickInterval(features)
 
 	canPossiblyLoop := true
 	if setting, ok := getFeatureByType[playbackFeature.SongLoop](features); ok {
 		canPossiblyLoop = (setting.Count != 0)
 	}
 
-	out := sampler.NewSampler(outCfg.SamplesPerSecond, outCfg.Channels, float32(outCfg.StereoSeparation)/100.0, func(premix *playbackOutput.PremixData) {
+	if p.events != nil {
+		p.rendered = p.events.Rendered
+	}
+	out, err := p.newSampler(renderSettings, outCfg.SamplesPerSecond, output.GetRenderChannels(outCfg.Channels), outCfg.StereoSeparation, func(premix *playbackOutput.PremixData) {
+		p.samplesRendered += int64(premix.SamplesLen)
 		p.outBufs <- premix
 	})
-	if out == nil {
-		return errors.New("could not setup playback sampler")
+	if err != nil {
+		return err
 	}
 
 	var us settings.UserSettings
@@ -204,76 +641,98 @@ func (p *renderer) renderSongs(pl *playlist.Playlist, features []playbackFeature
 
 	defer us.CloseTracing()
 
-playlistLoop:
-	for _, songIdx := range pl.GetPlaylist() {
-		entry := pl.GetSong(songIdx)
-		if entry == nil {
-			continue
-		}
-		songData, songFmt, err := format.Load(entry.Filepath, features...)
-		if err != nil {
-			return fmt.Errorf("could not create song state: %w", err)
-		}
+	for {
+		playedPass := false
+		for _, songIdx := range pl.GetPlaylist() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-		cfg := features
+			entry := pl.GetSong(songIdx)
+			if entry == nil {
+				continue
+			}
+			playback, songData, err := newEntryMachine(entry, features, canPossiblyLoop, renderSettings, &us)
+			if err != nil {
+				logger.Printf("Could not play %q: %v\n", entry.Filepath, err)
+				continue
+			}
+			p.songData = songData
 
-		cfg = append(cfg, playbackFeature.StartOrderAndRow{
-			Order: entry.Start.Order,
-			Row:   entry.Start.Row,
-		})
+			if err = startPlayingCB(entry, playback, outCfg, out, tickInterval, us.Tracer); err != nil {
+				if ctx.Err() == nil {
+					logger.Printf("Could not play %q: %v\n", entry.Filepath, err)
+				}
+				continue
+			}
 
-		endOrder, endOrderSet := entry.End.Order.Get()
-		endRow, endRowSet := entry.End.Row.Get()
-		if endOrderSet && endRowSet && endOrder >= 0 && endRow >= 0 {
-			cfg = append(cfg, playbackFeature.PlayUntilOrderAndRow{
-				Order: endOrder,
-				Row:   endRow,
-			})
-		}
+			pl.MarkPlayed(entry)
 
-		if tempo, ok := entry.Tempo.Get(); ok {
-			cfg = append(cfg, playbackFeature.SetDefaultTempo{Tempo: tempo})
+			p.playedAtLeastOneEntry = true
+			playedPass = true
 		}
 
-		if bpm, ok := entry.BPM.Get(); ok {
-			cfg = append(cfg, playbackFeature.SetDefaultBPM{BPM: bpm})
+		// a looping playlist that played nothing on its way through never will
+		if !pl.IsLooping() || !playedPass {
+			return nil
 		}
+	}
+}
 
-		var loopCount int
-		if canPossiblyLoop {
-			if l, ok := entry.Loop.Count.Get(); ok {
-				loopCount = l
-			}
-		}
-		cfg = append(cfg,
-			playbackFeature.SongLoop{Count: loopCount},
-			itFeature.LongChannelOutput{Enabled: renderSettings.ITLongChannelOutput},
-			itFeature.NewNoteActions{Enabled: renderSettings.ITEnableNNA})
+// newEntryMachine loads the playlist entry and creates the playback machine for it, returning
+// the song it plays along with it
+func newEntryMachine(entry *playlist.Song, features []playbackFeature.Feature, canPossiblyLoop bool, renderSettings *Settings, us *settings.UserSettings) (machine.MachineTicker, song.Data, error) {
+	songData, songFmt, err := format.Load(entry.Filepath, features...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create song state: %w", err)
+	}
 
-		us.Reset()
-		if songFmt != nil {
-			if err := songFmt.ConvertFeaturesToSettings(&us, cfg); err != nil {
-				return fmt.Errorf("could not configure playback settings: %w", err)
-			}
-		}
+	cfg := features
 
-		playback, err := machine.NewMachine(songData, us)
-		if err != nil {
-			return fmt.Errorf("could not create playback machine: %w", err)
-		}
+	cfg = append(cfg, playbackFeature.StartOrderAndRow{
+		Order: entry.Start.Order,
+		Row:   entry.Start.Row,
+	})
 
-		if err = startPlayingCB(playback, outCfg, out, tickInterval, us.Tracer); err != nil {
-			continue
-		}
+	endOrder, endOrderSet := entry.End.Order.Get()
+	endRow, endRowSet := entry.End.Row.Get()
+	if endOrderSet && endRowSet && endOrder >= 0 && endRow >= 0 {
+		cfg = append(cfg, playbackFeature.PlayUntilOrderAndRow{
+			Order: endOrder,
+			Row:   endRow,
+		})
+	}
+
+	if tempo, ok := entry.Tempo.Get(); ok {
+		cfg = append(cfg, playbackFeature.SetDefaultTempo{Tempo: tempo})
+	}
 
-		pl.MarkPlayed(entry)
+	if bpm, ok := entry.BPM.Get(); ok {
+		cfg = append(cfg, playbackFeature.SetDefaultBPM{BPM: bpm})
+	}
 
-		p.playedAtLeastOneEntry = true
+	var loopCount int
+	if canPossiblyLoop {
+		if l, ok := entry.Loop.Count.Get(); ok {
+			loopCount = l
+		}
+	}
+	cfg = append(cfg,
+		playbackFeature.SongLoop{Count: loopCount},
+		itFeature.LongChannelOutput{Enabled: renderSettings.ITLongChannelOutput},
+		itFeature.NewNoteActions{Enabled: renderSettings.ITEnableNNA})
+
+	us.Reset()
+	if songFmt != nil {
+		if err := songFmt.ConvertFeaturesToSettings(us, cfg); err != nil {
+			return nil, nil, fmt.Errorf("could not configure playback settings: %w", err)
+		}
 	}
 
-	if pl.IsLooping() {
-		goto playlistLoop
+	playback, err := machine.NewMachine(songData, *us)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create playback machine: %w", err)
 	}
 
-	return nil
+	return playback, songData, nil
 }
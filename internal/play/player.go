@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
+	"github.com/gotracker/playback/index"
 	"github.com/gotracker/playback/player/machine"
 	"github.com/gotracker/playback/player/sampler"
 	"github.com/gotracker/playback/song"
@@ -29,19 +29,37 @@ const (
 	playerOperationResume
 	playerOperationPause
 	playerOperationStop
+	playerOperationUpdate
 )
 
+// updateFunc is a change made to the playback machine by the player's goroutine
+type updateFunc func(m machine.MachineTicker) error
+
 type playerOp struct {
 	op       playerOperation
+	update   updateFunc
 	response func(err error)
 }
 
+var (
+	// ErrPlayerStopped is returned when an operation is attempted on a player that has stopped
+	ErrPlayerStopped = errors.New("player stopped")
+	// ErrSeekNotSupported is returned when the playback machine can't change its position
+	ErrSeekNotSupported = errors.New("seeking is not supported by the song's format")
+)
+
+type orderRowSetter interface {
+	SetOrder(o index.Order) error
+	SetRow(r index.Row, breakOrder bool) error
+}
+
 // Player is a player of fine tracked musics
 type Player struct {
 	ctx            context.Context
 	cancel         context.CancelCauseFunc
 	state          playerState
 	opCh           chan playerOp
+	done           chan struct{} // closed once the state machine has stopped
 	lastUpdateTime time.Time
 	m              machine.MachineTicker
 	s              *sampler.Sampler
@@ -51,8 +69,10 @@ type Player struct {
 	myTickerCh     chan time.Time
 }
 
-// NewPlayer returns a new Player instance
-func NewPlayer(ctx context.Context, tickInterval time.Duration) (*Player, error) {
+// NewPlayer returns a new Player instance. If the player panics, onPanic is called (if set) before
+// the panic carries on, so that whatever the caller has taken over, such as the terminal, can be
+// given back.
+func NewPlayer(ctx context.Context, tickInterval time.Duration, onPanic func()) (*Player, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -64,6 +84,7 @@ func NewPlayer(ctx context.Context, tickInterval time.Duration) (*Player, error)
 		cancel: cancel,
 		state:  playerStateIdle,
 		opCh:   make(chan playerOp, 1),
+		done:   make(chan struct{}),
 	}
 
 	if tickInterval != time.Duration(0) {
@@ -77,7 +98,7 @@ func NewPlayer(ctx context.Context, tickInterval time.Duration) (*Player, error)
 
 	go func() {
 		defer func() {
-			close(p.opCh)
+			close(p.done)
 
 			if p.ticker != nil {
 				p.ticker.Stop()
@@ -85,6 +106,8 @@ func NewPlayer(ctx context.Context, tickInterval time.Duration) (*Player, error)
 				close(p.myTickerCh)
 			}
 		}()
+		// the state machine panics on unhandled effects, if it's asked to
+		defer handlePanic(onPanic)
 		err := p.runStateMachine()
 		if err == nil {
 			err = song.ErrStopSong
@@ -96,6 +119,19 @@ func NewPlayer(ctx context.Context, tickInterval time.Duration) (*Player, error)
 	return &p, nil
 }
 
+// handlePanic calls onPanic, if it's set, when the goroutine it's deferred in panics, then carries
+// on panicking so the panic can be read. It has to be deferred itself, not called from a deferred
+// function.
+func handlePanic(onPanic func()) {
+	if onPanic == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		onPanic()
+		panic(r)
+	}
+}
+
 // Play starts a player playing
 func (p *Player) Play(m machine.MachineTicker, out *sampler.Sampler, tracer tracing.Tracer) error {
 	if err := p.ctx.Err(); err != nil {
@@ -108,27 +144,80 @@ func (p *Player) Play(m machine.MachineTicker, out *sampler.Sampler, tracer trac
 	return p.enqueueAndAwaitResponse(playerOperationPlay)
 }
 
-func (p *Player) enqueueAndAwaitResponse(op playerOperation) error {
-	var (
-		wg     sync.WaitGroup
-		result error
-	)
+// Pause pauses a playing player
+func (p *Player) Pause() error {
+	return p.enqueueAndAwaitResponse(playerOperationPause)
+}
+
+// Resume resumes a paused player
+func (p *Player) Resume() error {
+	return p.enqueueAndAwaitResponse(playerOperationResume)
+}
+
+// Stop stops the player - it cannot be restarted
+func (p *Player) Stop() error {
+	err := p.enqueueAndAwaitResponse(playerOperationStop)
+	if errors.Is(err, ErrPlayerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Seek moves playback to the order and row
+func (p *Player) Seek(order, row int) error {
+	return p.apply(func(m machine.MachineTicker) error {
+		s, ok := m.(orderRowSetter)
+		if !ok {
+			return ErrSeekNotSupported
+		}
+		if err := s.SetOrder(index.Order(order)); err != nil {
+			return err
+		}
+		return s.SetRow(index.Row(row), false)
+	})
+}
+
+// apply runs the function on the player's goroutine, so it can't race with the rendering of the song
+func (p *Player) apply(fn updateFunc) error {
+	return p.sendAndAwaitResponse(playerOp{
+		op:     playerOperationUpdate,
+		update: fn,
+	})
+}
 
-	wg.Add(1)
-	p.opCh <- playerOp{
+func (p *Player) enqueueAndAwaitResponse(op playerOperation) error {
+	return p.sendAndAwaitResponse(playerOp{
 		op: op,
-		response: func(err error) {
-			defer wg.Done()
-			result = err
-		},
+	})
+}
+
+// sendAndAwaitResponse hands the operation to the player's goroutine. If the player
+// stops before the operation is handled, ErrPlayerStopped is returned.
+func (p *Player) sendAndAwaitResponse(o playerOp) error {
+	result := make(chan error, 1)
+	o.response = func(err error) {
+		result <- err
+	}
+
+	select {
+	case p.opCh <- o:
+	case <-p.done:
+		return ErrPlayerStopped
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-p.done:
+		return ErrPlayerStopped
 	}
-	wg.Wait()
-	return result
 }
 
 // WaitUntilDone waits until the player is done
 func (p *Player) WaitUntilDone() error {
-	<-p.ctx.Done()
+	// the state machine is waited on, rather than the context, so that nothing
+	// more gets rendered once this returns (even when the context is cancelled)
+	<-p.done
 	if err := p.ctx.Err(); err != nil {
 		switch {
 		case errors.Is(err, song.ErrStopSong):
@@ -183,6 +272,8 @@ func (p *Player) runStateIdle() error {
 		case playerOperationStop:
 			op.response(nil)
 			return song.ErrStopSong
+		case playerOperationUpdate:
+			op.response(errors.New("not playing"))
 		default:
 			op.response(fmt.Errorf("unhandled player operation while idle: %d", op.op))
 			return song.ErrStopSong
@@ -209,6 +300,8 @@ func (p *Player) runStatePaused() error {
 		case playerOperationStop:
 			op.response(nil)
 			return song.ErrStopSong
+		case playerOperationUpdate:
+			op.response(op.update(p.m))
 		default:
 			op.response(fmt.Errorf("unhandled player operation while paused: %d", op.op))
 			return song.ErrStopSong
@@ -235,6 +328,8 @@ func (p *Player) runStatePlaying() error {
 		case playerOperationStop:
 			op.response(nil)
 			return song.ErrStopSong
+		case playerOperationUpdate:
+			op.response(op.update(p.m))
 		default:
 			op.response(fmt.Errorf("unhandled player operation while playing: %d", op.op))
 			return song.ErrStopSong
@@ -261,6 +356,15 @@ func (p *Player) update(delta time.Duration) error {
 	firstSet := false
 
 	for !firstSet || remaining < first {
+		// when rendering as fast as possible, a whole song can be rendered in a single update
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		// ...so give way to any operation that's waiting to be handled
+		if firstSet && len(p.opCh) > 0 {
+			break
+		}
+
 		if err := func() error {
 			defer func() {
 				if p.tracer != nil {
@@ -0,0 +1,204 @@
+package play
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	itfile "github.com/gotracker/goaudiofile/music/tracked/it"
+	s3mfile "github.com/gotracker/goaudiofile/music/tracked/s3m"
+	"github.com/gotracker/playback/mixing"
+	"github.com/gotracker/playback/mixing/panning"
+	playbackOutput "github.com/gotracker/playback/output"
+
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+const (
+	// ProfileAuto mixes MODs as ProfileAmiga does, and everything else as ProfileSong does
+	ProfileAuto = "auto"
+	// ProfileCustom mixes songs at the stereo separation given, whatever they say
+	ProfileCustom = "custom"
+	// ProfileSong mixes songs as they say to: Impulse Tracker songs at their own separation,
+	// relative to the one given, and Scream Tracker songs marked as mono in mono
+	ProfileSong = "song"
+	// ProfileAmiga pans the channels hard left and right, in the order the Amiga does (L R R L),
+	// whatever the stereo separation given
+	ProfileAmiga = "amiga"
+	// ProfileA500 is ProfileAmiga, filtered as the Amiga 500's output is
+	ProfileA500 = "a500"
+	// ProfileA500LED is ProfileA500, with the LED filter on
+	ProfileA500LED = "a500-led"
+	// ProfileA1200 is ProfileAmiga, filtered as the Amiga 1200's output is
+	ProfileA1200 = "a1200"
+	// ProfileA1200LED is ProfileA1200, with the LED filter on
+	ProfileA1200LED = "a1200-led"
+)
+
+// ProfileNames are the names of the mixing profiles
+var ProfileNames = []string{ProfileAuto, ProfileCustom, ProfileSong, ProfileAmiga, ProfileA500, ProfileA500LED, ProfileA1200, ProfileA1200LED}
+
+// amigaProfiles are the effects of each of the profiles that mix songs as the Amiga does
+var amigaProfiles = map[string]string{
+	ProfileAmiga:    "",
+	ProfileA500:     "a500",
+	ProfileA500LED:  "a500:led=on",
+	ProfileA1200:    "a1200",
+	ProfileA1200LED: "a1200:led=on",
+}
+
+// ValidateProfile returns an error if there's no mixing profile with the name. No name is
+// ProfileAuto.
+func ValidateProfile(name string) error {
+	if name != "" && !slices.Contains(ProfileNames, name) {
+		return fmt.Errorf("unknown mixing profile %q - must be one of {%s}", name, strings.Join(ProfileNames, ", "))
+	}
+	return nil
+}
+
+// mixProfile is how a song is mixed
+type mixProfile struct {
+	stereoSeparation int    // in percent
+	amigaPanning     bool   // pan the channels as the Amiga does, instead of as the song does
+	dsp              string // effects the mix passes through, ahead of the song's own
+}
+
+// getEntryProfileName returns the name of the profile the playlist entry is mixed with
+func getEntryProfileName(entry *playlist.Song, renderSettings *Settings) string {
+	name := entry.Profile
+	if name == "" {
+		name = renderSettings.Profile
+	}
+	if name == "" {
+		name = ProfileAuto
+	}
+	return name
+}
+
+// getEntryProfile works out how the playlist entry is mixed, at the stereo separation given, from
+// its profile and - for the profiles that depend on it - its file
+func getEntryProfile(entry *playlist.Song, renderSettings *Settings, stereoSeparation int) (mixProfile, error) {
+	name := getEntryProfileName(entry, renderSettings)
+	if err := ValidateProfile(name); err != nil {
+		return mixProfile{}, err
+	}
+
+	p := mixProfile{
+		stereoSeparation: stereoSeparation,
+	}
+	switch name {
+	case ProfileCustom:
+		return p, nil
+	case ProfileAuto, ProfileSong:
+		mix, err := readSongMix(entry.Filepath)
+		if err != nil {
+			return p, err
+		}
+		if name == ProfileSong || !mix.isMOD {
+			p.stereoSeparation = int(math.Round(float64(stereoSeparation) * mix.separation))
+			return p, nil
+		}
+		name = ProfileAmiga
+	}
+
+	p.stereoSeparation = 100
+	p.amigaPanning = true
+	p.dsp = amigaProfiles[name]
+	return p, nil
+}
+
+// effects returns the chain of effects the audio of the playlist entry is processed with
+func (p mixProfile) effects(entry *playlist.Song) string {
+	if p.dsp == "" || entry.DSP == "" {
+		return p.dsp + entry.DSP
+	}
+	return p.dsp + "," + entry.DSP
+}
+
+// panner returns what pans the channels of the song, for a render of the channels, or nil if
+// they're panned as the song says
+func (p mixProfile) panner(renderChannels int) *amigaPanner {
+	if !p.amigaPanning {
+		return nil
+	}
+	pm := mixing.GetPanMixer(renderChannels)
+	if pm == nil {
+		return nil
+	}
+	return &amigaPanner{
+		left:  pm.GetMixingMatrix(panning.MakeStereoPosition(0, 0, 1), 1),
+		right: pm.GetMixingMatrix(panning.MakeStereoPosition(1, 0, 1), 1),
+	}
+}
+
+// amigaPanner pans the channels hard left and right, in the order the Amiga does (L R R L). The
+// Amiga has no way to pan a channel, so the panning a song sets is ignored.
+type amigaPanner struct {
+	left, right panning.PanMixer
+}
+
+func (p *amigaPanner) apply(premix *playbackOutput.PremixData) {
+	if p == nil || len(premix.Data) == 0 {
+		return
+	}
+
+	outputs := premix.Data[0]
+	for i := range outputs {
+		switch i % 4 {
+		case 0, 3:
+			outputs[i].PanMatrix = p.left
+		default:
+			outputs[i].PanMatrix = p.right
+		}
+	}
+}
+
+// songMix is what the file of a song says about how it's mixed
+type songMix struct {
+	isMOD      bool
+	separation float64 // of the song's panning, from 0 (mono) to 1 (as it's panned)
+}
+
+// modHeaderSize is the size of the header of a MOD file, up to its patterns
+const modHeaderSize = 1084
+
+// readSongMix reads what the file of the song says about how it's mixed. Files that aren't
+// Impulse Tracker, Scream Tracker or FastTracker II songs are taken to be MODs.
+func readSongMix(filename string) (songMix, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return songMix{}, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, modHeaderSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return songMix{}, err
+	}
+	buf = buf[:n]
+
+	mix := songMix{
+		separation: 1,
+	}
+	if it, err := itfile.ReadModuleHeader(bytes.NewReader(buf)); err == nil && string(it.IMPM[:]) == "IMPM" {
+		mix.separation = float64(min(it.PanningSeparation, 128)) / 128
+		return mix, nil
+	}
+	if s3m, err := s3mfile.ReadModuleHeader(bytes.NewReader(buf)); err == nil && string(s3m.SCRM[:]) == "SCRM" {
+		if s3m.MixingVolume&0x80 == 0 {
+			mix.separation = 0
+		}
+		return mix, nil
+	}
+	if bytes.HasPrefix(buf, []byte("Extended Module: ")) {
+		return mix, nil
+	}
+	mix.isMOD = true
+	return mix, nil
+}
@@ -0,0 +1,223 @@
+package play
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/events"
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+// The ways of reporting progress
+const (
+	ProgressText = "text"
+	ProgressJSON = "json"
+)
+
+// progressInterval is the least time between the position reports of the JSON progress
+const progressInterval = 500 * time.Millisecond
+
+// progressQueueSize is how many reports may be waiting to be written before further position
+// reports are dropped
+const progressQueueSize = 256
+
+// progressReport is a line of the JSON progress
+type progressReport struct {
+	Event    string   `json:"event"`
+	Index    *int     `json:"index,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Artist   string   `json:"artist,omitempty"`
+	Channels int      `json:"channels,omitempty"`
+	Orders   int      `json:"orders,omitempty"`
+	Order    *int     `json:"order,omitempty"`
+	Row      *int     `json:"row,omitempty"`
+	Percent  *float64 `json:"percent,omitempty"`
+	Elapsed  *float64 `json:"elapsed,omitempty"` // seconds of audio written
+	Message  string   `json:"message,omitempty"`
+	Played   *int     `json:"played,omitempty"`
+	Failed   *int     `json:"failed,omitempty"`
+	WallTime *float64 `json:"wall_time,omitempty"` // seconds since playback started
+	Outputs  []string `json:"outputs,omitempty"`
+}
+
+// jsonProgress writes the progress of a playlist as newline-delimited JSON. It's fed the
+// playback events, so positions are reported as the audio is written.
+//
+// It outlives the publisher of the events, so closing it as a sink does nothing - it's Finish
+// that writes the summary and closes it.
+type jsonProgress struct {
+	w       io.Writer
+	started time.Time
+	ch      chan progressReport
+	done    chan struct{}
+
+	mu         sync.Mutex
+	song       *events.Song
+	lastReport time.Time
+	played     int
+	failed     int
+	elapsed    float64
+	finished   bool
+}
+
+// newJSONProgress starts writing JSON progress to the file descriptor
+func newJSONProgress(fd int) (*jsonProgress, error) {
+	var f *os.File
+	switch fd {
+	case 1:
+		f = os.Stdout
+	case 2:
+		f = os.Stderr
+	default:
+		f = os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	}
+	if f == nil {
+		return nil, fmt.Errorf("invalid progress file descriptor: %d", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("invalid progress file descriptor: %d: %w", fd, err)
+	}
+
+	p := jsonProgress{
+		w:       f,
+		started: time.Now(),
+		ch:      make(chan progressReport, progressQueueSize),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return &p, nil
+}
+
+func (p *jsonProgress) run() {
+	defer close(p.done)
+	enc := json.NewEncoder(p.w)
+	for r := range p.ch {
+		if err := enc.Encode(r); err != nil {
+			// whoever was reading has gone away - keep draining so playback isn't held up
+			continue
+		}
+	}
+}
+
+// Publish turns the playback event into a progress report
+func (p *jsonProgress) Publish(ev events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch ev.Type {
+	case events.TypeSongStart:
+		p.song = ev.Song
+		p.lastReport = time.Now()
+		p.queue(progressReport{
+			Event:    "entry_start",
+			Index:    &ev.Song.Index,
+			Path:     ev.Song.Filepath,
+			Title:    ev.Song.Title,
+			Artist:   ev.Song.Artist,
+			Channels: ev.Song.Channels,
+			Orders:   ev.Song.Orders,
+		}, true)
+
+	case events.TypeSongEnd:
+		p.played++
+		p.elapsed += ev.Time
+		p.song = nil
+		percent := float64(100)
+		p.queue(progressReport{
+			Event:   "entry_end",
+			Index:   &ev.Song.Index,
+			Path:    ev.Song.Filepath,
+			Order:   &ev.Order,
+			Row:     &ev.Row,
+			Percent: &percent,
+			Elapsed: &ev.Time,
+		}, true)
+
+	default:
+		if p.song == nil || time.Since(p.lastReport) < progressInterval {
+			return
+		}
+		p.lastReport = time.Now()
+
+		var percent float64
+		if p.song.Orders > 0 {
+			percent = min(float64(ev.Order)*100/float64(p.song.Orders), 100)
+		}
+		p.queue(progressReport{
+			Event:   "progress",
+			Index:   &p.song.Index,
+			Orders:  p.song.Orders,
+			Order:   &ev.Order,
+			Row:     &ev.Row,
+			Percent: &percent,
+			Elapsed: &ev.Time,
+		}, false)
+	}
+}
+
+// Error reports that the entry couldn't be played
+func (p *jsonProgress) Error(entry *playlist.Song, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := progressReport{
+		Event:   "error",
+		Message: err.Error(),
+	}
+	if entry != nil {
+		p.failed++
+		r.Path = entry.Filepath
+	}
+	p.queue(r, true)
+}
+
+// Finish reports the outcome of playing the playlist (along with the error that stopped it, if
+// there was one), then writes the remaining reports
+func (p *jsonProgress) Finish(outputs []string, err error) {
+	if err != nil {
+		p.Error(nil, err)
+	}
+
+	p.mu.Lock()
+	played, failed, elapsed := p.played, p.failed, p.elapsed
+	wallTime := time.Since(p.started).Seconds()
+	p.queue(progressReport{
+		Event:    "summary",
+		Played:   &played,
+		Failed:   &failed,
+		Elapsed:  &elapsed,
+		WallTime: &wallTime,
+		Outputs:  outputs,
+	}, true)
+	p.finished = true
+	p.mu.Unlock()
+
+	close(p.ch)
+	<-p.done
+}
+
+// queue queues the report to be written. Position reports are dropped if the reader is falling
+// behind, but nothing else is. It must be called with the lock held.
+func (p *jsonProgress) queue(r progressReport, mustSend bool) {
+	if p.finished {
+		return
+	}
+	if mustSend {
+		p.ch <- r
+		return
+	}
+	select {
+	case p.ch <- r:
+	default:
+	}
+}
+
+// Close does nothing, as the progress is closed by Finish
+func (p *jsonProgress) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package play
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/playlist"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+	"github.com/gotracker/playback/player/machine"
+	"github.com/gotracker/playback/player/sampler"
+	"github.com/gotracker/playback/tracing"
+)
+
+// Render renders the playlist to the output device(s) without reporting any progress, stopping
+// early if the context is cancelled. The playlist is played through once, even if it's set to loop.
+// The output format is expected to have been negotiated already.
+func Render(ctx context.Context, pl *playlist.Playlist, features []playbackFeature.Feature, settings *Settings, outCfg *deviceCommon.Settings, logger logging.Log) (bool, error) {
+	cfg := *outCfg
+	cfg.OnRowOutput = nil
+
+	pl.SetLooping(false)
+
+	var r renderer
+	defer r.Close()
+
+	waveOut, devFeatures, err := startOutput(&r, cfg, logger)
+	if err != nil {
+		return false, err
+	}
+
+	features = append(features, devFeatures...)
+	features = append(features, playbackFeature.IgnoreUnknownEffect{Enabled: true})
+
+	err = r.renderSongs(ctx, pl, features, settings, &cfg, logger, func(entry *playlist.Song, m machine.MachineTicker, outCfg *deviceCommon.Settings, out *sampler.Sampler, tickInterval time.Duration, tracer tracing.Tracer) error {
+		if err := r.startEntry(entry, getEntryGain(entry, nil), m, r.songData, settings, out); err != nil {
+			return err
+		}
+
+		p, err := NewPlayer(ctx, tickInterval, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := p.Play(m, out, tracer); err != nil {
+			return err
+		}
+
+		return p.WaitUntilDone()
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	// whatever was rendered is always written out, so the device can be closed cleanly
+	if finishErr := waveOut.Finish(&r); err == nil {
+		err = finishErr
+	}
+
+	return r.playedAtLeastOneEntry, err
+}
@@ -1,9 +1,24 @@
 package play
 
 type Settings struct {
-	NumPremixBuffers    int  `pflag:"num-buffers" env:"num_buffers" usage:"number of premixed buffers"`
-	ITLongChannelOutput bool `pflag:"it-long" env:"it_long" usage:"enable Impulse Tracker long channel display"`
-	ITEnableNNA         bool `pflag:"it-enable-nna" env:"it_enable_nna" usage:"enable Impulse Tracker New Note Actions"`
+	NumPremixBuffers    int     `pflag:"num-buffers" env:"num_buffers" usage:"number of premixed buffers"`
+	ITLongChannelOutput bool    `pflag:"it-long" env:"it_long" usage:"enable Impulse Tracker long channel display"`
+	ITEnableNNA         bool    `pflag:"it-enable-nna" env:"it_enable_nna" usage:"enable Impulse Tracker New Note Actions"`
+	CueSheet            bool    `pflag:"cue-sheet" env:"cue_sheet" usage:"write a .cue sheet alongside the output file when rendering a playlist into a single file"`
+	EventsListen        string  `pflag:"events-listen" env:"events_listen" usage:"address to serve a WebSocket feed of playback events on (e.g.: 127.0.0.1:8001, empty = disabled)"`
+	EventsAnyOrigin     bool    `pflag:"events-any-origin" env:"events_any_origin" usage:"let web pages from any site follow the event feed - otherwise only its own page and pages served from localhost may"`
+	OSCTarget           string  `pflag:"osc-target" env:"osc_target" usage:"host:port to send OSC messages of playback events to over UDP (e.g.: 127.0.0.1:9000, empty = disabled)"`
+	OSCLatency          int     `pflag:"osc-latency" env:"osc_latency" usage:"milliseconds to hold OSC messages back by, to line them up with the audio that's heard"`
+	Progress            string  `pflag:"progress" env:"progress" usage:"how to report the progress of playback {text, json} - json writes newline-delimited JSON events to the progress file descriptor"`
+	ProgressFD          int     `pflag:"progress-fd" env:"progress_fd" usage:"file descriptor to write JSON progress to (2 = stderr)"`
+	Meters              bool    `pflag:"meters" env:"meters" usage:"show meters of the level and spectrum of the audio being played"`
+	TUI                 bool    `pflag:"tui" env:"tui" usage:"show a full-screen terminal interface instead of logging each row"`
+	Profile             string  `pflag:"mix-profile" env:"mix_profile" usage:"how songs are mixed, unless the playlist says otherwise {auto, custom, song, amiga, a500, a500-led, a1200, a1200-led} - auto mixes MODs as amiga does and everything else as song does; song keeps to the song's own stereo settings, custom ignores them; the amiga profiles pan the channels hard left and right (L R R L), whatever the stereo separation, and the a500 and a1200 ones filter the audio as those models do"`
+	Oversample          int     `pflag:"oversample" env:"oversample" usage:"render at this many times the sample rate (1-8), then filter it back down to it, for less aliasing of instruments played high above their pitch"`
+	Speed               float64 `pflag:"speed" env:"speed" usage:"speed to play songs at, relative to their own tempo (0.25-4, e.g.: 0.8) - unlike --bpm and --tempo, it holds through the song's own changes of tempo"`
+	Transpose           float64 `pflag:"transpose" env:"transpose" usage:"semitones to shift the pitch of songs by (-24 to 24, e.g.: -2)"`
+	SpeedMode           string  `pflag:"speed-mode" env:"speed_mode" usage:"how --speed changes songs {tempo, resample} - tempo keeps them at their pitch, resample changes their pitch along with their tempo, as playing a tape faster or slower does"`
+	Normalize           string  `pflag:"normalize" env:"normalize" usage:"loudness normalization {off, track, album} - track brings each song to the same loudness, album brings the playlist as a whole to it, keeping the songs' levels relative to each other"`
 }
 
 type DebugSettings struct {
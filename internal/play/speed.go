@@ -0,0 +1,217 @@
+package play
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	itLayout "github.com/gotracker/playback/format/it/layout"
+	s3mLayout "github.com/gotracker/playback/format/s3m/layout"
+	xmLayout "github.com/gotracker/playback/format/xm/layout"
+	"github.com/gotracker/playback/frequency"
+	"github.com/gotracker/playback/instrument"
+	"github.com/gotracker/playback/period"
+	"github.com/gotracker/playback/player/sampler"
+	"github.com/gotracker/playback/song"
+
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+const (
+	// SpeedModeTempo changes the tempo of songs, keeping them at their pitch
+	SpeedModeTempo = "tempo"
+	// SpeedModeResample changes the tempo and pitch of songs together, as playing a tape faster
+	// or slower does
+	SpeedModeResample = "resample"
+)
+
+// SpeedModeNames are the names of the ways the speed of songs can be changed
+var SpeedModeNames = []string{SpeedModeTempo, SpeedModeResample}
+
+const (
+	// MinSpeed is the slowest songs can be played, relative to their own tempo
+	MinSpeed = 0.25
+	// MaxSpeed is the fastest songs can be played, relative to their own tempo
+	MaxSpeed = 4.0
+	// MaxTranspose is the most songs can be transposed by, up or down, in semitones
+	MaxTranspose = 24.0
+)
+
+// ValidateSpeed returns an error if songs can't be played at the speed
+func ValidateSpeed(speed float64) error {
+	if !(speed >= MinSpeed && speed <= MaxSpeed) {
+		return fmt.Errorf("speed %g out of range (%g to %g)", speed, MinSpeed, MaxSpeed)
+	}
+	return nil
+}
+
+// ValidateTranspose returns an error if songs can't be transposed by the semitones
+func ValidateTranspose(semitones float64) error {
+	if !(math.Abs(semitones) <= MaxTranspose) {
+		return fmt.Errorf("transposition %g out of range (-%g to +%g semitones)", semitones, MaxTranspose, MaxTranspose)
+	}
+	return nil
+}
+
+// ValidateSpeedMode returns an error if there's no speed mode with the name. No name is
+// SpeedModeTempo.
+func ValidateSpeedMode(name string) error {
+	if name != "" && !slices.Contains(SpeedModeNames, name) {
+		return fmt.Errorf("unknown speed mode %q - must be one of {%s}", name, strings.Join(SpeedModeNames, ", "))
+	}
+	return nil
+}
+
+// speed is how fast, and at what pitch, a song is played
+type speed struct {
+	factor    float64 // of the song's tempo
+	transpose float64 // semitones
+	mode      string
+}
+
+// normalSpeed plays songs as they're written
+var normalSpeed = speed{
+	factor: 1,
+	mode:   SpeedModeTempo,
+}
+
+func (s speed) validate() error {
+	if err := ValidateSpeed(s.factor); err != nil {
+		return err
+	}
+	if err := ValidateTranspose(s.transpose); err != nil {
+		return err
+	}
+	return ValidateSpeedMode(s.mode)
+}
+
+// getEntrySpeed returns the speed the playlist entry is played at - its own, where it has one,
+// or else the one of the settings
+func getEntrySpeed(entry *playlist.Song, renderSettings *Settings) (speed, error) {
+	s := speed{
+		factor:    renderSettings.Speed,
+		transpose: renderSettings.Transpose,
+		mode:      renderSettings.SpeedMode,
+	}
+	if v, ok := entry.Speed.Get(); ok {
+		s.factor = v
+	}
+	if v, ok := entry.Transpose.Get(); ok {
+		s.transpose = v
+	}
+	if entry.SpeedMode != "" {
+		s.mode = entry.SpeedMode
+	}
+
+	if s.factor == 0 {
+		s.factor = normalSpeed.factor
+	}
+	if s.mode == "" {
+		s.mode = normalSpeed.mode
+	}
+	return s, s.validate()
+}
+
+// varispeed plays a song faster or slower, and higher or lower, than it's written. The sampler is
+// told it renders at a lower rate to play the song faster, so the ticks of the song fit into
+// fewer samples and its instruments play higher by the same amount. The rates of the instruments
+// are then scaled to bring them to the pitch that's wanted.
+//
+// The speed is changed between the ticks of the song, as they're rendered.
+type varispeed struct {
+	rate int // the sampler renders at, at the normal speed
+
+	mu      sync.Mutex
+	speed   speed
+	changed bool
+
+	instruments []instrument.InstrumentIntf // of the song being played
+	rates       []frequency.Frequency       // of the instruments, as the song has them
+}
+
+// start sets the song up to be played at the speed. The sampler is set to it straight away, as
+// nothing's being rendered yet.
+func (v *varispeed) start(songData song.Data, s speed, out *sampler.Sampler) {
+	v.mu.Lock()
+	v.instruments = getSongInstruments(songData)
+	v.rates = make([]frequency.Frequency, len(v.instruments))
+	for i, inst := range v.instruments {
+		v.rates[i] = inst.GetSampleRate()
+	}
+	v.speed = s
+	v.changed = true
+	v.mu.Unlock()
+
+	v.apply(out)
+}
+
+// get returns the speed the song is played at
+func (v *varispeed) get() speed {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.speed
+}
+
+// set changes the speed the song is played at, from the next tick that's rendered
+func (v *varispeed) set(s speed) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.speed = s
+	v.changed = true
+	return nil
+}
+
+// apply sets the sampler and the instruments of the song to the speed, if it's changed. It's
+// meant to be called between the ticks of the song, as they're rendered.
+func (v *varispeed) apply(out *sampler.Sampler) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.changed {
+		return
+	}
+	v.changed = false
+
+	rate := max(int(math.Round(float64(v.rate)/v.speed.factor)), 1)
+	out.SampleRate = rate
+
+	pitch := math.Exp2(v.speed.transpose / 12)
+	if v.speed.mode == SpeedModeTempo {
+		// undo the change of pitch that the sampler's change of rate makes
+		pitch *= float64(rate) / float64(v.rate)
+	}
+	for i, inst := range v.instruments {
+		inst.SetSampleRate(v.rates[i] * frequency.Frequency(pitch))
+	}
+}
+
+// getSongInstruments returns the instruments (or samples) of the song
+func getSongInstruments(songData song.Data) []instrument.InstrumentIntf {
+	switch s := songData.(type) {
+	case *s3mLayout.Song:
+		return instrumentsOf(s.Instruments)
+	case *xmLayout.Song[period.Linear]:
+		return instrumentsOf(s.Instruments)
+	case *xmLayout.Song[period.Amiga]:
+		return instrumentsOf(s.Instruments)
+	case *itLayout.Song[period.Linear]:
+		return instrumentsOf(s.Instruments)
+	case *itLayout.Song[period.Amiga]:
+		return instrumentsOf(s.Instruments)
+	}
+	return nil
+}
+
+func instrumentsOf[T instrument.InstrumentIntf](insts []T) []instrument.InstrumentIntf {
+	out := make([]instrument.InstrumentIntf, len(insts))
+	for i, inst := range insts {
+		out[i] = inst
+	}
+	return out
+}
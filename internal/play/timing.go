@@ -0,0 +1,105 @@
+package play
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	playbackOutput "github.com/gotracker/playback/output"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+	"github.com/gotracker/playback/player/machine"
+	"github.com/gotracker/playback/player/machine/settings"
+	"github.com/gotracker/playback/player/render"
+	"github.com/gotracker/playback/player/sampler"
+	"github.com/gotracker/playback/song"
+
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+const (
+	// timingSampleRate is the rate songs are rendered at to time them - the
+	// lower it is, the quicker (and less precise) the measurement
+	timingSampleRate = 8000
+	// maxSongDuration stops the measurement of songs that never end
+	maxSongDuration = 2 * time.Hour
+)
+
+// RowTiming is the time at which a row starts playing
+type RowTiming struct {
+	Order int
+	Row   int
+	Start time.Duration
+}
+
+// SongTiming is the result of timing a song
+type SongTiming struct {
+	Duration time.Duration
+	Rows     []RowTiming // in the order they are played
+}
+
+// MeasureSong times a single play through the song, ignoring its loop settings
+func MeasureSong(entry *playlist.Song, features []playbackFeature.Feature, renderSettings *Settings) (*SongTiming, error) {
+	var us settings.UserSettings
+	m, _, err := newEntryMachine(entry, features, false, renderSettings, &us)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		t       SongTiming
+		samples int64
+	)
+	out := sampler.NewSampler(timingSampleRate, 1, 0, func(premix *playbackOutput.PremixData) {
+		if row, ok := premix.Userdata.(*render.RowRender); ok && row.Tick == 0 {
+			t.Rows = append(t.Rows, RowTiming{
+				Order: row.Order,
+				Row:   row.Row,
+				Start: samplesToDuration(samples),
+			})
+		}
+		samples += int64(premix.SamplesLen)
+	})
+
+	if err := renderOffline(m, out, &samples, timingSampleRate); err != nil {
+		return nil, err
+	}
+
+	t.Duration = samplesToDuration(samples)
+	return &t, nil
+}
+
+// renderOffline renders the song through the sampler as fast as it can, until it stops or the
+// samples rendered (which the sampler's callback keeps count of) reach the longest a song can be
+func renderOffline(m machine.MachineTicker, out *sampler.Sampler, samples *int64, sampleRate int) error {
+	maxSamples := int64(maxSongDuration.Seconds() * float64(sampleRate))
+	for *samples < maxSamples {
+		if err := m.Advance(); err != nil {
+			if errors.Is(err, song.ErrStopSong) {
+				break
+			}
+			return err
+		}
+		if err := m.Render(out); err != nil {
+			if errors.Is(err, song.ErrStopSong) {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func samplesToDuration(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / timingSampleRate
+}
+
+// RowAt returns the row that is playing at the time
+func (t *SongTiming) RowAt(d time.Duration) (RowTiming, bool) {
+	if len(t.Rows) == 0 || d < 0 || d >= t.Duration {
+		return RowTiming{}, false
+	}
+	i := sort.Search(len(t.Rows), func(i int) bool {
+		return t.Rows[i].Start > d
+	})
+	return t.Rows[max(i-1, 0)], true
+}
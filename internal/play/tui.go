@@ -0,0 +1,220 @@
+package play
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"sync"
+
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/gotracker/internal/tui"
+	"github.com/gotracker/playback/format"
+	"github.com/gotracker/playback/format/it"
+	"github.com/gotracker/playback/index"
+	playbackFeature "github.com/gotracker/playback/player/feature"
+	"github.com/gotracker/playback/song"
+)
+
+// songPatterns renders the rows of a song's patterns for the terminal UI, the same way they're
+// logged while the song plays
+type songPatterns struct {
+	data     song.Data
+	channels int
+	long     bool
+
+	mu    sync.Mutex
+	cache map[int][]string // by order
+}
+
+// loadSongPatterns loads a second copy of the song, so the patterns can be rendered without
+// disturbing the one being played
+func loadSongPatterns(entry *playlist.Song, features []playbackFeature.Feature, settings *Settings) (*songPatterns, error) {
+	data, songFmt, err := format.Load(entry.Filepath, features...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &songPatterns{
+		data:     data,
+		channels: data.GetNumChannels(),
+		// only Impulse Tracker has a short channel display
+		long:  songFmt != it.IT || settings.ITLongChannelOutput,
+		cache: make(map[int][]string),
+	}, nil
+}
+
+// Rows returns the text of each of the rows of the pattern played at the order
+func (s *songPatterns) Rows(order int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rows, ok := s.cache[order]; ok {
+		return rows
+	}
+
+	var rows []string
+	if pat, err := s.data.GetPatternByOrder(index.Order(order)); err == nil {
+		rows = make([]string, pat.NumRows())
+		for i := range rows {
+			rows[i] = s.data.GetRowRenderStringer(pat.GetRow(index.Row(i)), s.channels, s.long).String()
+		}
+	}
+	s.cache[order] = rows
+	return rows
+}
+
+// getQueueNames returns the names of the songs in the playlist, as shown in the terminal UI
+func getQueueNames(pl *playlist.Playlist) []string {
+	names := make([]string, pl.Len())
+	for i := range names {
+		entry := pl.GetSong(i)
+		name := entry.Title
+		if name == "" {
+			name = filepath.Base(entry.Filepath)
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// tuiControl carries out the commands given through the terminal UI on whichever song is playing
+type tuiControl struct {
+	ui     *tui.UI
+	cancel context.CancelFunc
+	mixer  *channelMixer
+	speed  *varispeed
+
+	mu     sync.Mutex
+	player *Player
+	paused bool
+}
+
+// setPlayer makes the player the one that's controlled (nil = none)
+func (c *tuiControl) setPlayer(p *Player) {
+	c.mu.Lock()
+	c.player = p
+	c.paused = false
+	c.mu.Unlock()
+	c.ui.SetPaused(false)
+	c.ui.SetMuted(c.mixer.Mix().Mute)
+	c.showSpeed()
+}
+
+// speedSteps is how many key presses it takes to speed playback up or slow it down by 1x
+const speedSteps = 20
+
+func (c *tuiControl) showSpeed() {
+	s := c.speed.get()
+	c.ui.SetSpeed(s.factor, s.transpose, s.mode == SpeedModeResample)
+}
+
+// changeSpeed changes the speed of the song that's playing, leaving it as it is if it'd go out
+// of range
+func (c *tuiControl) changeSpeed(change func(s *speed)) {
+	s := c.speed.get()
+	change(&s)
+	if err := c.speed.set(s); err != nil {
+		c.ui.Println(err)
+		return
+	}
+	c.showSpeed()
+}
+
+// run carries out commands until the context is done
+func (c *tuiControl) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cmd := <-c.ui.Commands():
+			c.do(cmd)
+		}
+	}
+}
+
+func (c *tuiControl) do(cmd tui.Command) {
+	c.mu.Lock()
+	p := c.player
+	c.mu.Unlock()
+
+	switch cmd.Action {
+	case tui.ActionQuit:
+		c.cancel()
+		if p != nil {
+			_ = p.Stop() // lint
+		}
+	case tui.ActionNext:
+		if p != nil {
+			_ = p.Stop() // lint
+		}
+	case tui.ActionMute:
+		if p == nil {
+			return
+		}
+		if err := c.mixer.ToggleMute(cmd.Channel); err != nil {
+			c.ui.Println(err)
+			return
+		}
+		c.ui.SetMuted(c.mixer.Mix().Mute)
+	case tui.ActionSlower, tui.ActionFaster:
+		if p == nil {
+			return
+		}
+		step := 1.0
+		if cmd.Action == tui.ActionSlower {
+			step = -step
+		}
+		c.changeSpeed(func(s *speed) {
+			// round off, so the steps land on the same speeds whichever way they're taken
+			s.factor = (math.Round(s.factor*speedSteps) + step) / speedSteps
+		})
+	case tui.ActionTransposeDown, tui.ActionTransposeUp:
+		if p == nil {
+			return
+		}
+		step := 1.0
+		if cmd.Action == tui.ActionTransposeDown {
+			step = -step
+		}
+		c.changeSpeed(func(s *speed) {
+			s.transpose += step
+		})
+	case tui.ActionSpeedMode:
+		if p == nil {
+			return
+		}
+		c.changeSpeed(func(s *speed) {
+			if s.mode == SpeedModeResample {
+				s.mode = SpeedModeTempo
+			} else {
+				s.mode = SpeedModeResample
+			}
+		})
+	case tui.ActionPause:
+		if p == nil {
+			return
+		}
+		c.mu.Lock()
+		paused := !c.paused
+		c.mu.Unlock()
+
+		var err error
+		if paused {
+			err = p.Pause()
+		} else {
+			err = p.Resume()
+		}
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		if c.player == p {
+			c.paused = paused
+		}
+		c.mu.Unlock()
+		c.ui.SetPaused(paused)
+	}
+}
+
+var _ tui.Patterns = (*songPatterns)(nil)
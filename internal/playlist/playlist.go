@@ -32,6 +32,18 @@ func (p *Playlist) Reset() {
 	*p = *New()
 }
 
+// Clear removes all of the songs, keeping the looping and randomization settings
+func (p *Playlist) Clear() {
+	loop, randomized := p.loop, p.randomized
+	p.Reset()
+	p.loop, p.randomized = loop, randomized
+}
+
+// Len returns the number of songs
+func (p Playlist) Len() int {
+	return len(p.songs)
+}
+
 type yamlPlaylist struct {
 	Version string `yaml:"version,omitempty"`
 	Songs   []Song `yaml:"list,omitempty"`
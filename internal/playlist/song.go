@@ -11,12 +11,26 @@ type Position struct {
 
 type Song struct {
 	Filepath string              `yaml:"file,omitempty"`
+	Title    string              `yaml:"title,omitempty"`  // if blank, the title stored in the module is used
+	Artist   string              `yaml:"artist,omitempty"` // reported to devices that can show it (e.g.: desktop mixers)
 	Start    Position            `yaml:"start,omitempty"`
 	End      Position            `yaml:"end,omitempty"`
 	Loop     Loop                `yaml:"loop,omitempty"`
 	Fadeout  Fadeout             `yaml:"fadeout,omitempty"`
 	Tempo    optional.Value[int] `yaml:"tempo,omitempty"`
 	BPM      optional.Value[int] `yaml:"bpm,omitempty"`
+
+	Mute        string   `yaml:"mute,omitempty"`         // channels to silence (e.g.: 1,4-6)
+	Solo        string   `yaml:"solo,omitempty"`         // channels to hear, silencing the rest (e.g.: 3)
+	ChannelGain []string `yaml:"channel_gain,omitempty"` // gains of channels (e.g.: 2=-6dB)
+	DSP         string   `yaml:"dsp,omitempty"`          // chain of effects to process the audio with (e.g.: eq:low=+3,reverb:mix=0.2)
+	Profile     string   `yaml:"mix_profile,omitempty"`  // how the song is mixed, instead of the default for its format (e.g.: a500)
+
+	Speed     optional.Value[float64] `yaml:"speed,omitempty"`      // speed to play the song at, relative to its own tempo (e.g.: 0.8)
+	Transpose optional.Value[float64] `yaml:"transpose,omitempty"`  // semitones to shift the pitch of the song by (e.g.: -2)
+	SpeedMode string                  `yaml:"speed_mode,omitempty"` // how the speed changes the song (e.g.: resample)
+
+	Gain optional.Value[float64] `yaml:"gain,omitempty"` // gain to play the song at, in decibels, instead of the one loudness normalization gives it
 }
 
 type Loop struct {
@@ -0,0 +1,188 @@
+package renderserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/heucuva/optional"
+
+	"github.com/gotracker/gotracker/internal/output"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/output/device/dither"
+	"github.com/gotracker/gotracker/internal/output/device/surround"
+	"github.com/gotracker/gotracker/internal/oversample"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+)
+
+// renderRequest is the settings of a render, as provided by the client
+type renderRequest struct {
+	Format string
+	Output deviceCommon.Settings
+
+	Oversample optional.Value[int]
+	Profile    string
+	Speed      optional.Value[float64]
+	Transpose  optional.Value[float64]
+	SpeedMode  string
+	StartOrder optional.Value[int]
+	StartRow   optional.Value[int]
+	EndOrder   optional.Value[int]
+	EndRow     optional.Value[int]
+}
+
+// parseRenderRequest reads the render settings from the request's form values (or query),
+// using the defaults for anything that isn't specified:
+//
+//	format             output file format (default: wav)
+//	sample-rate        sample rate
+//	channels           channels
+//	bits-per-sample    bits per sample
+//	stereo-separation  stereo separation (0-100)
+//	upmix              strategy for deriving the surround channels of 5.1/7.1 output
+//	dither             dither added when reducing the mix to 8 or 16 bits per sample
+//	oversample         times the sample rate to render at, before filtering it back down to it
+//	mix-profile        how the songs are mixed, unless the playlist says otherwise
+//	speed              speed to play the songs at, relative to their own tempo
+//	transpose          semitones to shift the pitch of the songs by
+//	speed-mode         how the speed changes the songs
+//	start-order        starting order
+//	start-row          starting row
+//	end-order          order to stop at (requires end-row)
+//	end-row            row to stop at (requires end-order)
+func parseRenderRequest(r *http.Request, defaults deviceCommon.Settings) (renderRequest, error) {
+	values := r.Form
+	if values == nil {
+		values = r.URL.Query()
+	}
+
+	req := renderRequest{
+		Format: "wav",
+		Output: defaults,
+	}
+	req.Output.Outputs = nil
+	req.Output.Filepath = ""
+	// the client asked for this format, so it shouldn't quietly receive another
+	req.Output.StrictFormat = true
+
+	if f := values.Get("format"); f != "" {
+		req.Format = strings.ToLower(f)
+	}
+	if _, ok := contentTypes[req.Format]; !ok || !slices.Contains(output.GetFileFormats(), req.Format) {
+		return req, fmt.Errorf("unsupported format %q - must be one of {%s}", req.Format, strings.Join(output.GetFileFormats(), ", "))
+	}
+	req.Output.Outputs = []string{"file?format=" + url.QueryEscape(req.Format)}
+
+	ints := []struct {
+		name     string
+		min, max int
+		set      func(v int)
+	}{
+		{"sample-rate", 1, 1000000, func(v int) { req.Output.SamplesPerSecond = v }},
+		{"channels", 1, 8, func(v int) { req.Output.Channels = v }},
+		{"bits-per-sample", 8, 32, func(v int) { req.Output.BitsPerSample = v }},
+		{"stereo-separation", 0, 100, func(v int) { req.Output.StereoSeparation = v }},
+		{"oversample", 1, oversample.MaxFactor, func(v int) { req.Oversample.Set(v) }},
+		{"start-order", 0, 255, func(v int) { req.StartOrder.Set(v) }},
+		{"start-row", 0, 255, func(v int) { req.StartRow.Set(v) }},
+		{"end-order", 0, 255, func(v int) { req.EndOrder.Set(v) }},
+		{"end-row", 0, 255, func(v int) { req.EndRow.Set(v) }},
+	}
+	for _, p := range ints {
+		s := values.Get(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return req, fmt.Errorf("%s: %q is not a number", p.name, s)
+		}
+		if v < p.min || v > p.max {
+			return req, fmt.Errorf("%s: %d is out of range (%d-%d)", p.name, v, p.min, p.max)
+		}
+		p.set(v)
+	}
+
+	floats := []struct {
+		name     string
+		validate func(v float64) error
+		set      func(v float64)
+	}{
+		{"speed", play.ValidateSpeed, func(v float64) { req.Speed.Set(v) }},
+		{"transpose", play.ValidateTranspose, func(v float64) { req.Transpose.Set(v) }},
+	}
+	for _, p := range floats {
+		s := values.Get(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return req, fmt.Errorf("%s: %q is not a number", p.name, s)
+		}
+		if err := p.validate(v); err != nil {
+			return req, err
+		}
+		p.set(v)
+	}
+
+	if u := values.Get("upmix"); u != "" {
+		if _, err := surround.ParseStrategy(u); err != nil {
+			return req, err
+		}
+		req.Output.Upmix = u
+	}
+
+	if d := values.Get("dither"); d != "" {
+		if _, err := dither.ParseMode(d); err != nil {
+			return req, err
+		}
+		req.Output.Dither = d
+	}
+
+	if p := values.Get("mix-profile"); p != "" {
+		if err := play.ValidateProfile(p); err != nil {
+			return req, err
+		}
+		req.Profile = p
+	}
+
+	if m := values.Get("speed-mode"); m != "" {
+		if err := play.ValidateSpeedMode(m); err != nil {
+			return req, err
+		}
+		req.SpeedMode = m
+	}
+
+	if req.EndOrder.IsSet() != req.EndRow.IsSet() {
+		return req, fmt.Errorf("end-order and end-row must be specified together")
+	}
+
+	return req, nil
+}
+
+// apply sets the requested order range on each of the playlist entries
+func (req renderRequest) apply(pl *playlist.Playlist) {
+	for _, idx := range pl.GetPlaylist() {
+		entry := pl.GetSong(idx)
+		if entry == nil {
+			continue
+		}
+		if o, ok := req.StartOrder.Get(); ok {
+			entry.Start.Order.Set(o)
+		}
+		if r, ok := req.StartRow.Get(); ok {
+			entry.Start.Row.Set(r)
+		}
+		if o, ok := req.EndOrder.Get(); ok {
+			entry.End.Order.Set(o)
+		}
+		if r, ok := req.EndRow.Get(); ok {
+			entry.End.Row.Set(r)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Package renderserver is an HTTP service that renders tracked music on demand, streaming the
+// rendered audio back to the client as it is produced.
+package renderserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/output"
+	deviceCommon "github.com/gotracker/gotracker/internal/output/device/common"
+	"github.com/gotracker/gotracker/internal/play"
+	"github.com/gotracker/gotracker/internal/playlist"
+	"github.com/gotracker/playback/format"
+	"github.com/gotracker/playback/player/feature"
+)
+
+// Config is the configuration of a render server
+type Config struct {
+	Listen        string // address to listen on (e.g.: 127.0.0.1:8080)
+	Workers       int    // maximum number of renders to run at once
+	MaxUploadSize int64  // maximum size (in bytes) of a request body
+
+	Features []feature.Feature
+	Settings play.Settings
+	Output   deviceCommon.Settings // the default output format of a render
+}
+
+// Server renders the modules posted to it
+type Server struct {
+	cfg    Config
+	srv    *http.Server
+	ln     net.Listener
+	logger logging.Log
+
+	workers chan struct{}
+	active  atomic.Int32
+	queued  atomic.Int32
+	jobID   atomic.Uint64
+}
+
+// contentTypes maps the output file formats to the content type of the response
+var contentTypes = map[string]string{
+	"wav":  "audio/wav",
+	"flac": "audio/flac",
+}
+
+// New creates the server and starts listening for connections
+func New(cfg Config, logger logging.Log) (*Server, error) {
+	if cfg.Workers < 1 {
+		return nil, errors.New("at least one worker is required")
+	}
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{
+		cfg:     cfg,
+		ln:      ln,
+		logger:  logger,
+		workers: make(chan struct{}, cfg.Workers),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", s.handleRender)
+	mux.HandleFunc("/status", s.handleStatus)
+
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return &s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Serve handles requests until the server is shut down
+func (s *Server) Serve() error {
+	if err := s.srv.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting new requests and waits for the running renders to finish.
+// If the context is done first, the remaining renders are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return errors.Join(err, s.srv.Close())
+	}
+	return nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := map[string]any{
+		"workers": s.cfg.Workers,
+		"active":  s.active.Load(),
+		"queued":  s.queued.Load(),
+		"formats": output.GetFileFormats(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	_ = json.NewEncoder(w).Encode(status) // lint
+}
+
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := s.jobID.Add(1)
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxUploadSize)
+
+	dir, err := os.MkdirTemp("", "gotracker-render-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	pl, err := readPlaylist(r, dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := parseRenderRequest(r, s.cfg.Output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.apply(pl)
+
+	// catch modules that can't be loaded while an error can still be reported
+	if err := s.checkPlaylist(pl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outCfg := req.Output
+	if err := output.NegotiateFormat(&outCfg, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// wait for a worker to become available
+	s.queued.Add(1)
+	select {
+	case s.workers <- struct{}{}:
+		s.queued.Add(-1)
+	case <-r.Context().Done():
+		s.queued.Add(-1)
+		s.logger.Printf("render %d: cancelled while queued\n", id)
+		return
+	}
+	s.active.Add(1)
+	defer func() {
+		s.active.Add(-1)
+		<-s.workers
+	}()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	w.Header().Set("Content-Type", contentTypes[req.Format])
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.Header().Set("X-Sample-Rate", strconv.Itoa(outCfg.SamplesPerSecond))
+	w.Header().Set("X-Channels", strconv.Itoa(outCfg.Channels))
+	w.Header().Set("X-Bits-Per-Sample", strconv.Itoa(outCfg.BitsPerSample))
+
+	jw := jobWriter{
+		w:      w,
+		cancel: cancel,
+	}
+	jw.flusher, _ = w.(http.Flusher)
+	outCfg.Writer = &jw
+
+	start := time.Now()
+	s.logger.Printf("render %d: started (%d Hz, %d channels, %d bits, %s)\n", id, outCfg.SamplesPerSecond, outCfg.Channels, outCfg.BitsPerSample, req.Format)
+
+	settings := s.cfg.Settings
+	if f, ok := req.Oversample.Get(); ok {
+		settings.Oversample = f
+	}
+	if req.Profile != "" {
+		settings.Profile = req.Profile
+	}
+	if v, ok := req.Speed.Get(); ok {
+		settings.Speed = v
+	}
+	if v, ok := req.Transpose.Get(); ok {
+		settings.Transpose = v
+	}
+	if req.SpeedMode != "" {
+		settings.SpeedMode = req.SpeedMode
+	}
+	playedAtLeastOne, err := play.Render(ctx, pl, append([]feature.Feature{}, s.cfg.Features...), &settings, &outCfg, s.logger)
+	switch {
+	case errors.Is(err, context.Canceled):
+		s.logger.Printf("render %d: cancelled after %v\n", id, time.Since(start))
+	case err != nil:
+		s.logger.Printf("render %d: failed: %v\n", id, err)
+		if jw.Written() == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case !playedAtLeastOne:
+		s.logger.Printf("render %d: nothing was rendered\n", id)
+		if jw.Written() == 0 {
+			http.Error(w, "nothing could be rendered", http.StatusUnprocessableEntity)
+		}
+	default:
+		s.logger.Printf("render %d: done in %v (%d bytes)\n", id, time.Since(start), jw.Written())
+	}
+}
+
+// checkPlaylist makes sure that each of the playlist entries can be loaded
+func (s *Server) checkPlaylist(pl *playlist.Playlist) error {
+	for _, idx := range pl.GetPlaylist() {
+		entry := pl.GetSong(idx)
+		if entry == nil {
+			continue
+		}
+		if _, _, err := format.Load(entry.Filepath, s.cfg.Features...); err != nil {
+			return fmt.Errorf("could not load %q: %w", filepath.Base(entry.Filepath), err)
+		}
+	}
+	return nil
+}
+
+// jobWriter streams the rendered output to the client. Once a write fails (e.g.: the client
+// disconnected), the render is cancelled and everything else written is discarded.
+type jobWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	written int64
+	failed  bool
+}
+
+func (jw *jobWriter) Write(p []byte) (int, error) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if jw.failed {
+		return len(p), nil
+	}
+
+	n, err := jw.w.Write(p)
+	jw.written += int64(n)
+	if err != nil {
+		jw.failed = true
+		jw.cancel()
+		return len(p), nil
+	}
+
+	if jw.flusher != nil {
+		jw.flusher.Flush()
+	}
+	return n, nil
+}
+
+// Written returns the number of bytes written to the client
+func (jw *jobWriter) Written() int64 {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	return jw.written
+}
+
+// readPlaylist reads the modules (and optional playlist) from the request, storing any uploaded
+// files in dir. A multipart form may contain one or more `module` files and a `playlist` YAML file
+// that refers to them by name - and only to them; otherwise the request body is the module to
+// render.
+func readPlaylist(r *http.Request, dir string) (*playlist.Playlist, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "module"
+		}
+		fn, err := saveUpload(r.Body, dir, name)
+		if err != nil {
+			return nil, err
+		}
+		pl := playlist.New()
+		pl.Add(playlist.Song{
+			Filepath: fn,
+		})
+		return pl, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		modules []string
+		yaml    string
+	)
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch part.FormName() {
+		case "module":
+			fn, err := saveUpload(part, dir, part.FileName())
+			if err != nil {
+				return nil, err
+			}
+			modules = append(modules, fn)
+		case "playlist":
+			if yaml, err = saveUpload(part, dir, ".playlist.yaml"); err != nil {
+				return nil, err
+			}
+		default:
+			// the render settings may be sent as form fields, too
+			if err := readFormField(r, part); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if yaml != "" {
+		f, err := os.Open(yaml)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		pl, err := playlist.ReadYAML(f, dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not read playlist: %w", err)
+		}
+		// the playlist mustn't reach the server's own files
+		for _, idx := range pl.GetPlaylist() {
+			entry := pl.GetSong(idx)
+			if entry == nil {
+				continue
+			}
+			if !slices.Contains(modules, entry.Filepath) {
+				name, _ := filepath.Rel(dir, entry.Filepath)
+				return nil, fmt.Errorf("playlist entry %q is not a module uploaded with the request", name)
+			}
+		}
+		return pl, nil
+	}
+
+	if len(modules) == 0 {
+		return nil, errors.New("no module or playlist was provided")
+	}
+
+	pl := playlist.New()
+	for _, fn := range modules {
+		pl.Add(playlist.Song{
+			Filepath: fn,
+		})
+	}
+	return pl, nil
+}
+
+// saveUpload stores the uploaded file in dir, returning its path
+func saveUpload(r io.Reader, dir string, name string) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return "", errors.New("invalid upload filename")
+	}
+
+	fn := filepath.Join(dir, name)
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return fn, nil
+}
+
+// readFormField adds a non-file multipart field to the request's form values
+func readFormField(r *http.Request, part *multipart.Part) error {
+	value, err := io.ReadAll(io.LimitReader(part, 1024))
+	if err != nil {
+		return err
+	}
+	if r.Form == nil {
+		r.Form = r.URL.Query()
+	}
+	r.Form.Add(part.FormName(), string(value))
+	return nil
+}
@@ -0,0 +1,270 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/gotracker/gotracker/internal/meter"
+)
+
+// queueWidth is the width of the playlist pane, when there's room for it
+const queueWidth = 32
+
+var (
+	styleDefault  = tcell.StyleDefault
+	styleTitle    = tcell.StyleDefault.Reverse(true).Bold(true)
+	styleLabel    = tcell.StyleDefault.Bold(true)
+	styleDim      = tcell.StyleDefault.Dim(true)
+	styleCurrent  = tcell.StyleDefault.Reverse(true)
+	styleBorder   = tcell.StyleDefault.Foreground(tcell.ColorGray)
+	styleMeter    = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	styleMeterHot = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+	styleClip     = tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true)
+)
+
+// the parts of a block character, in eighths
+var blockEighths = []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉', '█'}
+
+// the heights of a block character, in eighths
+var blockHeights = []rune{' ', '▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+const keyLegend = " space pause/resume   n next   1-0 mute channel   [ ] speed   - + transpose   r resample   q quit "
+
+func (u *UI) draw() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	s := u.screen
+	s.Clear()
+	w, h := s.Size()
+	if w < 20 || h < 8 {
+		drawText(s, 0, 0, w, "window too small", styleDefault)
+		s.Show()
+		return
+	}
+
+	// title bar
+	fill(s, 0, 0, w, 1, styleTitle)
+	title := "gotracker"
+	if u.song != nil {
+		title = "gotracker - " + u.songName()
+	}
+	drawText(s, 1, 0, w-2, title, styleTitle)
+
+	// song details and position
+	u.drawDetails(s, 0, 1, w)
+
+	// key legend and the latest message
+	drawText(s, 0, h-1, w, keyLegend, styleTitle)
+	if n := len(u.messages); n > 0 {
+		drawText(s, 0, h-2, w, u.messages[n-1], styleDim)
+	}
+
+	top, bottom := 4, h-2
+	hline(s, 0, top-1, w)
+	if u.meter != nil {
+		if rows := u.meter.Channels() + 1; bottom-top > rows+4 {
+			u.drawMeter(s, 0, top, w)
+			top += rows + 1
+			hline(s, 0, top-1, w)
+		}
+	}
+	hline(s, 0, bottom, w)
+
+	patternWidth := w
+	if w >= queueWidth*2 {
+		patternWidth = w - queueWidth - 1
+		vline(s, patternWidth, top, bottom-top)
+		u.drawQueue(s, patternWidth+1, top, queueWidth, bottom-top)
+	}
+	u.drawPattern(s, 0, top, patternWidth, bottom-top)
+
+	s.Show()
+}
+
+func (u *UI) songName() string {
+	name := u.song.Title
+	if name == "" {
+		name = u.song.Filepath
+	}
+	if u.song.Artist != "" {
+		name = u.song.Artist + " - " + name
+	}
+	return name
+}
+
+func (u *UI) drawDetails(s tcell.Screen, x, y, w int) {
+	if u.song == nil {
+		drawText(s, x+1, y, w-1, "waiting for playback to start", styleDim)
+		return
+	}
+
+	x += 1 + drawText(s, x+1, y, w-1, "File: ", styleLabel)
+	drawText(s, x, y, w-x, u.song.Filepath, styleDefault)
+
+	state := "playing"
+	if u.paused {
+		state = "paused"
+	}
+	elapsed := time.Duration(u.elapsed * float64(time.Second)).Truncate(time.Second)
+	pos := fmt.Sprintf("Order %03d/%03d  Row %03d  Time %s  Channels %d  [%s]",
+		u.order, u.song.Orders, u.row, formatDuration(elapsed), u.song.Channels, state)
+	if len(u.muted) > 0 {
+		muted := make([]string, len(u.muted))
+		for i, ch := range u.muted {
+			muted[i] = strconv.Itoa(ch)
+		}
+		pos += "  Muted " + strings.Join(muted, ",")
+	}
+	if u.speed != "" {
+		pos += "  " + u.speed
+	}
+	drawText(s, 1, y+1, w-1, pos, styleDefault)
+}
+
+func (u *UI) drawPattern(s tcell.Screen, x, y, w, h int) {
+	if u.song == nil || h <= 0 {
+		return
+	}
+
+	var rows []string
+	if p, ok := u.patterns[u.song.Index]; ok {
+		rows = p.Rows(u.order)
+	}
+
+	center := y + h/2
+	for line := y; line < y+h; line++ {
+		row := u.row + line - center
+		var text string
+		switch {
+		case row == u.row && u.rowText != "":
+			// the row as it was played, which might differ from the pattern if it was, say, muted
+			text = u.rowText
+		case row >= 0 && row < len(rows):
+			text = rows[row]
+		default:
+			continue
+		}
+
+		style := styleDefault
+		if row == u.row {
+			style = styleCurrent
+			fill(s, x, line, w, 1, style)
+		}
+		n := drawText(s, x, line, w, fmt.Sprintf("%03d ", row), styleDim.Reverse(row == u.row))
+		drawText(s, x+n, line, w-n, text, style)
+	}
+}
+
+func (u *UI) drawMeter(s tcell.Screen, x, y, w int) {
+	const labelWidth = 4
+	const levelWidth = 12 // room for the level and a clip warning
+	barWidth := w - labelWidth - levelWidth - 1
+	if barWidth <= 0 {
+		return
+	}
+
+	r := u.meter.Read(barWidth)
+	for c := range r.Peak {
+		drawText(s, x+1, y+c, labelWidth-1, meter.ChannelName(c, len(r.Peak)), styleLabel)
+		drawBar(s, x+labelWidth, y+c, barWidth, meter.Scale(r.Peak[c]))
+		n := drawText(s, x+labelWidth+barWidth+1, y+c, levelWidth, fmt.Sprintf("%5s", meter.FormatDB(r.RMS[c])), styleDefault)
+		if r.Clipped[c] {
+			drawText(s, x+labelWidth+barWidth+2+n, y+c, levelWidth-n-1, "CLIP", styleClip)
+		}
+	}
+
+	// the spectrum, a column per band
+	line := y + len(r.Peak)
+	drawText(s, x+1, line, labelWidth-1, "FFT", styleLabel)
+	for i, l := range r.Spectrum {
+		s.SetContent(x+labelWidth+i, line, blockHeights[int(math.Round(float64(l)*8))], nil, styleMeter)
+	}
+}
+
+// drawBar draws a horizontal bar of the position (0-1), colored by how close it is to full scale
+func drawBar(s tcell.Screen, x, y, w int, pos float32) {
+	eighths := int(math.Round(float64(pos) * float64(w*8)))
+	for i := 0; i < w; i++ {
+		style := styleMeter
+		switch meter.ZoneOf(float32(i+1) / float32(w)) {
+		case meter.ZoneHot:
+			style = styleMeterHot
+		case meter.ZoneClip:
+			style = styleClip
+		}
+		fill := min(max(eighths-i*8, 0), 8)
+		s.SetContent(x+i, y, blockEighths[fill], nil, style)
+	}
+}
+
+func (u *UI) drawQueue(s tcell.Screen, x, y, w, h int) {
+	drawText(s, x+1, y, w-1, "Playlist", styleLabel)
+	y++
+	h--
+	if h <= 0 {
+		return
+	}
+
+	current := -1
+	if u.song != nil {
+		current = u.song.Index
+	}
+
+	// keep the current entry in view
+	first := 0
+	if current >= h {
+		first = current - h/2
+	}
+	for i := first; i < len(u.queue) && i-first < h; i++ {
+		style := styleDefault
+		if i == current {
+			style = styleCurrent
+			fill(s, x, y+i-first, w, 1, style)
+		}
+		drawText(s, x+1, y+i-first, w-1, fmt.Sprintf("%d. %s", i+1, u.queue[i]), style)
+	}
+}
+
+// drawText draws the text at the position, cut off at the width, and returns how much of the
+// width was used
+func drawText(s tcell.Screen, x, y, w int, text string, style tcell.Style) int {
+	n := 0
+	for _, r := range text {
+		if n >= w {
+			break
+		}
+		s.SetContent(x+n, y, r, nil, style)
+		n++
+	}
+	return n
+}
+
+func fill(s tcell.Screen, x, y, w, h int, style tcell.Style) {
+	for j := y; j < y+h; j++ {
+		for i := x; i < x+w; i++ {
+			s.SetContent(i, j, ' ', nil, style)
+		}
+	}
+}
+
+func hline(s tcell.Screen, x, y, w int) {
+	for i := x; i < x+w; i++ {
+		s.SetContent(i, y, tcell.RuneHLine, nil, styleBorder)
+	}
+}
+
+func vline(s tcell.Screen, x, y, h int) {
+	for j := y; j < y+h; j++ {
+		s.SetContent(x, j, tcell.RuneVLine, nil, styleBorder)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,325 @@
+// Package tui is a full-screen terminal interface that follows along with what's being played,
+// showing the pattern around the current row, the song's details and the playlist.
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/gotracker/gotracker/internal/events"
+	"github.com/gotracker/gotracker/internal/logging"
+	"github.com/gotracker/gotracker/internal/meter"
+)
+
+// Action is something the user can ask for
+type Action int
+
+const (
+	// ActionPause is a request to pause playback, or to resume it if it's paused
+	ActionPause = Action(iota)
+	// ActionNext is a request to skip to the next song
+	ActionNext
+	// ActionQuit is a request to stop playing altogether
+	ActionQuit
+	// ActionMute is a request to mute a channel, or to unmute it if it's muted
+	ActionMute
+	// ActionSlower is a request to slow playback down a step
+	ActionSlower
+	// ActionFaster is a request to speed playback up a step
+	ActionFaster
+	// ActionTransposeDown is a request to lower the pitch a semitone
+	ActionTransposeDown
+	// ActionTransposeUp is a request to raise the pitch a semitone
+	ActionTransposeUp
+	// ActionSpeedMode is a request to switch between changing the tempo alone and changing the
+	// tempo and pitch together
+	ActionSpeedMode
+)
+
+// Command is something the user asked for
+type Command struct {
+	Action  Action
+	Channel int // the channel muted, numbered from 1
+}
+
+// Patterns provides the text of the rows of a song's patterns
+type Patterns interface {
+	// Rows returns the text of each of the rows of the pattern played at the order
+	Rows(order int) []string
+}
+
+// maxMessages is how many log messages are kept
+const maxMessages = 100
+
+// minRedrawInterval is the least time between redraws of the screen
+const minRedrawInterval = time.Second / 30
+
+// UI is the terminal interface. It's fed the playback events, so it shows what's being heard,
+// and it collects whatever is logged while it's open, rather than let it scroll past.
+type UI struct {
+	screen   tcell.Screen
+	logger   logging.Log // where messages go once the interface is closed
+	commands chan Command
+	redraw   chan struct{}
+	quit     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+
+	mu       sync.Mutex
+	closed   bool
+	queue    []string
+	patterns map[int]Patterns // by the playlist index of the song
+	meter    *meter.Meter
+	song     *events.Song
+	order    int
+	row      int
+	rowText  string
+	elapsed  float64
+	paused   bool
+	muted    []int
+	speed    string // how fast, and at what pitch, the song plays, if it isn't as written
+	messages []string
+	partial  string // message that hasn't been ended with a newline yet
+}
+
+// New takes over the terminal. The queue is the names of the songs in the playlist.
+func New(queue []string, logger logging.Log) (*UI, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+	if err := screen.Init(); err != nil {
+		return nil, err
+	}
+	screen.HideCursor()
+
+	u := UI{
+		screen:   screen,
+		logger:   logger,
+		commands: make(chan Command, 16),
+		redraw:   make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+		queue:    queue,
+		patterns: make(map[int]Patterns),
+	}
+
+	u.wg.Add(2)
+	go u.pollEvents()
+	go u.drawLoop()
+	u.requestRedraw()
+	return &u, nil
+}
+
+// Commands delivers the commands given by the user
+func (u *UI) Commands() <-chan Command {
+	return u.commands
+}
+
+// SetPatterns provides the patterns of the song at the playlist index, ahead of it being played
+func (u *UI) SetPatterns(index int, p Patterns) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.patterns[index] = p
+}
+
+// SetMeter shows the meter of the audio being written
+func (u *UI) SetMeter(m *meter.Meter) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.meter = m
+}
+
+// SetPaused updates whether playback is paused
+func (u *UI) SetPaused(paused bool) {
+	u.mu.Lock()
+	u.paused = paused
+	u.mu.Unlock()
+	u.requestRedraw()
+}
+
+// SetMuted updates which channels are muted
+func (u *UI) SetMuted(channels []int) {
+	u.mu.Lock()
+	u.muted = channels
+	u.mu.Unlock()
+	u.requestRedraw()
+}
+
+// SetSpeed updates how fast (relative to the song's own tempo) and at what pitch (in semitones)
+// the song plays, and whether they're changed together
+func (u *UI) SetSpeed(speed, transpose float64, resample bool) {
+	var parts []string
+	if speed != 1 {
+		parts = append(parts, fmt.Sprintf("Speed %.2fx", speed))
+	}
+	if transpose != 0 {
+		parts = append(parts, fmt.Sprintf("Transpose %+g", transpose))
+	}
+	if len(parts) > 0 && resample {
+		parts = append(parts, "(resample)")
+	}
+
+	u.mu.Lock()
+	u.speed = strings.Join(parts, " ")
+	u.mu.Unlock()
+	u.requestRedraw()
+}
+
+// Publish follows along with the playback events
+func (u *UI) Publish(ev events.Event) {
+	u.mu.Lock()
+	switch ev.Type {
+	case events.TypeSongStart:
+		u.song = ev.Song
+		u.order, u.row, u.rowText, u.elapsed = 0, 0, "", 0
+	case events.TypeSongEnd:
+		delete(u.patterns, ev.Song.Index)
+	case events.TypeRow:
+		u.order, u.row, u.rowText = ev.Order, ev.Row, ev.Text
+		u.elapsed = ev.Time
+	default:
+		u.elapsed = ev.Time
+	}
+	u.mu.Unlock()
+	u.requestRedraw()
+}
+
+// Print collects the message to be shown, or logs it if the interface has been closed
+func (u *UI) Print(args ...any) {
+	u.addMessage(fmt.Sprint(args...))
+}
+
+// Printf collects the message to be shown, or logs it if the interface has been closed
+func (u *UI) Printf(format string, args ...any) {
+	u.addMessage(fmt.Sprintf(format, args...))
+}
+
+// Println collects the message to be shown, or logs it if the interface has been closed
+func (u *UI) Println(args ...any) {
+	u.addMessage(fmt.Sprintln(args...))
+}
+
+func (u *UI) addMessage(msg string) {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		u.logger.Print(msg)
+		return
+	}
+
+	lines := strings.Split(u.partial+msg, "\n")
+	u.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if line = strings.TrimSpace(line); line != "" {
+			u.messages = append(u.messages, line)
+		}
+	}
+	if n := len(u.messages) - maxMessages; n > 0 {
+		u.messages = u.messages[n:]
+	}
+	u.mu.Unlock()
+	u.requestRedraw()
+}
+
+// Close gives the terminal back, as it was before the interface took it over. It's safe to call
+// more than once, such as when recovering from a panic.
+func (u *UI) Close() error {
+	u.once.Do(func() {
+		u.mu.Lock()
+		u.closed = true
+		u.mu.Unlock()
+
+		close(u.quit)
+		u.screen.Fini()
+		u.wg.Wait()
+	})
+	return nil
+}
+
+func (u *UI) requestRedraw() {
+	select {
+	case u.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (u *UI) sendCommand(c Command) {
+	select {
+	case u.commands <- c:
+	default:
+		// the user is mashing keys faster than they can be handled
+	}
+}
+
+func (u *UI) pollEvents() {
+	defer u.wg.Done()
+	for {
+		ev := u.screen.PollEvent()
+		if ev == nil {
+			// the screen has been closed
+			return
+		}
+
+		switch ev := ev.(type) {
+		case *tcell.EventResize:
+			u.screen.Sync()
+			u.requestRedraw()
+		case *tcell.EventKey:
+			switch {
+			case ev.Key() == tcell.KeyEscape, ev.Key() == tcell.KeyCtrlC, ev.Key() == tcell.KeyRune && (ev.Rune() == 'q' || ev.Rune() == 'Q'):
+				u.sendCommand(Command{Action: ActionQuit})
+			case ev.Key() == tcell.KeyRune && ev.Rune() == ' ':
+				u.sendCommand(Command{Action: ActionPause})
+			case ev.Key() == tcell.KeyRight, ev.Key() == tcell.KeyRune && (ev.Rune() == 'n' || ev.Rune() == 'N'):
+				u.sendCommand(Command{Action: ActionNext})
+			case ev.Key() == tcell.KeyRune && ev.Rune() >= '0' && ev.Rune() <= '9':
+				// 1-9 are the first channels, and 0 is the tenth
+				ch := int(ev.Rune() - '0')
+				if ch == 0 {
+					ch = 10
+				}
+				u.sendCommand(Command{Action: ActionMute, Channel: ch})
+			case ev.Key() == tcell.KeyRune && ev.Rune() == '[':
+				u.sendCommand(Command{Action: ActionSlower})
+			case ev.Key() == tcell.KeyRune && ev.Rune() == ']':
+				u.sendCommand(Command{Action: ActionFaster})
+			case ev.Key() == tcell.KeyRune && ev.Rune() == '-':
+				u.sendCommand(Command{Action: ActionTransposeDown})
+			case ev.Key() == tcell.KeyRune && (ev.Rune() == '+' || ev.Rune() == '='):
+				u.sendCommand(Command{Action: ActionTransposeUp})
+			case ev.Key() == tcell.KeyRune && (ev.Rune() == 'r' || ev.Rune() == 'R'):
+				u.sendCommand(Command{Action: ActionSpeedMode})
+			}
+		}
+	}
+}
+
+func (u *UI) drawLoop() {
+	defer u.wg.Done()
+	defer func() {
+		// don't leave the terminal in a mess if drawing goes wrong
+		if r := recover(); r != nil {
+			u.screen.Fini()
+			panic(r)
+		}
+	}()
+
+	for {
+		select {
+		case <-u.quit:
+			return
+		case <-u.redraw:
+		}
+		u.draw()
+
+		select {
+		case <-u.quit:
+			return
+		case <-time.After(minRedrawInterval):
+		}
+	}
+}